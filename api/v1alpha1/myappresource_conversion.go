@@ -0,0 +1,170 @@
+package v1alpha1
+
+import (
+	"encoding/json"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/domenicbove/angi/api/v1beta1"
+)
+
+// ConversionDataAnnotation holds the v1beta1 spec and status of a MyAppResource
+// read as v1alpha1, so fields that v1alpha1 cannot represent survive a round trip.
+const ConversionDataAnnotation = "my.api.group/conversion-data"
+
+var _ conversion.Convertible = &MyAppResource{}
+
+// ConvertTo converts this MyAppResource to the Hub version (v1beta1).
+func (src *MyAppResource) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1beta1.MyAppResource)
+
+	// start from the hub fields preserved by ConvertFrom, if any, then
+	// overwrite everything that v1alpha1 can represent
+	restored := &v1beta1.MyAppResource{}
+	if data, ok := src.Annotations[ConversionDataAnnotation]; ok {
+		if err := json.Unmarshal([]byte(data), restored); err != nil {
+			return err
+		}
+	}
+
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	delete(dst.Annotations, ConversionDataAnnotation)
+	if len(dst.Annotations) == 0 {
+		dst.Annotations = nil
+	}
+
+	dst.Spec = restored.Spec
+	dst.Spec.ReplicaCount = src.Spec.ReplicaCount
+	dst.Spec.Resources = src.Spec.Resources
+	dst.Spec.Image = v1beta1.Image{}
+	if src.Spec.Image != nil {
+		dst.Spec.Image = v1beta1.Image{
+			Repository: src.Spec.Image.Repository,
+			Tag:        src.Spec.Image.Tag,
+		}
+	}
+	dst.Spec.UI = v1beta1.UI{
+		Color:   src.Spec.UI.Color,
+		Message: src.Spec.UI.Message,
+	}
+	dst.Spec.Redis.Enabled = src.Spec.Redis != nil && src.Spec.Redis.Enabled
+
+	dst.Status = restored.Status
+	dst.Status.ObservedGeneration = src.Status.ObservedGeneration
+	dst.Status.Conditions = src.Status.Conditions
+	dst.Status.PodInfoReadyReplicas = src.Status.PodInfoReadyReplicas
+	dst.Status.RedisReadyReplicas = src.Status.RedisReadyReplicas
+
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1beta1) to this version.
+func (dst *MyAppResource) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1beta1.MyAppResource)
+
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+
+	dst.Spec.ReplicaCount = src.Spec.ReplicaCount
+	dst.Spec.Resources = src.Spec.Resources
+	dst.Spec.Image = nil
+	if src.Spec.Image != (v1beta1.Image{}) {
+		dst.Spec.Image = &Image{
+			Repository: src.Spec.Image.Repository,
+			Tag:        src.Spec.Image.Tag,
+		}
+	}
+	dst.Spec.UI = UI{
+		Color:   src.Spec.UI.Color,
+		Message: src.Spec.UI.Message,
+	}
+	// a disabled Redis reads back as an omitted section, which means the same in v1alpha1
+	dst.Spec.Redis = nil
+	if src.Spec.Redis.Enabled {
+		dst.Spec.Redis = &Redis{Enabled: true}
+	}
+
+	dst.Status = MyAppResourceStatus{
+		ObservedGeneration:   src.Status.ObservedGeneration,
+		Conditions:           src.Status.Conditions,
+		PodInfoReadyReplicas: src.Status.PodInfoReadyReplicas,
+		RedisReadyReplicas:   src.Status.RedisReadyReplicas,
+	}
+
+	// keep the full hub spec and status when v1alpha1 cannot represent all of it,
+	// so ConvertTo can restore the fields dropped here. Fields holding their default
+	// are left out, the API server defaults them again once the object is converted back.
+	spec := withoutDefaults(src.Spec)
+	roundTrip := &v1beta1.MyAppResource{}
+	if err := dst.ConvertTo(roundTrip); err != nil {
+		return err
+	}
+	if equality.Semantic.DeepEqual(withoutDefaults(roundTrip.Spec), spec) && equality.Semantic.DeepEqual(roundTrip.Status, src.Status) {
+		return nil
+	}
+
+	data, err := json.Marshal(v1beta1.MyAppResource{Spec: spec, Status: src.Status})
+	if err != nil {
+		return err
+	}
+	if dst.Annotations == nil {
+		dst.Annotations = map[string]string{}
+	}
+	dst.Annotations[ConversionDataAnnotation] = string(data)
+
+	return nil
+}
+
+// withoutDefaults returns a copy of the hub spec with the fields that hold the default of the v1beta1
+// schema, as set by its +kubebuilder:default markers, or of its defaulting webhook, cleared. The Redis image defaulted from the operator configuration
+// is kept, since the configured image may have changed by the time it is defaulted again.
+func withoutDefaults(spec v1beta1.MyAppResourceSpec) v1beta1.MyAppResourceSpec {
+	spec = *spec.DeepCopy()
+
+	if spec.Service.Type == corev1.ServiceTypeClusterIP {
+		spec.Service.Type = ""
+	}
+	if spec.Service.HTTPPort == v1beta1.DefaultServiceHTTPPort {
+		spec.Service.HTTPPort = 0
+	}
+	if spec.Service.MetricsPort == v1beta1.DefaultServiceMetricsPort {
+		spec.Service.MetricsPort = 0
+	}
+	if spec.DeletionPolicy == v1beta1.DeletionPolicyDelete {
+		spec.DeletionPolicy = ""
+	}
+	if spec.Autoscaling != nil && spec.Autoscaling.MinReplicas != nil && *spec.Autoscaling.MinReplicas == 1 {
+		spec.Autoscaling.MinReplicas = nil
+	}
+	if spec.Ingress != nil && spec.Ingress.Path == "/" {
+		spec.Ingress.Path = ""
+	}
+
+	redis := &spec.Redis
+	if redis.Mode == v1beta1.RedisModeStandalone {
+		redis.Mode = ""
+	}
+	if redis.External != nil && redis.External.Port == 6379 {
+		redis.External.Port = 0
+	}
+	if redis.Sentinel != nil {
+		if redis.Sentinel.Replicas == 3 {
+			redis.Sentinel.Replicas = 0
+		}
+		if redis.Sentinel.Quorum == 2 {
+			redis.Sentinel.Quorum = 0
+		}
+	}
+	if redis.Persistence != nil {
+		if redis.Persistence.Size != nil && redis.Persistence.Size.Cmp(resource.MustParse("1Gi")) == 0 {
+			redis.Persistence.Size = nil
+		}
+		if redis.Persistence.AccessMode == corev1.ReadWriteOnce {
+			redis.Persistence.AccessMode = ""
+		}
+	}
+
+	return spec
+}
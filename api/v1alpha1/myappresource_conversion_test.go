@@ -0,0 +1,150 @@
+package v1alpha1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/domenicbove/angi/api/v1beta1"
+)
+
+func TestConversion(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Conversion Suite")
+}
+
+var _ = Describe("MyAppResource conversion", func() {
+
+	var spoke *MyAppResource
+
+	BeforeEach(func() {
+		replicas := int32(2)
+		spoke = &MyAppResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "whatever",
+				Namespace:   "default",
+				Annotations: map[string]string{"some": "annotation"},
+			},
+			Spec: MyAppResourceSpec{
+				ReplicaCount: &replicas,
+				Resources: &corev1.ResourceRequirements{
+					Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi")},
+				},
+				Image: &Image{Repository: "ghcr.io/stefanprodan/podinfo", Tag: "6.3.4"},
+				UI:    UI{Color: "#34577c", Message: "some message"},
+				Redis: &Redis{Enabled: true},
+			},
+			Status: MyAppResourceStatus{
+				ObservedGeneration: 3,
+				Conditions: []metav1.Condition{
+					{Type: "Ready", Status: metav1.ConditionTrue, Reason: "Available"},
+				},
+				PodInfoReadyReplicas: 2,
+				RedisReadyReplicas:   1,
+			},
+		}
+	})
+
+	It("Should convert v1alpha1 to v1beta1", func() {
+		hub := &v1beta1.MyAppResource{}
+		Expect(spoke.ConvertTo(hub)).Should(Succeed())
+
+		Expect(hub.Name).Should(Equal("whatever"))
+		Expect(*hub.Spec.ReplicaCount).Should(Equal(int32(2)))
+		Expect(hub.Spec.Image).Should(Equal(v1beta1.Image{Repository: "ghcr.io/stefanprodan/podinfo", Tag: "6.3.4"}))
+		Expect(hub.Spec.UI.Color).Should(Equal("#34577c"))
+		Expect(hub.Spec.Redis.Enabled).Should(BeTrue())
+		Expect(hub.Status.RedisReadyReplicas).Should(Equal(int32(1)))
+		Expect(hub.Status.Conditions).Should(HaveLen(1))
+	})
+
+	It("Should round trip v1alpha1 through v1beta1", func() {
+		hub := &v1beta1.MyAppResource{}
+		Expect(spoke.ConvertTo(hub)).Should(Succeed())
+
+		restored := &MyAppResource{}
+		Expect(restored.ConvertFrom(hub)).Should(Succeed())
+
+		Expect(restored).Should(Equal(spoke))
+	})
+
+	It("Should round trip v1beta1 through v1alpha1", func() {
+		hub := &v1beta1.MyAppResource{}
+		Expect(spoke.ConvertTo(hub)).Should(Succeed())
+		hub.Spec.Redis.Enabled = false
+
+		converted := &MyAppResource{}
+		Expect(converted.ConvertFrom(hub)).Should(Succeed())
+		Expect(converted.Spec.Redis).Should(BeNil())
+
+		restored := &v1beta1.MyAppResource{}
+		Expect(converted.ConvertTo(restored)).Should(Succeed())
+
+		Expect(restored).Should(Equal(hub))
+	})
+
+	It("Should keep v1beta1 only fields through v1alpha1", func() {
+		hub := &v1beta1.MyAppResource{}
+		Expect(spoke.ConvertTo(hub)).Should(Succeed())
+		size := resource.MustParse("5Gi")
+		hub.Spec.Redis.Persistence = &v1beta1.RedisPersistence{
+			Size:       &size,
+			AccessMode: corev1.ReadWriteMany,
+		}
+
+		converted := &MyAppResource{}
+		Expect(converted.ConvertFrom(hub)).Should(Succeed())
+		Expect(converted.Annotations).Should(HaveKey(ConversionDataAnnotation))
+
+		restored := &v1beta1.MyAppResource{}
+		Expect(converted.ConvertTo(restored)).Should(Succeed())
+
+		Expect(restored.Spec.Redis.Persistence).Should(Equal(hub.Spec.Redis.Persistence))
+		Expect(restored.Annotations).ShouldNot(HaveKey(ConversionDataAnnotation))
+	})
+
+	It("Should only keep conversion data when v1alpha1 drops fields", func() {
+		hub := &v1beta1.MyAppResource{}
+		Expect(spoke.ConvertTo(hub)).Should(Succeed())
+
+		converted := &MyAppResource{}
+		Expect(converted.ConvertFrom(hub)).Should(Succeed())
+		Expect(converted.Annotations).ShouldNot(HaveKey(ConversionDataAnnotation))
+		Expect(hub.Annotations).ShouldNot(HaveKey(ConversionDataAnnotation))
+	})
+
+	It("Should not keep conversion data for defaulted fields", func() {
+		hub := &v1beta1.MyAppResource{}
+		Expect(spoke.ConvertTo(hub)).Should(Succeed())
+		hub.Default()
+		hub.Spec.DeletionPolicy = v1beta1.DeletionPolicyDelete
+		hub.Spec.Redis.Mode = v1beta1.RedisModeStandalone
+
+		converted := &MyAppResource{}
+		Expect(converted.ConvertFrom(hub)).Should(Succeed())
+		Expect(converted.Annotations).ShouldNot(HaveKey(ConversionDataAnnotation))
+	})
+
+	It("Should only keep the fields that differ from their defaults", func() {
+		hub := &v1beta1.MyAppResource{}
+		Expect(spoke.ConvertTo(hub)).Should(Succeed())
+		hub.Default()
+		size := resource.MustParse("5Gi")
+		hub.Spec.Redis.Persistence = &v1beta1.RedisPersistence{Size: &size, AccessMode: corev1.ReadWriteOnce}
+
+		converted := &MyAppResource{}
+		Expect(converted.ConvertFrom(hub)).Should(Succeed())
+		Expect(converted.Annotations).Should(HaveKey(ConversionDataAnnotation))
+
+		restored := &v1beta1.MyAppResource{}
+		Expect(converted.ConvertTo(restored)).Should(Succeed())
+		Expect(restored.Spec.Redis.Persistence.Size.String()).Should(Equal("5Gi"))
+		Expect(restored.Spec.Redis.Persistence.AccessMode).Should(BeEmpty(), "the API server defaults it again")
+		Expect(restored.Spec.Service).Should(Equal(v1beta1.Service{}), "the API server defaults it again")
+	})
+})
@@ -28,19 +28,17 @@ type MyAppResourceSpec struct {
 // Image describes the PodInfo Container image.
 type Image struct {
 	// +optional
-	// +kubebuilder:default=ghcr.io/stefanprodan/podinfo
-	// Repository sets the PodInfo Container image repository.
+	// Repository sets the PodInfo Container image repository, the operator default when unset.
 	Repository string `json:"repository,omitempty"`
 
 	// +optional
-	// +kubebuilder:default=latest
-	// Tag sets the PodInfo Container image tag.
+	// Tag sets the PodInfo Container image tag, the operator default when unset.
 	Tag string `json:"tag,omitempty"`
 }
 
 // UI describes the PodInfo Container UI settings.
 type UI struct {
-	// +kubebuilder:validation:Pattern=`^#[A-Fa-f0-9]{6}`
+	// +kubebuilder:validation:Pattern=`^#[A-Fa-f0-9]{6}$`
 	// Repository sets the PodInfo UI color.
 	Color string `json:"color"`
 
@@ -56,6 +54,18 @@ type Redis struct {
 
 // MyAppResourceStatus defines the observed state of MyAppResource
 type MyAppResourceStatus struct {
+	// +optional
+	// ObservedGeneration is the most recent MyAppResource generation observed by the controller.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// +optional
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	// Conditions represent the latest available observations of the MyAppResource state.
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+
 	// +optional
 	// PodInfoReadyReplicas is the number of pods targeted by the PodInfo Deployment with a Ready Condition.
 	PodInfoReadyReplicas int32 `json:"podInfoReadyReplicas,omitempty"`
@@ -66,6 +76,8 @@ type MyAppResourceStatus struct {
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // MyAppResource is the Schema for the myappresources API
 type MyAppResource struct {
@@ -0,0 +1,5 @@
+package v1beta1
+
+// Hub marks v1beta1 as the conversion hub. All other MyAppResource versions
+// convert to and from this version.
+func (*MyAppResource) Hub() {}
@@ -0,0 +1,598 @@
+package v1beta1
+
+import (
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// MyAppResourceSpec defines the desired state of MyAppResource
+type MyAppResourceSpec struct {
+	// +optional
+	// +kubebuilder:default=1
+	// +kubebuilder:validation:Minimum=0
+	// ReplicaCount sets the pod replicas for the PodInfo Deployment.
+	ReplicaCount *int32 `json:"replicaCount,omitempty"`
+
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// +optional
+	// Probes overrides the default probes of the PodInfo Container, which check /healthz and /readyz.
+	Probes *Probes `json:"probes,omitempty"`
+
+	// +optional
+	// PodSecurityContext replaces the default security context of the PodInfo pods, which runs them
+	// as a non-root user with the RuntimeDefault seccomp profile, as the restricted Pod Security Standard requires.
+	PodSecurityContext *corev1.PodSecurityContext `json:"podSecurityContext,omitempty"`
+
+	// +optional
+	// SecurityContext replaces the default security context of the PodInfo Container, which drops
+	// all capabilities, forbids privilege escalation and mounts the root filesystem read-only.
+	SecurityContext *corev1.SecurityContext `json:"securityContext,omitempty"`
+
+	// +optional
+	// +kubebuilder:default={}
+	Image Image `json:"image"`
+
+	UI UI `json:"ui"`
+
+	// +optional
+	// +kubebuilder:default={}
+	Service Service `json:"service"`
+
+	// +optional
+	// Autoscaling scales the PodInfo Deployment with a HorizontalPodAutoscaler. While it is set,
+	// replicaCount is ignored and the operator leaves the Deployment replicas to the autoscaler.
+	Autoscaling *Autoscaling `json:"autoscaling,omitempty"`
+
+	// +optional
+	// Ingress exposes the PodInfo Service through an Ingress. The Ingress is removed when unset.
+	Ingress *Ingress `json:"ingress,omitempty"`
+
+	// +optional
+	// Rollout sets how PodInfo image changes are rolled out. When unset, the Deployment rolls
+	// every replica with its default rolling update strategy.
+	Rollout *Rollout `json:"rollout,omitempty"`
+
+	// +optional
+	// DisruptionBudget sets the PodDisruptionBudget of the PodInfo pods. When unset, a budget of
+	// maxUnavailable 1 is used as soon as PodInfo can run more than one replica.
+	DisruptionBudget *DisruptionBudget `json:"disruptionBudget,omitempty"`
+
+	// +optional
+	Redis Redis `json:"redis,omitempty"`
+
+	// +optional
+	// +kubebuilder:default=Delete
+	// DeletionPolicy decides what happens to the child objects when the MyAppResource is deleted.
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=Delete;Orphan;Snapshot
+// DeletionPolicy is what happens to the child objects of a deleted MyAppResource.
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete deletes the child objects along with the MyAppResource.
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	// DeletionPolicyOrphan removes the ownerReferences from the child objects, which keep running.
+	DeletionPolicyOrphan DeletionPolicy = "Orphan"
+	// DeletionPolicySnapshot dumps the Redis data to a PersistentVolumeClaim that is kept,
+	// then deletes the child objects.
+	DeletionPolicySnapshot DeletionPolicy = "Snapshot"
+)
+
+// Image describes the PodInfo Container image.
+type Image struct {
+	// +optional
+	// Repository sets the PodInfo Container image repository, the operator default when unset.
+	Repository string `json:"repository,omitempty"`
+
+	// +optional
+	// Tag sets the PodInfo Container image tag, the operator default when unset.
+	Tag string `json:"tag,omitempty"`
+}
+
+// UI describes the PodInfo Container UI settings.
+type UI struct {
+	// +kubebuilder:validation:Pattern=`^#[A-Fa-f0-9]{6}$`
+	// Color sets the PodInfo UI color.
+	Color string `json:"color"`
+
+	// Message sets the PodInfo UI message.
+	Message string `json:"message"`
+}
+
+// Service describes the PodInfo Service, which exposes the http and metrics ports.
+type Service struct {
+	// +optional
+	// +kubebuilder:default=ClusterIP
+	// +kubebuilder:validation:Enum=ClusterIP;NodePort;LoadBalancer
+	// Type sets the PodInfo Service type.
+	Type corev1.ServiceType `json:"type,omitempty"`
+
+	// +optional
+	// +kubebuilder:default=9898
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// HTTPPort sets the Service port of the PodInfo http port.
+	HTTPPort int32 `json:"httpPort,omitempty"`
+
+	// +optional
+	// +kubebuilder:default=9797
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// MetricsPort sets the Service port of the PodInfo metrics port.
+	MetricsPort int32 `json:"metricsPort,omitempty"`
+
+	// +optional
+	// Annotations are added to the PodInfo Service, for example to configure a cloud load balancer.
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// +optional
+	// +kubebuilder:validation:Enum=None;ClientIP
+	// SessionAffinity sets the PodInfo Service session affinity.
+	SessionAffinity corev1.ServiceAffinity `json:"sessionAffinity,omitempty"`
+}
+
+// Autoscaling describes the PodInfo HorizontalPodAutoscaler.
+type Autoscaling struct {
+	// +optional
+	// +kubebuilder:default=1
+	// +kubebuilder:validation:Minimum=1
+	// MinReplicas is the lower limit for the number of PodInfo replicas.
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+
+	// +kubebuilder:validation:Minimum=1
+	// MaxReplicas is the upper limit for the number of PodInfo replicas.
+	MaxReplicas int32 `json:"maxReplicas"`
+
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// TargetCPUUtilizationPercentage is the target average CPU utilization, relative to the
+	// CPU request. Defaults to 80 when no memory target is set either.
+	TargetCPUUtilizationPercentage *int32 `json:"targetCPUUtilizationPercentage,omitempty"`
+
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// TargetMemoryUtilizationPercentage is the target average memory utilization, relative to the memory request.
+	TargetMemoryUtilizationPercentage *int32 `json:"targetMemoryUtilizationPercentage,omitempty"`
+
+	// +optional
+	// Behavior configures the scaling behavior in the up and down directions.
+	Behavior *autoscalingv2.HorizontalPodAutoscalerBehavior `json:"behavior,omitempty"`
+}
+
+// Ingress describes the PodInfo Ingress.
+type Ingress struct {
+	// +kubebuilder:validation:MinItems=1
+	// Hosts are the host names routed to PodInfo.
+	Hosts []string `json:"hosts"`
+
+	// +optional
+	// +kubebuilder:default="/"
+	// +kubebuilder:validation:Pattern=`^/`
+	// Path is the path prefix routed to PodInfo.
+	Path string `json:"path,omitempty"`
+
+	// +optional
+	// IngressClassName selects the IngressClass. The cluster default class is used when unset.
+	IngressClassName *string `json:"ingressClassName,omitempty"`
+
+	// +optional
+	// Annotations are added to the Ingress, for example to configure the ingress controller.
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// +optional
+	// TLSSecretName is the name of a Secret holding the TLS certificate for the hosts.
+	// TLS is not terminated when unset.
+	TLSSecretName string `json:"tlsSecretName,omitempty"`
+}
+
+// Rollout describes how PodInfo image changes are rolled out.
+type Rollout struct {
+	// +optional
+	// Canary rolls a new image out to a canary Deployment behind the PodInfo Service first,
+	// moving replicas from the stable Deployment to it step by step.
+	Canary *CanaryRollout `json:"canary,omitempty"`
+}
+
+// CanaryRollout describes the steps of a canary rollout.
+type CanaryRollout struct {
+	// +kubebuilder:validation:MinItems=1
+	// Steps are taken in order, once the last step completes the new image is promoted to the
+	// stable Deployment and the canary Deployment is removed.
+	Steps []CanaryStep `json:"steps"`
+}
+
+// CanaryStep is a share of the PodInfo replicas running the new image, kept for a while.
+type CanaryStep struct {
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	// Weight is the percentage of the PodInfo replicas running the new image, rounded up.
+	Weight int32 `json:"weight"`
+
+	// +optional
+	// Pause is how long the step lasts once its canary replicas are available. When unset,
+	// the step lasts until it is promoted with the CanaryAnnotation.
+	Pause *metav1.Duration `json:"pause,omitempty"`
+}
+
+// CanaryAnnotation controls a canary rollout in progress, it is removed once carried out. The value
+// CanaryActionPromote ends the current step, and CanaryActionAbort goes back to the stable image.
+const CanaryAnnotation = "my.api.group/canary"
+
+const (
+	CanaryActionPromote = "promote"
+	CanaryActionAbort   = "abort"
+)
+
+// +kubebuilder:validation:Enum=Progressing;Paused;Promoting;Aborted
+// CanaryPhase is the state of a canary rollout.
+type CanaryPhase string
+
+const (
+	// CanaryPhaseProgressing is waiting for the canary replicas of the step to be available,
+	// or for the pause of the step to pass.
+	CanaryPhaseProgressing CanaryPhase = "Progressing"
+	// CanaryPhasePaused is waiting for the step to be promoted.
+	CanaryPhasePaused CanaryPhase = "Paused"
+	// CanaryPhasePromoting is rolling the new image out to the stable Deployment.
+	CanaryPhasePromoting CanaryPhase = "Promoting"
+	// CanaryPhaseAborted runs the stable image only, until the image is changed again.
+	CanaryPhaseAborted CanaryPhase = "Aborted"
+)
+
+// CanaryStatus is the state of a canary rollout.
+type CanaryStatus struct {
+	Phase CanaryPhase `json:"phase"`
+
+	// StableImage is the image of the stable Deployment when the rollout started.
+	StableImage string `json:"stableImage"`
+
+	// CanaryImage is the image rolled out.
+	CanaryImage string `json:"canaryImage"`
+
+	// Step is the index of the current step in spec.rollout.canary.steps.
+	Step int32 `json:"step"`
+
+	// +optional
+	// Weight is the percentage of the PodInfo replicas running the canary image.
+	Weight int32 `json:"weight,omitempty"`
+
+	// +optional
+	// StepStartTime is when the canary replicas of the current step became available.
+	StepStartTime *metav1.Time `json:"stepStartTime,omitempty"`
+
+	// +optional
+	// Message is a human readable reason for the phase, for example why the rollout was aborted.
+	Message string `json:"message,omitempty"`
+}
+
+// DisruptionBudget describes a PodDisruptionBudget, exactly one of minAvailable and maxUnavailable must be set.
+type DisruptionBudget struct {
+	// +optional
+	// +kubebuilder:validation:XIntOrString
+	// MinAvailable is the number or percentage of pods that must stay available during a voluntary disruption.
+	MinAvailable *intstr.IntOrString `json:"minAvailable,omitempty"`
+
+	// +optional
+	// +kubebuilder:validation:XIntOrString
+	// MaxUnavailable is the number or percentage of pods that may be unavailable during a voluntary disruption.
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// Redis describes the Redis workload.
+type Redis struct {
+	// +optional
+	// Enabled specifies to deploy a backing redis deployment.
+	Enabled bool `json:"enabled,omitempty"`
+
+	// +optional
+	// CacheRef selects a RedisCache in the MyAppResource namespace that PodInfo uses instead of
+	// a Redis of its own, it can not be set along with enabled. The other Redis settings only
+	// apply to a Redis of its own. The consumers of a RedisCache share its password, so they can
+	// reach each other's databases.
+	CacheRef *corev1.LocalObjectReference `json:"cacheRef,omitempty"`
+
+	// +optional
+	// External selects a Redis managed outside of the operator that PodInfo uses instead of a Redis
+	// of its own, it can not be set along with enabled or cacheRef. The other Redis settings only
+	// apply to a Redis of its own.
+	External *RedisExternal `json:"external,omitempty"`
+
+	// +optional
+	// +kubebuilder:default={}
+	Image RedisImage `json:"image"`
+
+	// +optional
+	// Resources sets the compute resources of the Redis Container.
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// +optional
+	// Probes overrides the default probes of the Redis Container, which check the Redis port
+	// is open and Redis answers PING.
+	Probes *Probes `json:"probes,omitempty"`
+
+	// +optional
+	// PodSecurityContext replaces the default security context of the Redis, Sentinel and snapshot
+	// pods, which runs them as a non-root user with the RuntimeDefault seccomp profile.
+	PodSecurityContext *corev1.PodSecurityContext `json:"podSecurityContext,omitempty"`
+
+	// +optional
+	// SecurityContext replaces the default security context of the Redis, Sentinel and snapshot
+	// Containers, which drops all capabilities, forbids privilege escalation and mounts the root
+	// filesystem read-only.
+	SecurityContext *corev1.SecurityContext `json:"securityContext,omitempty"`
+
+	// +optional
+	// ExtraArgs are appended to the redis-server arguments, for example ["--maxmemory", "100mb"].
+	ExtraArgs []string `json:"extraArgs,omitempty"`
+
+	// +optional
+	// +kubebuilder:default=standalone
+	// Mode sets the Redis topology. In replication and sentinel mode Redis runs as a StatefulSet
+	// with a primary and read replicas, and the Redis Service always targets the current primary.
+	Mode RedisMode `json:"mode,omitempty"`
+
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// Replicas sets the number of read replicas in replication and sentinel mode. Defaults to 2.
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// +optional
+	// Sentinel configures the Sentinel quorum in sentinel mode.
+	Sentinel *RedisSentinel `json:"sentinel,omitempty"`
+
+	// +optional
+	// DisruptionBudget sets the PodDisruptionBudget of the Redis pods. When unset, a budget of
+	// maxUnavailable 1 is used in replication and sentinel mode.
+	DisruptionBudget *DisruptionBudget `json:"disruptionBudget,omitempty"`
+
+	// +optional
+	// Persistence stores the Redis data on a PersistentVolumeClaim. When set, Redis runs
+	// as a StatefulSet with a volumeClaimTemplate instead of a Deployment.
+	Persistence *RedisPersistence `json:"persistence,omitempty"`
+
+	// +optional
+	// Auth configures the password Redis requires from its clients.
+	Auth *RedisAuth `json:"auth,omitempty"`
+}
+
+// Probes describes the probes of a Container. A probe that is not set keeps the operator default,
+// there is no default startup probe.
+type Probes struct {
+	// +optional
+	// Liveness restarts the Container when it fails.
+	Liveness *corev1.Probe `json:"liveness,omitempty"`
+
+	// +optional
+	// Readiness takes the pod out of its Services while it fails.
+	Readiness *corev1.Probe `json:"readiness,omitempty"`
+
+	// +optional
+	// Startup holds the other probes back until it succeeds, for a Container that is slow to start.
+	Startup *corev1.Probe `json:"startup,omitempty"`
+}
+
+// RedisExternal describes a Redis managed outside of the operator, for example a managed Redis of a cloud provider.
+type RedisExternal struct {
+	// +kubebuilder:validation:MinLength=1
+	// Host is the DNS name or IP address of Redis.
+	Host string `json:"host"`
+
+	// +optional
+	// +kubebuilder:default=6379
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// Port is the port of Redis.
+	Port int32 `json:"port,omitempty"`
+
+	// +optional
+	// TLS connects to Redis over TLS.
+	TLS bool `json:"tls,omitempty"`
+
+	// +optional
+	// CredentialsSecretRef selects the key of a Secret in the MyAppResource namespace that holds
+	// the Redis password. PodInfo connects without a password when unset.
+	CredentialsSecretRef *corev1.SecretKeySelector `json:"credentialsSecretRef,omitempty"`
+}
+
+// RedisAuth describes the Redis password. Redis always requires a password, by default
+// the operator generates one into a Secret owned by the MyAppResource.
+type RedisAuth struct {
+	// +optional
+	// ExistingSecretRef selects the key of a Secret in the MyAppResource namespace that holds
+	// the Redis password, instead of a generated one. The Secret is not managed by the operator.
+	// The password may hold any characters, PodInfo gets it percent-encoded in its cache server URL.
+	ExistingSecretRef *corev1.SecretKeySelector `json:"existingSecretRef,omitempty"`
+}
+
+// RedisImage describes the Redis Container image, which is also used for Sentinel.
+type RedisImage struct {
+	// +optional
+	// Repository sets the Redis Container image repository, the operator default when unset.
+	Repository string `json:"repository,omitempty"`
+
+	// +optional
+	// Tag sets the Redis Container image tag, the operator default when unset.
+	Tag string `json:"tag,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=standalone;replication;sentinel
+// RedisMode is the Redis topology.
+type RedisMode string
+
+const (
+	// RedisModeStandalone runs a single Redis pod.
+	RedisModeStandalone RedisMode = "standalone"
+	// RedisModeReplication runs a fixed primary with read replicas.
+	RedisModeReplication RedisMode = "replication"
+	// RedisModeSentinel runs a primary with read replicas, and a Sentinel quorum that
+	// promotes a replica when the primary fails.
+	RedisModeSentinel RedisMode = "sentinel"
+)
+
+// RedisSentinel describes the Sentinel quorum.
+type RedisSentinel struct {
+	// +optional
+	// +kubebuilder:default=3
+	// +kubebuilder:validation:Minimum=1
+	// Replicas sets the number of Sentinel pods.
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// +optional
+	// +kubebuilder:default=2
+	// +kubebuilder:validation:Minimum=1
+	// Quorum sets the number of Sentinels that must agree the primary is down to start a failover.
+	Quorum int32 `json:"quorum,omitempty"`
+}
+
+// RedisPersistence describes the PersistentVolumeClaim backing Redis.
+type RedisPersistence struct {
+	// +optional
+	// StorageClassName sets the StorageClass of the claim. The cluster default is used when unset.
+	StorageClassName *string `json:"storageClassName,omitempty"`
+
+	// +optional
+	// +kubebuilder:default="1Gi"
+	// Size sets the requested storage of the claim. Changes only apply to new claims.
+	Size *resource.Quantity `json:"size,omitempty"`
+
+	// +optional
+	// +kubebuilder:default=ReadWriteOnce
+	// +kubebuilder:validation:Enum=ReadWriteOnce;ReadWriteOncePod;ReadWriteMany
+	// AccessMode sets the access mode of the claim.
+	AccessMode corev1.PersistentVolumeAccessMode `json:"accessMode,omitempty"`
+}
+
+// PausedAnnotation set to "true" stops the operator from changing the child objects of a MyAppResource,
+// so they can be patched by hand. The status is still refreshed, and the child objects are brought
+// back to the desired state once the annotation is removed.
+const PausedAnnotation = "my.api.group/paused"
+
+// Condition types reported in MyAppResourceStatus.Conditions.
+const (
+	// ConditionTypeReady is True when PodInfo, and Redis if enabled, are fully rolled out and available.
+	ConditionTypeReady = "Ready"
+	// ConditionTypeProgressing is True while a child Deployment is rolling out.
+	ConditionTypeProgressing = "Progressing"
+	// ConditionTypeDegraded is True when a child Deployment rollout has stalled or failed.
+	ConditionTypeDegraded = "Degraded"
+	// ConditionTypeRedisReady is True when the Redis Deployment is fully rolled out and available, or
+	// the RedisCache selected by cacheRef is ready and serves the MyAppResource. An external Redis is
+	// not checked by the operator and always reports True. It is only reported while PodInfo uses a Redis.
+	ConditionTypeRedisReady = "RedisReady"
+	// ConditionTypeRedisStorageBound is True when the Redis PersistentVolumeClaim is bound.
+	// It is only reported while Redis persistence is enabled.
+	ConditionTypeRedisStorageBound = "RedisStorageBound"
+	// ConditionTypePaused is True while the PausedAnnotation is set.
+	// It is only reported while the MyAppResource is paused.
+	ConditionTypePaused = "Paused"
+	// ConditionTypePolicyViolation is True while an image of the MyAppResource is not allowed by the
+	// image policy of the operator. It is only reported while there is a violation.
+	ConditionTypePolicyViolation = "PolicyViolation"
+)
+
+// Condition reasons reported in MyAppResourceStatus.Conditions.
+const (
+	ReasonAvailable                = "Available"
+	ReasonDeploymentPending        = "DeploymentPending"
+	ReasonRollingOut               = "RollingOut"
+	ReasonRolloutComplete          = "RolloutComplete"
+	ReasonProgressDeadlineExceeded = "ProgressDeadlineExceeded"
+	ReasonReplicaFailure           = "ReplicaFailure"
+	ReasonAsExpected               = "AsExpected"
+	ReasonPodInfoNotReady          = "PodInfoNotReady"
+	ReasonRedisNotReady            = "RedisNotReady"
+	ReasonClaimBound               = "ClaimBound"
+	ReasonClaimPending             = "ClaimPending"
+	ReasonClaimLost                = "ClaimLost"
+	ReasonPausedByAnnotation       = "PausedByAnnotation"
+	ReasonCanaryRollout            = "CanaryRollout"
+	ReasonImageNotAllowed          = "ImageNotAllowed"
+	ReasonRedisCacheNotFound       = "RedisCacheNotFound"
+	ReasonRedisCacheFull           = "RedisCacheFull"
+	ReasonExternalRedis            = "ExternalRedis"
+)
+
+// +kubebuilder:validation:Enum=Managed;RedisCache;External
+// RedisSource is where the Redis PodInfo uses comes from.
+type RedisSource string
+
+const (
+	// RedisSourceManaged is a Redis of the MyAppResource, deployed by the operator.
+	RedisSourceManaged RedisSource = "Managed"
+	// RedisSourceRedisCache is the RedisCache selected by cacheRef.
+	RedisSourceRedisCache RedisSource = "RedisCache"
+	// RedisSourceExternal is a Redis managed outside of the operator.
+	RedisSourceExternal RedisSource = "External"
+)
+
+// MyAppResourceStatus defines the observed state of MyAppResource
+type MyAppResourceStatus struct {
+	// +optional
+	// ObservedGeneration is the most recent MyAppResource generation observed by the controller.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// +optional
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	// Conditions represent the latest available observations of the MyAppResource state.
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+
+	// +optional
+	// PodInfoReadyReplicas is the number of pods targeted by the PodInfo Deployment with a Ready Condition.
+	PodInfoReadyReplicas int32 `json:"podInfoReadyReplicas,omitempty"`
+	// +optional
+	// RedisSource is where the Redis PodInfo uses comes from, unset when PodInfo uses no Redis.
+	RedisSource RedisSource `json:"redisSource,omitempty"`
+	// +optional
+	// RedisReadyReplicas is the number of pods targeted by the Redis Deployment with a Ready Condition.
+	RedisReadyReplicas int32 `json:"redisReadyReplicas,omitempty"`
+	// +optional
+	// RedisPrimary is the name of the pod currently serving as the Redis primary,
+	// in replication and sentinel mode.
+	RedisPrimary string `json:"redisPrimary,omitempty"`
+	// +optional
+	// RedisReplicasInSync is the number of read replicas connected to the primary
+	// and in sync with it, in replication and sentinel mode.
+	RedisReplicasInSync int32 `json:"redisReplicasInSync,omitempty"`
+	// +optional
+	// Canary is the state of the canary rollout in progress, or of the last one when it was aborted.
+	Canary *CanaryStatus `json:"canary,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+//+kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status"
+//+kubebuilder:printcolumn:name="Redis",type="string",JSONPath=".status.redisSource"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// MyAppResource is the Schema for the myappresources API
+type MyAppResource struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MyAppResourceSpec   `json:"spec,omitempty"`
+	Status MyAppResourceStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// MyAppResourceList contains a list of MyAppResource
+type MyAppResourceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MyAppResource `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MyAppResource{}, &MyAppResourceList{})
+}
@@ -0,0 +1,378 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// DefaultServiceHTTPPort is the PodInfo Service http port used when none is set.
+	DefaultServiceHTTPPort = 9898
+	// DefaultServiceMetricsPort is the PodInfo Service metrics port used when none is set.
+	DefaultServiceMetricsPort = 9797
+
+	validatePath = "/validate-my-api-group-v1beta1-myappresource"
+)
+
+var (
+	myappresourcelog = logf.Log.WithName("myappresource-resource")
+
+	colorRegexp = regexp.MustCompile(`^#[A-Fa-f0-9]{6}$`)
+	// tagRegexp matches a valid OCI image tag.
+	tagRegexp = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+)
+
+// SetupWebhookWithManager registers the defaulting, validating and conversion webhooks for MyAppResource.
+// The defaulting webhook fills in image and redisImage, the defaults of the operator configuration, for
+// the images that are not set. Validation is served by a dedicated handler so that it can return admission warnings.
+func (r *MyAppResource) SetupWebhookWithManager(mgr ctrl.Manager, image Image, redisImage RedisImage) error {
+	if err := ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		WithDefaulter(&myAppResourceDefaulter{image: image, redisImage: redisImage}).
+		Complete(); err != nil {
+		return err
+	}
+
+	decoder, err := admission.NewDecoder(mgr.GetScheme())
+	if err != nil {
+		return err
+	}
+	mgr.GetWebhookServer().Register(validatePath, &webhook.Admission{
+		Handler: &myAppResourceValidator{decoder: decoder},
+	})
+
+	return nil
+}
+
+//+kubebuilder:webhook:path=/mutate-my-api-group-v1beta1-myappresource,mutating=true,failurePolicy=fail,sideEffects=None,groups=my.api.group,resources=myappresources,verbs=create;update,versions=v1beta1,name=mmyappresource.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Defaulter = &MyAppResource{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (r *MyAppResource) Default() {
+	myappresourcelog.Info("default", "name", r.Name)
+
+	if r.Spec.ReplicaCount == nil {
+		replicas := int32(1)
+		r.Spec.ReplicaCount = &replicas
+	}
+
+	if r.Spec.Service.Type == "" {
+		r.Spec.Service.Type = corev1.ServiceTypeClusterIP
+	}
+	if r.Spec.Service.HTTPPort == 0 {
+		r.Spec.Service.HTTPPort = DefaultServiceHTTPPort
+	}
+	if r.Spec.Service.MetricsPort == 0 {
+		r.Spec.Service.MetricsPort = DefaultServiceMetricsPort
+	}
+}
+
+// myAppResourceDefaulter fills in the defaults of a MyAppResource, along with the images of the operator configuration.
+type myAppResourceDefaulter struct {
+	image      Image
+	redisImage RedisImage
+}
+
+// Default implements webhook.CustomDefaulter.
+func (d *myAppResourceDefaulter) Default(_ context.Context, obj runtime.Object) error {
+	r, ok := obj.(*MyAppResource)
+	if !ok {
+		return fmt.Errorf("expected a MyAppResource but got a %T", obj)
+	}
+
+	r.Default()
+	r.DefaultImages(d.image, d.redisImage)
+	return nil
+}
+
+// DefaultImages fills in the repository and tag of the images that are not set, the Redis image only while
+// Redis is enabled. The effective images are then recorded in the spec, and do not change along with the
+// operator configuration.
+func (r *MyAppResource) DefaultImages(image Image, redisImage RedisImage) {
+	if r.Spec.Image.Repository == "" {
+		r.Spec.Image.Repository = image.Repository
+	}
+	if r.Spec.Image.Tag == "" {
+		r.Spec.Image.Tag = image.Tag
+	}
+
+	if r.Spec.Redis.Enabled {
+		if r.Spec.Redis.Image.Repository == "" {
+			r.Spec.Redis.Image.Repository = redisImage.Repository
+		}
+		if r.Spec.Redis.Image.Tag == "" {
+			r.Spec.Redis.Image.Tag = redisImage.Tag
+		}
+	}
+}
+
+//+kubebuilder:webhook:path=/validate-my-api-group-v1beta1-myappresource,mutating=false,failurePolicy=fail,sideEffects=None,groups=my.api.group,resources=myappresources,verbs=create;update,versions=v1beta1,name=vmyappresource.kb.io,admissionReviewVersions=v1
+
+// myAppResourceValidator validates MyAppResource creates and updates.
+type myAppResourceValidator struct {
+	decoder *admission.Decoder
+}
+
+// Handle implements admission.Handler.
+func (v *myAppResourceValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1.Create && req.Operation != admissionv1.Update {
+		return admission.Allowed("")
+	}
+
+	myAppResource := &MyAppResource{}
+	if err := v.decoder.Decode(req, myAppResource); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	myappresourcelog.Info("validate", "name", myAppResource.Name, "operation", req.Operation)
+
+	warnings, err := myAppResource.validate()
+	if err != nil {
+		var apiStatus apierrors.APIStatus
+		if errors.As(err, &apiStatus) {
+			status := apiStatus.Status()
+			return admission.Response{
+				AdmissionResponse: admissionv1.AdmissionResponse{Allowed: false, Result: &status},
+			}.WithWarnings(warnings...)
+		}
+		return admission.Denied(err.Error()).WithWarnings(warnings...)
+	}
+
+	return admission.Allowed("").WithWarnings(warnings...)
+}
+
+// validate checks the MyAppResource spec. It returns an Invalid error for values
+// that can never work and warnings for values that are allowed but risky.
+func (r *MyAppResource) validate() ([]string, error) {
+	var allErrs field.ErrorList
+	var warnings []string
+	specPath := field.NewPath("spec")
+
+	if !colorRegexp.MatchString(r.Spec.UI.Color) {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("ui", "color"), r.Spec.UI.Color,
+			"must be a hex color of the form #RRGGBB"))
+	}
+
+	imagePath := specPath.Child("image")
+	allErrs = append(allErrs, ValidateImage(imagePath, r.Spec.Image.Repository, r.Spec.Image.Tag)...)
+	if r.Spec.Image.Tag == "latest" {
+		warnings = append(warnings, fmt.Sprintf("%s: the mutable \"latest\" tag makes rollouts unpredictable, pin a version instead",
+			imagePath.Child("tag")))
+	}
+
+	allErrs = append(allErrs, ValidateResources(specPath.Child("resources"), r.Spec.Resources)...)
+	allErrs = append(allErrs, validateProbes(specPath.Child("probes"), r.Spec.Probes)...)
+
+	if r.Spec.Service.HTTPPort != 0 && r.Spec.Service.HTTPPort == r.Spec.Service.MetricsPort {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("service", "metricsPort"), r.Spec.Service.MetricsPort,
+			"must be different from spec.service.httpPort"))
+	}
+
+	if r.Spec.ReplicaCount != nil && *r.Spec.ReplicaCount == 0 && r.Spec.Autoscaling == nil {
+		warning := fmt.Sprintf("%s: 0 replicas means PodInfo will not run", specPath.Child("replicaCount"))
+		if r.Spec.Redis.Enabled {
+			warning += ", but Redis will still be deployed"
+		}
+		warnings = append(warnings, warning)
+	}
+
+	if autoscaling := r.Spec.Autoscaling; autoscaling != nil && autoscaling.MinReplicas != nil &&
+		*autoscaling.MinReplicas > autoscaling.MaxReplicas {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("autoscaling", "maxReplicas"), autoscaling.MaxReplicas,
+			fmt.Sprintf("must be greater than or equal to minReplicas of %d", *autoscaling.MinReplicas)))
+	}
+
+	if r.Spec.Ingress != nil {
+		hostsPath := specPath.Child("ingress", "hosts")
+		for i, host := range r.Spec.Ingress.Hosts {
+			var errs []string
+			if strings.HasPrefix(host, "*.") {
+				errs = validation.IsWildcardDNS1123Subdomain(host)
+			} else {
+				errs = validation.IsDNS1123Subdomain(host)
+			}
+			for _, msg := range errs {
+				allErrs = append(allErrs, field.Invalid(hostsPath.Index(i), host, msg))
+			}
+		}
+	}
+
+	budgetPath := specPath.Child("disruptionBudget")
+	allErrs = append(allErrs, validateDisruptionBudget(budgetPath, r.Spec.DisruptionBudget)...)
+	if budget := r.Spec.DisruptionBudget; budget != nil && budget.MinAvailable != nil && budget.MinAvailable.Type == intstr.Int &&
+		r.Spec.Autoscaling == nil && r.Spec.ReplicaCount != nil && budget.MinAvailable.IntVal >= *r.Spec.ReplicaCount {
+		warnings = append(warnings, fmt.Sprintf("%s: keeping all %d replicas available blocks node drains",
+			budgetPath.Child("minAvailable"), *r.Spec.ReplicaCount))
+	}
+
+	redisPath := specPath.Child("redis")
+	if r.Spec.Redis.CacheRef != nil && r.Spec.Redis.Enabled {
+		allErrs = append(allErrs, field.Invalid(redisPath.Child("cacheRef"), r.Spec.Redis.CacheRef.Name,
+			fmt.Sprintf("must not be set along with %s, a RedisCache replaces the Redis of the MyAppResource", redisPath.Child("enabled"))))
+	}
+	if external := r.Spec.Redis.External; external != nil {
+		switch {
+		case r.Spec.Redis.Enabled:
+			allErrs = append(allErrs, field.Invalid(redisPath.Child("external"), external.Host,
+				fmt.Sprintf("must not be set along with %s, an external Redis replaces the Redis of the MyAppResource", redisPath.Child("enabled"))))
+		case r.Spec.Redis.CacheRef != nil:
+			allErrs = append(allErrs, field.Invalid(redisPath.Child("external"), external.Host,
+				fmt.Sprintf("must not be set along with %s", redisPath.Child("cacheRef"))))
+		}
+	}
+	allErrs = append(allErrs, ValidateImage(redisPath.Child("image"), r.Spec.Redis.Image.Repository, r.Spec.Redis.Image.Tag)...)
+	allErrs = append(allErrs, ValidateResources(redisPath.Child("resources"), r.Spec.Redis.Resources)...)
+	allErrs = append(allErrs, validateProbes(redisPath.Child("probes"), r.Spec.Redis.Probes)...)
+	if sentinel := r.Spec.Redis.Sentinel; sentinel != nil {
+		if r.Spec.Redis.Mode != RedisModeSentinel {
+			warnings = append(warnings, fmt.Sprintf("%s: only used in sentinel mode", redisPath.Child("sentinel")))
+		} else if sentinel.Replicas > 0 && sentinel.Quorum > sentinel.Replicas {
+			allErrs = append(allErrs, field.Invalid(redisPath.Child("sentinel", "quorum"), sentinel.Quorum,
+				fmt.Sprintf("must be less than or equal to the %d sentinel replicas", sentinel.Replicas)))
+		}
+	}
+	if r.Spec.Redis.Replicas != nil && (r.Spec.Redis.Mode == "" || r.Spec.Redis.Mode == RedisModeStandalone) {
+		warnings = append(warnings, fmt.Sprintf("%s: only used in replication and sentinel mode", redisPath.Child("replicas")))
+	}
+	allErrs = append(allErrs, validateDisruptionBudget(redisPath.Child("disruptionBudget"), r.Spec.Redis.DisruptionBudget)...)
+
+	if len(allErrs) == 0 {
+		return warnings, nil
+	}
+
+	return warnings, apierrors.NewInvalid(GroupVersion.WithKind("MyAppResource").GroupKind(), r.Name, allErrs)
+}
+
+// validateImage checks an image repository and tag are set in their own fields.
+func ValidateImage(imagePath *field.Path, repository, tag string) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if strings.Contains(repository, "@") || strings.Contains(lastPathElement(repository), ":") {
+		allErrs = append(allErrs, field.Invalid(imagePath.Child("repository"), repository,
+			fmt.Sprintf("must not include a tag or digest, set %s instead", imagePath.Child("tag"))))
+	}
+	if tag != "" && !tagRegexp.MatchString(tag) {
+		allErrs = append(allErrs, field.Invalid(imagePath.Child("tag"), tag,
+			"must be a valid image tag"))
+	}
+
+	return allErrs
+}
+
+// validateResources checks no resource request is above its limit.
+func ValidateResources(resourcesPath *field.Path, resources *corev1.ResourceRequirements) field.ErrorList {
+	var allErrs field.ErrorList
+	if resources == nil {
+		return allErrs
+	}
+
+	for name, request := range resources.Requests {
+		if limit, ok := resources.Limits[name]; ok && request.Cmp(limit) > 0 {
+			allErrs = append(allErrs, field.Invalid(resourcesPath.Child("requests").Key(string(name)), request.String(),
+				fmt.Sprintf("must be less than or equal to %s limit of %s", name, limit.String())))
+		}
+	}
+
+	return allErrs
+}
+
+// validateProbes checks each probe that is set has exactly one handler.
+func validateProbes(probesPath *field.Path, probes *Probes) field.ErrorList {
+	var allErrs field.ErrorList
+	if probes == nil {
+		return allErrs
+	}
+
+	for _, probe := range []struct {
+		name  string
+		probe *corev1.Probe
+	}{
+		{"liveness", probes.Liveness},
+		{"readiness", probes.Readiness},
+		{"startup", probes.Startup},
+	} {
+		if probe.probe == nil {
+			continue
+		}
+		handler := probe.probe.ProbeHandler
+		handlers := 0
+		for _, set := range []bool{handler.Exec != nil, handler.HTTPGet != nil, handler.TCPSocket != nil, handler.GRPC != nil} {
+			if set {
+				handlers++
+			}
+		}
+		if handlers != 1 {
+			allErrs = append(allErrs, field.Invalid(probesPath.Child(probe.name), "",
+				"exactly one of exec, httpGet, tcpSocket and grpc must be set"))
+		}
+	}
+
+	return allErrs
+}
+
+// validateDisruptionBudget checks exactly one of minAvailable and maxUnavailable is set, to a number or a percentage.
+func validateDisruptionBudget(budgetPath *field.Path, budget *DisruptionBudget) field.ErrorList {
+	var allErrs field.ErrorList
+	if budget == nil {
+		return allErrs
+	}
+
+	if (budget.MinAvailable == nil) == (budget.MaxUnavailable == nil) {
+		allErrs = append(allErrs, field.Invalid(budgetPath, "", "exactly one of minAvailable and maxUnavailable must be set"))
+	}
+	for _, value := range []struct {
+		name   string
+		budget *intstr.IntOrString
+	}{
+		{"minAvailable", budget.MinAvailable},
+		{"maxUnavailable", budget.MaxUnavailable},
+	} {
+		if value.budget == nil {
+			continue
+		}
+		if scaled, err := intstr.GetScaledValueFromIntOrPercent(value.budget, 100, true); err != nil || scaled < 0 {
+			allErrs = append(allErrs, field.Invalid(budgetPath.Child(value.name), value.budget.String(),
+				"must be a non-negative number or percentage"))
+		}
+	}
+
+	return allErrs
+}
+
+// lastPathElement returns the part of an image repository after the final slash,
+// so a registry port such as localhost:5000/podinfo is not mistaken for a tag.
+func lastPathElement(repository string) string {
+	return repository[strings.LastIndex(repository, "/")+1:]
+}
@@ -0,0 +1,264 @@
+package v1beta1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestWebhook(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Webhook Suite")
+}
+
+var _ = Describe("MyAppResource webhook", func() {
+
+	var myAppResource *MyAppResource
+
+	BeforeEach(func() {
+		replicas := int32(2)
+		myAppResource = &MyAppResource{
+			ObjectMeta: metav1.ObjectMeta{Name: "whatever", Namespace: "default"},
+			Spec: MyAppResourceSpec{
+				ReplicaCount: &replicas,
+				Image:        Image{Repository: "ghcr.io/stefanprodan/podinfo", Tag: "6.3.4"},
+				UI:           UI{Color: "#34577c", Message: "some message"},
+			},
+		}
+	})
+
+	Context("When defaulting", func() {
+		It("Should fill in replicas and service", func() {
+			myAppResource.Spec.ReplicaCount = nil
+
+			myAppResource.Default()
+
+			Expect(*myAppResource.Spec.ReplicaCount).Should(Equal(int32(1)))
+			Expect(myAppResource.Spec.Service).Should(Equal(Service{
+				Type:        corev1.ServiceTypeClusterIP,
+				HTTPPort:    DefaultServiceHTTPPort,
+				MetricsPort: DefaultServiceMetricsPort,
+			}))
+		})
+
+		It("Should keep values that are already set", func() {
+			myAppResource.Spec.Redis = Redis{Enabled: true}
+
+			myAppResource.Default()
+
+			Expect(*myAppResource.Spec.ReplicaCount).Should(Equal(int32(2)))
+			Expect(myAppResource.Spec.Image.Tag).Should(Equal("6.3.4"))
+			Expect(myAppResource.Spec.Redis.Enabled).Should(BeTrue())
+		})
+
+		It("Should fill in the images of the operator configuration", func() {
+			image := Image{Repository: "registry.example.com/podinfo", Tag: "6.3.4"}
+			redisImage := RedisImage{Repository: "registry.example.com/redis-stack", Tag: "7.2.0-v6"}
+			myAppResource.Spec.Image = Image{Tag: "6.3.5"}
+
+			myAppResource.DefaultImages(image, redisImage)
+			Expect(myAppResource.Spec.Image).Should(Equal(Image{Repository: "registry.example.com/podinfo", Tag: "6.3.5"}))
+			Expect(myAppResource.Spec.Redis.Image).Should(Equal(RedisImage{}))
+
+			myAppResource.Spec.Redis = Redis{Enabled: true}
+			myAppResource.DefaultImages(image, redisImage)
+			Expect(myAppResource.Spec.Redis.Image).Should(Equal(redisImage))
+		})
+	})
+
+	Context("When validating", func() {
+		It("Should accept a valid spec without warnings", func() {
+			warnings, err := myAppResource.validate()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(warnings).Should(BeEmpty())
+		})
+
+		It("Should reject colors with trailing characters", func() {
+			myAppResource.Spec.UI.Color = "#123456garbage"
+
+			_, err := myAppResource.validate()
+			Expect(apierrors.IsInvalid(err)).Should(BeTrue())
+			Expect(err.Error()).Should(ContainSubstring("spec.ui.color"))
+		})
+
+		It("Should reject a tag in the repository", func() {
+			myAppResource.Spec.Image.Repository = "ghcr.io/stefanprodan/podinfo:6.3.4"
+
+			_, err := myAppResource.validate()
+			Expect(apierrors.IsInvalid(err)).Should(BeTrue())
+			Expect(err.Error()).Should(ContainSubstring("spec.image.repository"))
+		})
+
+		It("Should reject a tag in the redis repository", func() {
+			myAppResource.Spec.Redis = Redis{Enabled: true, Image: RedisImage{Repository: "redis/redis-stack:7.2.0-v6"}}
+
+			_, err := myAppResource.validate()
+			Expect(apierrors.IsInvalid(err)).Should(BeTrue())
+			Expect(err.Error()).Should(ContainSubstring("set spec.redis.image.tag instead"))
+		})
+
+		It("Should reject the same http and metrics service port", func() {
+			myAppResource.Spec.Service = Service{HTTPPort: 8080, MetricsPort: 8080}
+
+			_, err := myAppResource.validate()
+			Expect(apierrors.IsInvalid(err)).Should(BeTrue())
+			Expect(err.Error()).Should(ContainSubstring("spec.service.metricsPort"))
+		})
+
+		It("Should reject a probe without exactly one handler", func() {
+			myAppResource.Spec.Probes = &Probes{Readiness: &corev1.Probe{PeriodSeconds: 5}}
+			myAppResource.Spec.Redis.Probes = &Probes{Liveness: &corev1.Probe{ProbeHandler: corev1.ProbeHandler{
+				TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt(6379)},
+				Exec:      &corev1.ExecAction{Command: []string{"redis-cli", "ping"}},
+			}}}
+
+			_, err := myAppResource.validate()
+			Expect(apierrors.IsInvalid(err)).Should(BeTrue())
+			Expect(err.Error()).Should(ContainSubstring("spec.probes.readiness"))
+			Expect(err.Error()).Should(ContainSubstring("spec.redis.probes.liveness"))
+
+			myAppResource.Spec.Probes.Readiness.HTTPGet = &corev1.HTTPGetAction{Path: "/readyz", Port: intstr.FromInt(9898)}
+			myAppResource.Spec.Redis.Probes.Liveness.Exec = nil
+			Expect(myAppResource.validate()).Error().ShouldNot(HaveOccurred())
+		})
+
+		It("Should reject maxReplicas below minReplicas", func() {
+			minReplicas := int32(3)
+			myAppResource.Spec.Autoscaling = &Autoscaling{MinReplicas: &minReplicas, MaxReplicas: 2}
+
+			_, err := myAppResource.validate()
+			Expect(apierrors.IsInvalid(err)).Should(BeTrue())
+			Expect(err.Error()).Should(ContainSubstring("spec.autoscaling.maxReplicas"))
+		})
+
+		It("Should reject invalid ingress hosts", func() {
+			myAppResource.Spec.Ingress = &Ingress{Hosts: []string{"podinfo.example.com", "*.example.com", "Not_A_Host"}}
+
+			_, err := myAppResource.validate()
+			Expect(apierrors.IsInvalid(err)).Should(BeTrue())
+			Expect(err.Error()).Should(ContainSubstring("spec.ingress.hosts[2]"))
+			Expect(err.Error()).ShouldNot(ContainSubstring("spec.ingress.hosts[1]"))
+		})
+
+		It("Should allow a registry port in the repository", func() {
+			myAppResource.Spec.Image.Repository = "localhost:5000/podinfo"
+
+			_, err := myAppResource.validate()
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("Should reject requests above limits", func() {
+			myAppResource.Spec.Resources = &corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("128Mi")},
+				Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi")},
+			}
+
+			_, err := myAppResource.validate()
+			Expect(apierrors.IsInvalid(err)).Should(BeTrue())
+			Expect(err.Error()).Should(ContainSubstring("spec.resources.requests[memory]"))
+		})
+
+		It("Should warn about the latest tag and zero replicas", func() {
+			replicas := int32(0)
+			myAppResource.Spec.ReplicaCount = &replicas
+			myAppResource.Spec.Image.Tag = "latest"
+			myAppResource.Spec.Redis = Redis{Enabled: true}
+
+			warnings, err := myAppResource.validate()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(warnings).Should(HaveLen(2))
+			Expect(warnings[0]).Should(ContainSubstring("spec.image.tag"))
+			Expect(warnings[1]).Should(ContainSubstring("Redis will still be deployed"))
+		})
+
+		It("Should reject a sentinel quorum above the sentinel replicas", func() {
+			myAppResource.Spec.Redis = Redis{
+				Enabled:  true,
+				Mode:     RedisModeSentinel,
+				Sentinel: &RedisSentinel{Replicas: 3, Quorum: 4},
+			}
+
+			_, err := myAppResource.validate()
+			Expect(apierrors.IsInvalid(err)).Should(BeTrue())
+			Expect(err.Error()).Should(ContainSubstring("spec.redis.sentinel.quorum"))
+		})
+
+		It("Should warn about replication settings in standalone mode", func() {
+			replicas := int32(2)
+			myAppResource.Spec.Redis = Redis{
+				Enabled:  true,
+				Replicas: &replicas,
+				Sentinel: &RedisSentinel{Replicas: 3, Quorum: 2},
+			}
+
+			warnings, err := myAppResource.validate()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(warnings).Should(HaveLen(2))
+			Expect(warnings[0]).Should(ContainSubstring("spec.redis.sentinel"))
+			Expect(warnings[1]).Should(ContainSubstring("spec.redis.replicas"))
+		})
+
+		It("Should reject a RedisCache along with a Redis of its own", func() {
+			myAppResource.Spec.Redis = Redis{Enabled: true, CacheRef: &corev1.LocalObjectReference{Name: "shared"}}
+
+			_, err := myAppResource.validate()
+			Expect(apierrors.IsInvalid(err)).Should(BeTrue())
+			Expect(err.Error()).Should(ContainSubstring("spec.redis.cacheRef"))
+
+			myAppResource.Spec.Redis.Enabled = false
+			Expect(myAppResource.validate()).Error().ShouldNot(HaveOccurred())
+		})
+
+		It("Should reject an external Redis along with another Redis", func() {
+			myAppResource.Spec.Redis = Redis{Enabled: true, External: &RedisExternal{Host: "redis.example.com"}}
+
+			_, err := myAppResource.validate()
+			Expect(apierrors.IsInvalid(err)).Should(BeTrue())
+			Expect(err.Error()).Should(ContainSubstring("spec.redis.external"))
+
+			myAppResource.Spec.Redis = Redis{CacheRef: &corev1.LocalObjectReference{Name: "shared"}, External: &RedisExternal{Host: "redis.example.com"}}
+			_, err = myAppResource.validate()
+			Expect(apierrors.IsInvalid(err)).Should(BeTrue())
+
+			myAppResource.Spec.Redis.CacheRef = nil
+			Expect(myAppResource.validate()).Error().ShouldNot(HaveOccurred())
+		})
+
+		It("Should reject disruption budgets without exactly one bound", func() {
+			minAvailable := intstr.FromInt(1)
+			maxUnavailable := intstr.FromString("50%")
+			myAppResource.Spec.DisruptionBudget = &DisruptionBudget{MinAvailable: &minAvailable, MaxUnavailable: &maxUnavailable}
+			myAppResource.Spec.Redis = Redis{Enabled: true, DisruptionBudget: &DisruptionBudget{}}
+
+			_, err := myAppResource.validate()
+			Expect(apierrors.IsInvalid(err)).Should(BeTrue())
+			Expect(err.Error()).Should(ContainSubstring("spec.disruptionBudget:"))
+			Expect(err.Error()).Should(ContainSubstring("spec.redis.disruptionBudget:"))
+		})
+
+		It("Should reject a disruption budget that is not a percentage", func() {
+			maxUnavailable := intstr.FromString("half")
+			myAppResource.Spec.DisruptionBudget = &DisruptionBudget{MaxUnavailable: &maxUnavailable}
+
+			_, err := myAppResource.validate()
+			Expect(apierrors.IsInvalid(err)).Should(BeTrue())
+			Expect(err.Error()).Should(ContainSubstring("spec.disruptionBudget.maxUnavailable"))
+		})
+
+		It("Should warn about a disruption budget that blocks node drains", func() {
+			minAvailable := intstr.FromInt(2)
+			myAppResource.Spec.DisruptionBudget = &DisruptionBudget{MinAvailable: &minAvailable}
+
+			warnings, err := myAppResource.validate()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(warnings).Should(ConsistOf(ContainSubstring("spec.disruptionBudget.minAvailable")))
+		})
+	})
+})
@@ -0,0 +1,140 @@
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RedisCacheSpec defines the desired state of RedisCache
+type RedisCacheSpec struct {
+	// +optional
+	// +kubebuilder:default={}
+	Image RedisImage `json:"image"`
+
+	// +optional
+	// Resources sets the compute resources of the Redis Container.
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// +optional
+	// Probes overrides the default probes of the Redis Container, which check the Redis port
+	// is open and Redis answers PING.
+	Probes *Probes `json:"probes,omitempty"`
+
+	// +optional
+	// PodSecurityContext replaces the default security context of the Redis pod, which runs it as
+	// a non-root user with the RuntimeDefault seccomp profile.
+	PodSecurityContext *corev1.PodSecurityContext `json:"podSecurityContext,omitempty"`
+
+	// +optional
+	// SecurityContext replaces the default security context of the Redis Container, which drops
+	// all capabilities, forbids privilege escalation and mounts the root filesystem read-only.
+	SecurityContext *corev1.SecurityContext `json:"securityContext,omitempty"`
+
+	// +optional
+	// ExtraArgs are appended to the redis-server arguments, for example ["--maxmemory", "100mb"].
+	ExtraArgs []string `json:"extraArgs,omitempty"`
+
+	// +optional
+	// Persistence stores the Redis data on a PersistentVolumeClaim. When set, Redis runs
+	// as a StatefulSet with a volumeClaimTemplate instead of a Deployment.
+	Persistence *RedisPersistence `json:"persistence,omitempty"`
+
+	// +optional
+	// Auth configures the password Redis requires from its clients, which is shared by all consumers.
+	Auth *RedisAuth `json:"auth,omitempty"`
+
+	// +optional
+	// +kubebuilder:default=16
+	// +kubebuilder:validation:Minimum=1
+	// Databases sets the number of logical databases of Redis, which is the number of consumers
+	// the RedisCache can serve, each consumer is given a database of its own.
+	Databases int32 `json:"databases,omitempty"`
+}
+
+// RedisCacheConsumer is a MyAppResource using the RedisCache.
+type RedisCacheConsumer struct {
+	// Name is the name of the MyAppResource.
+	Name string `json:"name"`
+
+	// +optional
+	// Database is the logical database of the consumer. It is unset
+	// while every database is taken by other consumers.
+	Database *int32 `json:"database,omitempty"`
+}
+
+// Condition types reported in RedisCacheStatus.Conditions, along with ConditionTypeReady and
+// ConditionTypePolicyViolation.
+const (
+	// ConditionTypeFull is True while consumers wait for a database.
+	ConditionTypeFull = "Full"
+)
+
+// Condition reasons reported in RedisCacheStatus.Conditions.
+const (
+	ReasonDatabasesAvailable = "DatabasesAvailable"
+	ReasonNoFreeDatabase     = "NoFreeDatabase"
+)
+
+// RedisCacheStatus defines the observed state of RedisCache
+type RedisCacheStatus struct {
+	// +optional
+	// ObservedGeneration is the most recent RedisCache generation observed by the controller.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// +optional
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	// Conditions represent the latest available observations of the RedisCache state.
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+
+	// +optional
+	// ReadyReplicas is the number of Redis pods with a Ready Condition.
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+
+	// +optional
+	// Endpoint is the address the consumers reach Redis at.
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	// Consumers are the MyAppResources using the RedisCache, with the database they are given.
+	// A consumer keeps its database for as long as it uses the RedisCache.
+	Consumers []RedisCacheConsumer `json:"consumers,omitempty"`
+
+	// +optional
+	// DirtyDatabases are the databases freed by consumers that no longer use the RedisCache. They are
+	// flushed before being given to another consumer, which must not read the keys of the previous one.
+	DirtyDatabases []int32 `json:"dirtyDatabases,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// RedisCache is the Schema for the rediscaches API. It runs a Redis shared by the MyAppResources
+// of its namespace that select it with spec.redis.cacheRef. Each of them is given a database of its
+// own, but they share one password, so any of them can select and change the databases of the others.
+type RedisCache struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   RedisCacheSpec   `json:"spec,omitempty"`
+	Status RedisCacheStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// RedisCacheList contains a list of RedisCache
+type RedisCacheList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []RedisCache `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&RedisCache{}, &RedisCacheList{})
+}
@@ -19,6 +19,7 @@ package main
 import (
 	"flag"
 	"os"
+	"strings"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -28,11 +29,16 @@ import (
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	myv1alpha1 "github.com/domenicbove/angi/api/v1alpha1"
+	myv1beta1 "github.com/domenicbove/angi/api/v1beta1"
+	"github.com/domenicbove/angi/internal/config"
 	"github.com/domenicbove/angi/internal/controller"
+	"github.com/domenicbove/angi/internal/imagepolicy"
+	"github.com/domenicbove/angi/internal/redis"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -45,6 +51,7 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(myv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(myv1beta1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
@@ -52,20 +59,48 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var configFile string
+	var watchNamespaces string
+	var imagePolicy imagepolicy.Policy
+	var allowedImageRepositories, mutableImageTags string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&configFile, "config", "",
+		"The operator configuration file, with the cluster domain and the defaults of the child objects. "+
+			"The built-in defaults are used when unset.")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", "",
+		"Comma separated namespaces the operator watches and reconciles MyAppResources in. "+
+			"Every namespace is watched when empty, which needs a ClusterRole.")
+	flag.StringVar(&allowedImageRepositories, "allowed-image-repositories", "",
+		"Comma separated registries and repositories the images of a MyAppResource may be pulled from, "+
+			"for example ghcr.io/stefanprodan,docker.io/redis. Every repository is allowed when empty.")
+	flag.BoolVar(&imagePolicy.ForbidMutableTags, "forbid-mutable-image-tags", false,
+		"Do not roll out images tagged with one of the mutable image tags.")
+	flag.StringVar(&mutableImageTags, "mutable-image-tags", imagepolicy.DefaultMutableTag,
+		"Comma separated image tags that are moved to new images over time.")
 	opts := zap.Options{
 		Development: true,
 	}
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
+	imagePolicy.AllowedRepositories = splitList(allowedImageRepositories)
+	imagePolicy.MutableTags = splitList(mutableImageTags)
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	operatorConfig := config.New()
+	if configFile != "" {
+		var err error
+		if operatorConfig, err = config.Load(configFile); err != nil {
+			setupLog.Error(err, "unable to load the operator configuration", "config", configFile)
+			os.Exit(1)
+		}
+	}
+
+	options := ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
 		Port:                   9443,
@@ -83,19 +118,56 @@ func main() {
 		// if you are doing or is intended to do any operation such as perform cleanups
 		// after the manager stops then its usage might be unsafe.
 		// LeaderElectionReleaseOnCancel: true,
-	})
+	}
+	// the cache only lists and watches the given namespaces, so a Role in each of them is enough
+	namespaces := splitList(watchNamespaces)
+	switch len(namespaces) {
+	case 0:
+	case 1:
+		options.Namespace = namespaces[0]
+	default:
+		options.NewCache = cache.MultiNamespacedCacheBuilder(namespaces)
+	}
+	if len(namespaces) > 0 {
+		setupLog.Info("watching namespaces", "namespaces", namespaces)
+	}
+
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), options)
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
 	if err = (&controller.MyAppResourceReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:         mgr.GetClient(),
+		Scheme:         mgr.GetScheme(),
+		RedisInspector: redis.NewInspector(),
+		Recorder:       mgr.GetEventRecorderFor("myappresource-controller"),
+		Config:         operatorConfig,
+		ImagePolicy:    imagePolicy,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "MyAppResource")
 		os.Exit(1)
 	}
+	if err = (&controller.RedisCacheReconciler{
+		Client:         mgr.GetClient(),
+		Scheme:         mgr.GetScheme(),
+		Recorder:       mgr.GetEventRecorderFor("rediscache-controller"),
+		Config:         operatorConfig,
+		ImagePolicy:    imagePolicy,
+		RedisInspector: redis.NewInspector(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "RedisCache")
+		os.Exit(1)
+	}
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&myv1beta1.MyAppResource{}).SetupWebhookWithManager(mgr,
+			myv1beta1.Image{Repository: operatorConfig.PodInfo.Image.Repository, Tag: operatorConfig.PodInfo.Image.Tag},
+			myv1beta1.RedisImage{Repository: operatorConfig.Redis.Image.Repository, Tag: operatorConfig.Redis.Image.Tag}); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "MyAppResource")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -113,3 +185,14 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// splitList splits a comma separated flag value, dropping empty elements.
+func splitList(value string) []string {
+	var list []string
+	for _, element := range strings.Split(value, ",") {
+		if element = strings.TrimSpace(element); element != "" {
+			list = append(list, element)
+		}
+	}
+	return list
+}
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/yaml"
+
+	"github.com/domenicbove/angi/api/v1beta1"
+)
+
+const (
+	// APIVersion is the version of the configuration file format.
+	APIVersion = "config.my.api.group/v1alpha1"
+	// Kind is the kind of the configuration file.
+	Kind = "OperatorConfig"
+
+	// DefaultClusterDomain is the cluster DNS domain used when none is set.
+	DefaultClusterDomain = "cluster.local"
+	// DefaultLabelPrefix is the prefix of the instance label, used when none is set.
+	DefaultLabelPrefix = "app.kubernetes.io"
+	// DefaultPodInfoImageRepository is the PodInfo Container image repository used when none is set.
+	DefaultPodInfoImageRepository = "ghcr.io/stefanprodan/podinfo"
+	// DefaultPodInfoImageTag is the PodInfo Container image tag used when none is set. The default tags are
+	// pinned, so defaulted MyAppResources are not warned about, nor rejected for, a mutable tag.
+	DefaultPodInfoImageTag = "6.3.4"
+	// DefaultRedisImageRepository is the Redis Container image repository used when none is set.
+	DefaultRedisImageRepository = "redis/redis-stack"
+	// DefaultRedisImageTag is the Redis Container image tag used when none is set.
+	DefaultRedisImageTag = "7.2.0-v6"
+)
+
+// OperatorConfig is the configuration file of the operator. It holds the defaults the child objects
+// are built with, for the MyAppResource fields that are not set.
+type OperatorConfig struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// ClusterDomain is the DNS domain of the cluster, Services are reached at <service>.<namespace>.svc.<clusterDomain>.
+	ClusterDomain string `json:"clusterDomain,omitempty"`
+	// LabelPrefix is the prefix of the <labelPrefix>/instance label, set on every child object and its pods.
+	// The other labels of the child objects, and their selectors, do not use it.
+	LabelPrefix string `json:"labelPrefix,omitempty"`
+	// PodInfo holds the defaults of the PodInfo Container.
+	PodInfo ComponentDefaults `json:"podInfo,omitempty"`
+	// Redis holds the defaults of the Redis Container.
+	Redis ComponentDefaults `json:"redis,omitempty"`
+}
+
+// ComponentDefaults are the defaults of a Container.
+type ComponentDefaults struct {
+	// Image is the image used when the MyAppResource sets no repository or tag.
+	Image Image `json:"image,omitempty"`
+	// Resources are the compute resources used when the MyAppResource sets none.
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// Image describes a Container image.
+type Image struct {
+	Repository string `json:"repository,omitempty"`
+	Tag        string `json:"tag,omitempty"`
+}
+
+// New returns the configuration used when no configuration file is given, with all the defaults.
+func New() OperatorConfig {
+	config := OperatorConfig{TypeMeta: metav1.TypeMeta{APIVersion: APIVersion, Kind: Kind}}
+	config.setDefaults()
+	return config
+}
+
+// Load reads the configuration file at path. Fields that are not set get their defaults, and
+// unknown fields are rejected so a typo does not silently fall back to a default.
+func Load(path string) (OperatorConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return OperatorConfig{}, err
+	}
+
+	config := OperatorConfig{}
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return OperatorConfig{}, fmt.Errorf("unable to parse %s: %w", path, err)
+	}
+	if config.APIVersion != APIVersion || config.Kind != Kind {
+		return OperatorConfig{}, fmt.Errorf("%s is a %s %s, expected a %s %s", path, config.APIVersion, config.Kind, APIVersion, Kind)
+	}
+	config.setDefaults()
+	if err := config.validate().ToAggregate(); err != nil {
+		return OperatorConfig{}, fmt.Errorf("invalid %s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+// InstanceLabel returns the label recording the owning MyAppResource or RedisCache on the child objects and
+// their pods, and on the objects that carry no ownerReference, such as the PersistentVolumeClaims created
+// from a volumeClaimTemplate.
+func (c OperatorConfig) InstanceLabel() string {
+	return c.LabelPrefix + "/instance"
+}
+
+// setDefaults fills in the fields that are not set.
+func (c *OperatorConfig) setDefaults() {
+	c.ClusterDomain = strings.TrimSuffix(c.ClusterDomain, ".")
+	if c.ClusterDomain == "" {
+		c.ClusterDomain = DefaultClusterDomain
+	}
+	if c.LabelPrefix == "" {
+		c.LabelPrefix = DefaultLabelPrefix
+	}
+	if c.PodInfo.Image.Repository == "" {
+		c.PodInfo.Image.Repository = DefaultPodInfoImageRepository
+	}
+	if c.PodInfo.Image.Tag == "" {
+		c.PodInfo.Image.Tag = DefaultPodInfoImageTag
+	}
+	if c.Redis.Image.Repository == "" {
+		c.Redis.Image.Repository = DefaultRedisImageRepository
+	}
+	if c.Redis.Image.Tag == "" {
+		c.Redis.Image.Tag = DefaultRedisImageTag
+	}
+}
+
+// validate checks the domain and prefix are valid DNS names, and the defaults are usable images and resources.
+func (c OperatorConfig) validate() field.ErrorList {
+	var allErrs field.ErrorList
+
+	for _, msg := range validation.IsDNS1123Subdomain(c.ClusterDomain) {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("clusterDomain"), c.ClusterDomain, msg))
+	}
+	for _, msg := range validation.IsDNS1123Subdomain(c.LabelPrefix) {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("labelPrefix"), c.LabelPrefix, msg))
+	}
+	allErrs = append(allErrs, c.PodInfo.validate(field.NewPath("podInfo"))...)
+	allErrs = append(allErrs, c.Redis.validate(field.NewPath("redis"))...)
+
+	return allErrs
+}
+
+// validate checks the image repository and tag are set in their own fields, and no resource request is above its limit.
+func (d ComponentDefaults) validate(path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	allErrs = append(allErrs, v1beta1.ValidateImage(path.Child("image"), d.Image.Repository, d.Image.Tag)...)
+	allErrs = append(allErrs, v1beta1.ValidateResources(path.Child("resources"), d.Resources)...)
+	return allErrs
+}
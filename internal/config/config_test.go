@@ -0,0 +1,114 @@
+package config
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/domenicbove/angi/internal/imagepolicy"
+)
+
+func TestConfig(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Config Suite")
+}
+
+var _ = Describe("Operator configuration", func() {
+
+	// writeConfig writes the configuration file and returns its path
+	writeConfig := func(content string) string {
+		path := filepath.Join(GinkgoT().TempDir(), "config.yaml")
+		Expect(os.WriteFile(path, []byte(content), 0o600)).Should(Succeed())
+		return path
+	}
+
+	Context("When no file is given", func() {
+		It("Should use the built-in defaults", func() {
+			config := New()
+
+			Expect(config.ClusterDomain).Should(Equal("cluster.local"))
+			Expect(config.InstanceLabel()).Should(Equal("app.kubernetes.io/instance"))
+			Expect(config.PodInfo.Image).Should(Equal(Image{Repository: "ghcr.io/stefanprodan/podinfo", Tag: "6.3.4"}))
+			Expect(config.Redis.Image).Should(Equal(Image{Repository: "redis/redis-stack", Tag: "7.2.0-v6"}))
+			Expect(config.PodInfo.Resources).Should(BeNil())
+		})
+
+		It("Should pin the default images", func() {
+			config := New()
+			policy := imagepolicy.Policy{ForbidMutableTags: true, MutableTags: []string{imagepolicy.DefaultMutableTag}}
+
+			for _, image := range []Image{config.PodInfo.Image, config.Redis.Image} {
+				Expect(policy.Check(image.Repository + ":" + image.Tag)).Should(Succeed())
+			}
+		})
+	})
+
+	Context("When loading a file", func() {
+		It("Should read the values and default the rest", func() {
+			config, err := Load(writeConfig(`
+apiVersion: config.my.api.group/v1alpha1
+kind: OperatorConfig
+clusterDomain: example.internal.
+labelPrefix: example.com
+podInfo:
+  image:
+    tag: 6.3.4
+  resources:
+    requests:
+      cpu: 100m
+`))
+			Expect(err).ShouldNot(HaveOccurred())
+
+			Expect(config.ClusterDomain).Should(Equal("example.internal"))
+			Expect(config.InstanceLabel()).Should(Equal("example.com/instance"))
+			Expect(config.PodInfo.Image).Should(Equal(Image{Repository: "ghcr.io/stefanprodan/podinfo", Tag: "6.3.4"}))
+			Expect(config.PodInfo.Resources.Requests.Cpu().String()).Should(Equal("100m"))
+			Expect(config.Redis.Image).Should(Equal(Image{Repository: "redis/redis-stack", Tag: "7.2.0-v6"}))
+		})
+
+		It("Should reject other kinds and versions", func() {
+			_, err := Load(writeConfig(`
+apiVersion: config.my.api.group/v1beta1
+kind: OperatorConfig
+`))
+			Expect(err).Should(MatchError(ContainSubstring("expected a config.my.api.group/v1alpha1 OperatorConfig")))
+		})
+
+		It("Should reject unknown fields", func() {
+			_, err := Load(writeConfig(`
+apiVersion: config.my.api.group/v1alpha1
+kind: OperatorConfig
+clusterDomian: example.internal
+`))
+			Expect(err).Should(MatchError(ContainSubstring(`unknown field "clusterDomian"`)))
+		})
+
+		It("Should reject invalid values", func() {
+			_, err := Load(writeConfig(`
+apiVersion: config.my.api.group/v1alpha1
+kind: OperatorConfig
+clusterDomain: Example_Internal
+podInfo:
+  image:
+    tag: not a tag
+redis:
+  image:
+    repository: redis/redis-stack:latest
+  resources:
+    requests:
+      memory: 512Mi
+    limits:
+      memory: 256Mi
+`))
+			Expect(err).Should(MatchError(And(
+				ContainSubstring("clusterDomain"),
+				ContainSubstring("podInfo.image.tag"),
+				ContainSubstring("redis.image.repository"),
+				ContainSubstring("redis.resources.requests[memory]"),
+			)))
+		})
+	})
+})
@@ -0,0 +1,263 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// fieldManager is the field manager the operator applies child objects with.
+	fieldManager = "myappresource-controller"
+	// handoverFieldManager holds the PodInfo replicas while they pass from the operator to an autoscaler.
+	handoverFieldManager = "myappresource-controller-handover"
+)
+
+// applier creates, updates and deletes the child objects of a MyAppResource or RedisCache, and records
+// events about them on their owner. Both reconcilers embed it, so their child objects are managed the
+// same way, and set it up in SetupWithManager.
+type applier struct {
+	client.Client
+	// recorder records the events. When nil, no events are recorded.
+	recorder record.EventRecorder
+	// instanceLabel is the label set to the name of the owner of a child object, see config.InstanceLabel.
+	instanceLabel string
+}
+
+// createOrUpdateDeployment applies the desired Deployment. A desired Deployment without replicas
+// leaves them to an autoscaler.
+func (a *applier) createOrUpdateDeployment(ctx context.Context, name, namespace string, updatedDeployment *appsv1.Deployment, log logr.Logger) (*appsv1.Deployment, error) {
+	// get existing deployment
+	deployment := appsv1.Deployment{}
+	err := a.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, &deployment)
+	if client.IgnoreNotFound(err) != nil {
+		log.Error(err, "failed to get Deployment", "deployment", name)
+		return nil, err
+	}
+
+	// dropping replicas the operator applied so far would reset them to 1, so they are first
+	// handed over at their current value, the autoscaler takes them from there
+	if err == nil && updatedDeployment.Spec.Replicas == nil && deployment.Spec.Replicas != nil &&
+		ownsField(deployment.ManagedFields, fieldManager, "f:spec", "f:replicas") {
+		handover := handoverDeployment(name, namespace)
+		if err := unstructured.SetNestedField(handover.Object, int64(*deployment.Spec.Replicas), "spec", "replicas"); err != nil {
+			return nil, err
+		}
+		if err := a.Patch(ctx, handover, client.Apply, client.FieldOwner(handoverFieldManager), client.ForceOwnership); err != nil {
+			log.Error(err, "unable to hand over Deployment replicas", "deployment", name)
+			return nil, err
+		}
+	}
+
+	applied, err := a.createOrUpdate(ctx, updatedDeployment.DeepCopy(), log)
+	if err != nil {
+		return nil, err
+	}
+
+	// once autoscaling is turned off the operator applies the replicas again, and the handover
+	// lets go of them by applying nothing
+	if updatedDeployment.Spec.Replicas != nil && ownsField(applied.GetManagedFields(), handoverFieldManager, "f:spec", "f:replicas") {
+		release := handoverDeployment(name, namespace)
+		if err := a.Patch(ctx, release, client.Apply, client.FieldOwner(handoverFieldManager)); err != nil {
+			log.Error(err, "unable to release the handed over Deployment replicas", "deployment", name)
+			return nil, err
+		}
+		released := &appsv1.Deployment{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(release.Object, released); err != nil {
+			return nil, err
+		}
+		return released, nil
+	}
+
+	return applied.(*appsv1.Deployment), nil
+}
+
+// handoverDeployment returns the Deployment the handoverFieldManager applies, without any fields.
+func handoverDeployment(name, namespace string) *unstructured.Unstructured {
+	handover := &unstructured.Unstructured{}
+	handover.SetGroupVersionKind(appsv1.SchemeGroupVersion.WithKind("Deployment"))
+	handover.SetName(name)
+	handover.SetNamespace(namespace)
+	return handover
+}
+
+// createOrUpdateStatefulSet applies the desired StatefulSet. The API server does not allow the
+// selector, serviceName, podManagementPolicy and volumeClaimTemplates to change once it is created,
+// so an existing StatefulSet keeps them.
+func (a *applier) createOrUpdateStatefulSet(ctx context.Context, name, namespace string, updatedStatefulSet *appsv1.StatefulSet, log logr.Logger) (*appsv1.StatefulSet, error) {
+	// get existing statefulset
+	statefulSet := appsv1.StatefulSet{}
+	err := a.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, &statefulSet)
+	if client.IgnoreNotFound(err) != nil {
+		log.Error(err, "failed to get StatefulSet", "statefulset", name)
+		return nil, err
+	}
+
+	applied := updatedStatefulSet.DeepCopy()
+	if err == nil {
+		applied.Spec.Selector = statefulSet.Spec.Selector
+		applied.Spec.ServiceName = statefulSet.Spec.ServiceName
+		applied.Spec.PodManagementPolicy = statefulSet.Spec.PodManagementPolicy
+		applied.Spec.VolumeClaimTemplates = statefulSet.Spec.VolumeClaimTemplates
+	}
+	result, err := a.createOrUpdate(ctx, applied, log)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.(*appsv1.StatefulSet), nil
+}
+
+// createOrUpdate applies the desired child object and returns the applied result. The apply is skipped,
+// and the existing object returned, when the fields the operator applied already have the desired values.
+func (a *applier) createOrUpdate(ctx context.Context, obj client.Object, log logr.Logger) (client.Object, error) {
+	kind := obj.GetObjectKind().GroupVersionKind().Kind
+	a.setInstanceLabel(obj)
+
+	existing := obj.DeepCopyObject().(client.Object)
+	err := a.Get(ctx, client.ObjectKeyFromObject(obj), existing)
+	if client.IgnoreNotFound(err) != nil {
+		log.Error(err, fmt.Sprintf("failed to get %s", kind), strings.ToLower(kind), obj.GetName())
+		return nil, err
+	}
+	exists := err == nil
+
+	if exists {
+		applied, err := appliedAsDesired(existing, obj, fieldManager)
+		if err != nil {
+			return nil, err
+		}
+		if applied {
+			log.V(1).Info(fmt.Sprintf("%s %s", controllerutil.OperationResultNone, kind), strings.ToLower(kind), obj.GetName())
+			return existing, nil
+		}
+	}
+
+	if err := a.apply(ctx, obj, log); err != nil {
+		log.Error(err, fmt.Sprintf("unable to create or update %s", kind), strings.ToLower(kind), obj.GetName())
+		return nil, err
+	}
+	result := applyResult(exists, existing.GetResourceVersion(), obj)
+	log.V(1).Info(fmt.Sprintf("%s %s", result, kind), strings.ToLower(kind), obj.GetName())
+	switch result {
+	case controllerutil.OperationResultCreated:
+		a.recordEvent(obj, corev1.EventTypeNormal, eventReasonCreated, "Created %s %s", kind, obj.GetName())
+	case controllerutil.OperationResultUpdated:
+		a.recordEvent(obj, corev1.EventTypeNormal, eventReasonUpdated, "Updated %s %s", kind, obj.GetName())
+	}
+
+	return obj, nil
+}
+
+// setInstanceLabel sets the <labelPrefix>/instance label of a child object, and of the pods of a workload, to
+// the name of the object that controls it. The selectors can not change once created, so they leave it out,
+// and so does the pod template of a Job, which can not change either.
+func (a *applier) setInstanceLabel(obj client.Object) {
+	owner := metav1.GetControllerOf(obj)
+	if owner == nil {
+		return
+	}
+
+	obj.SetLabels(withLabel(obj.GetLabels(), a.instanceLabel, owner.Name))
+	switch obj := obj.(type) {
+	case *appsv1.Deployment:
+		obj.Spec.Template.Labels = withLabel(obj.Spec.Template.Labels, a.instanceLabel, owner.Name)
+	case *appsv1.StatefulSet:
+		obj.Spec.Template.Labels = withLabel(obj.Spec.Template.Labels, a.instanceLabel, owner.Name)
+	}
+}
+
+// withLabel returns labels with the label key set to value.
+func withLabel(labels map[string]string, key, value string) map[string]string {
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[key] = value
+	return labels
+}
+
+// apply creates or updates obj with server-side apply, so the operator only owns the fields it
+// sets, and updates obj to the result. Fields that another manager changed are taken back, since
+// the MyAppResource or RedisCache owning obj is the source of truth for them, and recorded as a DriftCorrected event naming
+// the manager, unless it is the operator's own.
+func (a *applier) apply(ctx context.Context, obj client.Object, log logr.Logger) error {
+	kind := obj.GetObjectKind().GroupVersionKind().Kind
+
+	err := a.Patch(ctx, obj, client.Apply, client.FieldOwner(fieldManager))
+	if !errors.IsConflict(err) {
+		return err
+	}
+
+	log.Info(fmt.Sprintf("taking over %s fields changed by another manager", kind), strings.ToLower(kind), obj.GetName(), "conflict", err.Error())
+	if conflictsWithOthers(err) {
+		a.recordEvent(obj, corev1.EventTypeWarning, eventReasonDriftCorrected, "Reverted changes to %s %s: %s", kind, obj.GetName(), err.Error())
+	}
+
+	return a.Patch(ctx, obj, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership)
+}
+
+// conflictsWithOthers returns true when an apply conflict names a manager other than the operator's own,
+// the handoverFieldManager giving the replicas back is no drift.
+func conflictsWithOthers(err error) bool {
+	status, ok := err.(errors.APIStatus)
+	if !ok || status.Status().Details == nil {
+		return true
+	}
+	conflicts := 0
+	for _, cause := range status.Status().Details.Causes {
+		if cause.Type != metav1.CauseTypeFieldManagerConflict {
+			continue
+		}
+		conflicts++
+		if !strings.Contains(cause.Message, fmt.Sprintf("%q", handoverFieldManager)) {
+			return true
+		}
+	}
+	return conflicts == 0
+}
+
+// applyResult reports whether an apply created the object, updated it or left it unchanged.
+func applyResult(existed bool, resourceVersion string, applied client.Object) controllerutil.OperationResult {
+	if !existed {
+		return controllerutil.OperationResultCreated
+	}
+	if applied.GetResourceVersion() != resourceVersion {
+		return controllerutil.OperationResultUpdated
+	}
+	return controllerutil.OperationResultNone
+}
+
+// deleteIfExists deletes a child object, if it exists.
+func (a *applier) deleteIfExists(ctx context.Context, key client.ObjectKey, obj client.Object, log logr.Logger) error {
+	kind := reflect.TypeOf(obj).Elem().Name()
+
+	err := a.Get(ctx, key, obj)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		log.Error(err, fmt.Sprintf("unable to fetch %s", kind), strings.ToLower(kind), key.Name)
+		return err
+	}
+
+	// object was fetched successfully, should be deleted
+	if err := a.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+		return err
+	}
+	log.V(1).Info(fmt.Sprintf("deleted %s", kind), strings.ToLower(kind), key.Name)
+	a.recordEvent(obj, corev1.EventTypeNormal, eventReasonDeleted, "Deleted %s %s", kind, key.Name)
+
+	return nil
+}
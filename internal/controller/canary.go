@@ -0,0 +1,252 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/domenicbove/angi/api/v1beta1"
+	"github.com/domenicbove/angi/internal/podinfo"
+)
+
+// canaryPlan is how the PodInfo replicas are split between the stable and the canary Deployment.
+type canaryPlan struct {
+	// stableImage is the image of the stable Deployment.
+	stableImage string
+	// stableReplicas are the replicas of the stable Deployment, nil leaves them to the autoscaler.
+	stableReplicas *int32
+	// canaryReplicas are the replicas of the canary Deployment, which only exists while status is active.
+	canaryReplicas int32
+	// status is the state of the canary rollout, nil when there is none.
+	status *v1beta1.CanaryStatus
+	// requeueAfter is when the pause of the current step is over, zero when the step does not wait for time.
+	requeueAfter time.Duration
+	// clearAction is true when the CanaryAnnotation is set, it is removed once the status records
+	// that its action was carried out.
+	clearAction bool
+}
+
+// active returns true when the canary Deployment runs.
+func (p canaryPlan) active() bool {
+	return p.status != nil && p.status.Phase != v1beta1.CanaryPhaseAborted
+}
+
+// planCanary moves the canary rollout of a changed PodInfo image forward, and returns how the
+// replicas are split for it. A rollout starts when the image differs from the image of the stable
+// Deployment, it takes one step at a time and promotes the image once the last step is complete.
+// A stalled canary Deployment aborts the rollout.
+func (r *MyAppResourceReconciler) planCanary(ctx context.Context, myAppResource v1beta1.MyAppResource, log logr.Logger) (canaryPlan, error) {
+	desiredImage := podinfo.GetImage(myAppResource, r.Config)
+	replicas := int32(1)
+	if myAppResource.Spec.ReplicaCount != nil {
+		replicas = *myAppResource.Spec.ReplicaCount
+	}
+	// an action left without a rollout to act on would otherwise apply to the next one
+	plan := canaryPlan{stableImage: desiredImage, clearAction: myAppResource.Annotations[v1beta1.CanaryAnnotation] != ""}
+	if myAppResource.Spec.Autoscaling == nil {
+		plan.stableReplicas = &replicas
+	}
+
+	if myAppResource.Spec.Rollout == nil || myAppResource.Spec.Rollout.Canary == nil {
+		return plan, nil
+	}
+	steps := myAppResource.Spec.Rollout.Canary.Steps
+
+	stable := &appsv1.Deployment{}
+	err := r.Get(ctx, client.ObjectKeyFromObject(&myAppResource), stable)
+	if errors.IsNotFound(err) {
+		// the first rollout has nothing to compare with
+		return plan, nil
+	}
+	if err != nil {
+		log.Error(err, "failed to get Deployment for MyAppResource", "myappresource", myAppResource.Name, "deployment", myAppResource.Name)
+		return plan, err
+	}
+	stableImage := getPodInfoImage(stable)
+	if myAppResource.Spec.Autoscaling != nil && stable.Spec.Replicas != nil {
+		replicas = *stable.Spec.Replicas
+	}
+
+	status := myAppResource.Status.Canary.DeepCopy()
+	if status != nil && status.CanaryImage != desiredImage {
+		status = nil
+	}
+
+	// the stable Deployment only runs the canary image once it is promoted, the status may be read from
+	// the cache before the promotion is recorded, which must not end the rollout with the canary in place
+	promoted := status != nil && status.Phase != v1beta1.CanaryPhaseAborted && stableImage == desiredImage
+
+	switch {
+	case status != nil && status.Phase == v1beta1.CanaryPhasePromoting, promoted:
+		if stableImage == desiredImage && getRolloutStatus(stable).Complete {
+			log.V(1).Info("promoted canary image", "myappresource", myAppResource.Name, "image", desiredImage)
+			return plan, nil
+		}
+		if status.Phase != v1beta1.CanaryPhasePromoting {
+			setPromoting(status, steps)
+		}
+		plan.canaryReplicas = podinfo.GetCanaryReplicas(replicas, status.Weight)
+		plan.status = status
+		return plan, nil
+	case stableImage == desiredImage:
+		return plan, nil
+	case status != nil && status.Phase == v1beta1.CanaryPhaseAborted:
+		plan.stableImage = stableImage
+		plan.status = status
+		return plan, nil
+	case status == nil:
+		status = &v1beta1.CanaryStatus{
+			Phase:       v1beta1.CanaryPhaseProgressing,
+			StableImage: stableImage,
+			CanaryImage: desiredImage,
+		}
+		r.recordEvent(&myAppResource, corev1.EventTypeNormal, eventReasonCanaryStarted,
+			"Started canary rollout of image %s, replacing %s", desiredImage, stableImage)
+	}
+	plan.stableImage = stableImage
+	plan.status = status
+
+	canary := &appsv1.Deployment{}
+	err = r.Get(ctx, client.ObjectKey{Namespace: myAppResource.Namespace, Name: podinfo.GetCanaryName(myAppResource.Name)}, canary)
+	if client.IgnoreNotFound(err) != nil {
+		log.Error(err, "failed to get canary Deployment for MyAppResource", "myappresource", myAppResource.Name)
+		return plan, err
+	}
+	canaryExists := err == nil
+
+	if canaryExists {
+		if canaryRollout := getRolloutStatus(canary); canaryRollout.Stalled {
+			return r.abortCanary(myAppResource, plan, canaryRollout.Message), nil
+		}
+	}
+
+	switch myAppResource.Annotations[v1beta1.CanaryAnnotation] {
+	case v1beta1.CanaryActionAbort:
+		return r.abortCanary(myAppResource, plan, "aborted with the "+v1beta1.CanaryAnnotation+" annotation"), nil
+	case v1beta1.CanaryActionPromote:
+		log.V(1).Info("canary step promoted", "myappresource", myAppResource.Name, "step", status.Step)
+		status.Step++
+		status.StepStartTime = nil
+	}
+
+	for ; int(status.Step) < len(steps); status.Step++ {
+		step := steps[status.Step]
+		status.Weight = step.Weight
+		plan.canaryReplicas = podinfo.GetCanaryReplicas(replicas, step.Weight)
+		if plan.stableReplicas != nil {
+			stableReplicas := replicas - plan.canaryReplicas
+			plan.stableReplicas = &stableReplicas
+		}
+
+		available := plan.canaryReplicas == 0 || canaryExists && getPodInfoImage(canary) == desiredImage &&
+			canary.Spec.Replicas != nil && *canary.Spec.Replicas == plan.canaryReplicas && getRolloutStatus(canary).Complete
+		if !available {
+			status.Phase = v1beta1.CanaryPhaseProgressing
+			status.StepStartTime = nil
+			status.Message = "waiting for the canary replicas to be available"
+			return plan, nil
+		}
+
+		if status.StepStartTime == nil {
+			now := metav1.Now()
+			status.StepStartTime = &now
+		}
+		if step.Pause == nil {
+			status.Phase = v1beta1.CanaryPhasePaused
+			status.Message = "waiting for the step to be promoted with the " + v1beta1.CanaryAnnotation + " annotation"
+			return plan, nil
+		}
+		if remaining := step.Pause.Duration - time.Since(status.StepStartTime.Time); remaining > 0 {
+			status.Phase = v1beta1.CanaryPhaseProgressing
+			status.Message = "waiting for the pause of the step to pass"
+			plan.requeueAfter = remaining
+			return plan, nil
+		}
+		status.StepStartTime = nil
+	}
+
+	// all steps are complete, the canary keeps running until the stable Deployment is rolled out
+	setPromoting(status, steps)
+	plan.stableImage = desiredImage
+	plan.stableReplicas = nil
+	if myAppResource.Spec.Autoscaling == nil {
+		plan.stableReplicas = &replicas
+	}
+	r.recordEvent(&myAppResource, corev1.EventTypeNormal, eventReasonCanaryPromoted, "Promoted canary image %s", desiredImage)
+
+	return plan, nil
+}
+
+// setPromoting records that all steps are complete, and the canary image is rolled out to the stable Deployment.
+func setPromoting(status *v1beta1.CanaryStatus, steps []v1beta1.CanaryStep) {
+	status.Phase = v1beta1.CanaryPhasePromoting
+	status.Step = int32(len(steps))
+	if len(steps) > 0 {
+		status.Weight = steps[len(steps)-1].Weight
+	}
+	status.StepStartTime = nil
+	status.Message = "rolling the canary image out to the stable Deployment"
+}
+
+// abortCanary goes back to the stable image only, until the image is changed again.
+func (r *MyAppResourceReconciler) abortCanary(myAppResource v1beta1.MyAppResource, plan canaryPlan, message string) canaryPlan {
+	plan.status.Phase = v1beta1.CanaryPhaseAborted
+	plan.status.StepStartTime = nil
+	plan.status.Message = message
+	plan.canaryReplicas = 0
+	if plan.stableReplicas != nil {
+		replicas := int32(1)
+		if myAppResource.Spec.ReplicaCount != nil {
+			replicas = *myAppResource.Spec.ReplicaCount
+		}
+		plan.stableReplicas = &replicas
+	}
+	r.recordEvent(&myAppResource, corev1.EventTypeWarning, eventReasonCanaryAborted,
+		"Aborted canary rollout of image %s: %s", plan.status.CanaryImage, message)
+
+	return plan
+}
+
+// removeCanaryAnnotation removes the CanaryAnnotation once its action is carried out. It is only
+// removed while it still holds that action, so an action set in the meantime is kept for the next reconcile.
+// The patch does not depend on the resourceVersion, a retry after a conflict would carry out the action twice.
+func (r *MyAppResourceReconciler) removeCanaryAnnotation(ctx context.Context, myAppResource v1beta1.MyAppResource, log logr.Logger) error {
+	path := "/metadata/annotations/" + strings.ReplaceAll(v1beta1.CanaryAnnotation, "/", "~1")
+	patch, err := json.Marshal([]map[string]string{
+		{"op": "test", "path": path, "value": myAppResource.Annotations[v1beta1.CanaryAnnotation]},
+		{"op": "remove", "path": path},
+	})
+	if err != nil {
+		return err
+	}
+	err = r.Patch(ctx, &myAppResource, client.RawPatch(types.JSONPatchType, patch))
+	if errors.IsInvalid(err) || errors.IsNotFound(err) {
+		log.V(1).Info("canary annotation changed before it was removed", "myappresource", myAppResource.Name)
+		return nil
+	}
+	if err != nil {
+		log.Error(err, "unable to remove canary annotation from MyAppResource", "myappresource", myAppResource.Name)
+		return err
+	}
+
+	return nil
+}
+
+// getPodInfoImage returns the image of the PodInfo Container of a Deployment.
+func getPodInfoImage(deployment *appsv1.Deployment) string {
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		if container.Name == "podinfo" {
+			return container.Image
+		}
+	}
+	return ""
+}
@@ -0,0 +1,182 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"github.com/domenicbove/angi/api/v1beta1"
+	"github.com/domenicbove/angi/internal/redis"
+)
+
+// myAppResourceFinalizer holds the deletion of a MyAppResource until its deletionPolicy is carried out.
+const myAppResourceFinalizer = "my.api.group/finalizer"
+
+// addFinalizer adds the finalizer to the MyAppResource, if it is missing.
+func (r *MyAppResourceReconciler) addFinalizer(ctx context.Context, myAppResource *v1beta1.MyAppResource, log logr.Logger) error {
+	if controllerutil.ContainsFinalizer(myAppResource, myAppResourceFinalizer) {
+		return nil
+	}
+
+	patch := client.MergeFromWithOptions(myAppResource.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	controllerutil.AddFinalizer(myAppResource, myAppResourceFinalizer)
+	if err := r.Patch(ctx, myAppResource, patch); err != nil {
+		log.Error(err, "unable to add finalizer to MyAppResource", "myappresource", myAppResource.Name)
+		return err
+	}
+	log.V(1).Info("added finalizer to MyAppResource", "myappresource", myAppResource.Name)
+
+	return nil
+}
+
+// finalize carries out the deletionPolicy of a deleted MyAppResource, then removes the finalizer,
+// so the garbage collector removes the child objects that still have an ownerReference.
+func (r *MyAppResourceReconciler) finalize(ctx context.Context, myAppResource v1beta1.MyAppResource, log logr.Logger) error {
+	if !controllerutil.ContainsFinalizer(&myAppResource, myAppResourceFinalizer) {
+		return nil
+	}
+
+	switch myAppResource.Spec.DeletionPolicy {
+	case v1beta1.DeletionPolicyOrphan:
+		if err := r.orphanChildren(ctx, myAppResource, log); err != nil {
+			return err
+		}
+	case v1beta1.DeletionPolicySnapshot:
+		// the Job is owned by the MyAppResource, so its completion triggers another reconcile
+		if done, err := r.snapshotRedis(ctx, myAppResource, log); err != nil || !done {
+			return err
+		}
+	}
+
+	patch := client.MergeFromWithOptions(myAppResource.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	controllerutil.RemoveFinalizer(&myAppResource, myAppResourceFinalizer)
+	if err := r.Patch(ctx, &myAppResource, patch); client.IgnoreNotFound(err) != nil {
+		log.Error(err, "unable to remove finalizer from MyAppResource", "myappresource", myAppResource.Name)
+		return err
+	}
+	log.V(1).Info("removed finalizer from MyAppResource", "myappresource", myAppResource.Name,
+		"deletionpolicy", myAppResource.Spec.DeletionPolicy)
+
+	return nil
+}
+
+// orphanChildren removes the ownerReference to the MyAppResource from its child objects,
+// so the garbage collector leaves them running.
+func (r *MyAppResourceReconciler) orphanChildren(ctx context.Context, myAppResource v1beta1.MyAppResource, log logr.Logger) error {
+	for _, list := range []client.ObjectList{
+		&appsv1.DeploymentList{},
+		&appsv1.StatefulSetList{},
+		&corev1.ServiceList{},
+		&corev1.SecretList{},
+		&networkingv1.IngressList{},
+		&autoscalingv2.HorizontalPodAutoscalerList{},
+		&policyv1.PodDisruptionBudgetList{},
+		&batchv1.JobList{},
+	} {
+		if err := r.List(ctx, list, client.InNamespace(myAppResource.Namespace)); err != nil {
+			log.Error(err, "unable to list child objects of MyAppResource", "myappresource", myAppResource.Name)
+			return err
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			obj := item.(client.Object)
+			if !metav1.IsControlledBy(obj, &myAppResource) {
+				continue
+			}
+			kind := reflect.TypeOf(obj).Elem().Name()
+
+			patch := client.MergeFrom(obj.DeepCopyObject().(client.Object))
+			var ownerReferences []metav1.OwnerReference
+			for _, ownerReference := range obj.GetOwnerReferences() {
+				if ownerReference.UID != myAppResource.UID {
+					ownerReferences = append(ownerReferences, ownerReference)
+				}
+			}
+			obj.SetOwnerReferences(ownerReferences)
+			if err := r.Patch(ctx, obj, patch); client.IgnoreNotFound(err) != nil {
+				log.Error(err, fmt.Sprintf("unable to orphan %s of MyAppResource", kind), "myappresource", myAppResource.Name, strings.ToLower(kind), obj.GetName())
+				return err
+			}
+			log.V(1).Info(fmt.Sprintf("orphaned %s of MyAppResource", kind), "myappresource", myAppResource.Name, strings.ToLower(kind), obj.GetName())
+			r.recordEvent(&myAppResource, corev1.EventTypeNormal, eventReasonOrphaned, "Orphaned %s %s", kind, obj.GetName())
+		}
+	}
+
+	return nil
+}
+
+// snapshotRedis dumps the Redis data with a Job to a claim that outlives the MyAppResource. It returns
+// true once the dump completed, or when there is no Redis to dump. A failed Job is reported as an
+// error until it is deleted, to retry, or the deletionPolicy is changed.
+func (r *MyAppResourceReconciler) snapshotRedis(ctx context.Context, myAppResource v1beta1.MyAppResource, log logr.Logger) (bool, error) {
+	if !myAppResource.Spec.Redis.Enabled {
+		return true, nil
+	}
+
+	claim := redis.ConstructRedisSnapshotPersistentVolumeClaim(myAppResource, r.Config)
+	err := r.Create(ctx, claim)
+	if errors.HasStatusCause(err, corev1.NamespaceTerminatingCause) {
+		// the namespace and Redis with it are going away, do not hold them up
+		log.Info("skipping Redis snapshot in a terminating namespace", "myappresource", myAppResource.Name)
+		return true, nil
+	}
+	if client.IgnoreAlreadyExists(err) != nil {
+		log.Error(err, "unable to create Redis snapshot PersistentVolumeClaim", "persistentvolumeclaim", claim.Name)
+		return false, err
+	}
+
+	job := &batchv1.Job{}
+	err = r.Get(ctx, client.ObjectKey{Namespace: myAppResource.Namespace, Name: redis.GetSnapshotName(myAppResource.Name)}, job)
+	if errors.IsNotFound(err) {
+		job = redis.ConstructRedisSnapshotJob(myAppResource, r.Config)
+		if err := r.Create(ctx, job); err != nil {
+			log.Error(err, "unable to create Redis snapshot Job", "job", job.Name)
+			return false, err
+		}
+		log.V(1).Info("created Redis snapshot Job for MyAppResource", "myappresource", myAppResource.Name, "job", job.Name)
+		r.recordEvent(&myAppResource, corev1.EventTypeNormal, eventReasonSnapshotStarted,
+			"Started Job %s dumping Redis to PersistentVolumeClaim %s", job.Name, claim.Name)
+		return false, nil
+	}
+	if err != nil {
+		log.Error(err, "unable to fetch Redis snapshot Job", "job", job.Name)
+		return false, err
+	}
+
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobComplete:
+			log.V(1).Info("Redis snapshot completed", "myappresource", myAppResource.Name, "persistentvolumeclaim", claim.Name)
+			r.recordEvent(&myAppResource, corev1.EventTypeNormal, eventReasonSnapshotCompleted,
+				"Dumped Redis to PersistentVolumeClaim %s", claim.Name)
+			return true, nil
+		case batchv1.JobFailed:
+			r.recordEvent(&myAppResource, corev1.EventTypeWarning, eventReasonSnapshotFailed, "Job %s failed: %s", job.Name, condition.Message)
+			return false, fmt.Errorf("redis snapshot Job %s failed: %s, delete it to retry or set spec.deletionPolicy to Delete",
+				job.Name, condition.Message)
+		}
+	}
+
+	return false, nil
+}
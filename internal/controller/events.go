@@ -0,0 +1,135 @@
+package controller
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/domenicbove/angi/api/v1beta1"
+)
+
+// Event reasons recorded on the MyAppResource and RedisCache. They are part of the operator interface, alerts
+// select events by them, so they must not change.
+const (
+	// eventReasonCreated is recorded when the operator creates a child object.
+	eventReasonCreated = "Created"
+	// eventReasonUpdated is recorded when the operator changes a child object.
+	eventReasonUpdated = "Updated"
+	// eventReasonDeleted is recorded when the operator deletes a child object that is no longer needed.
+	eventReasonDeleted = "Deleted"
+	// eventReasonOrphaned is recorded when a child object is left running by the Orphan deletionPolicy.
+	eventReasonOrphaned = "Orphaned"
+	// eventReasonDriftCorrected is recorded when the operator reverts changes made to a child object by others.
+	eventReasonDriftCorrected = "DriftCorrected"
+
+	// eventReasonRedisEnabled is recorded when Redis is first reported in the status.
+	eventReasonRedisEnabled = "RedisEnabled"
+	// eventReasonRedisDisabled is recorded when Redis is no longer reported in the status.
+	eventReasonRedisDisabled = "RedisDisabled"
+
+	// eventReasonPaused is recorded when the MyAppResource is first reported as paused.
+	eventReasonPaused = "Paused"
+	// eventReasonResumed is recorded when the MyAppResource is no longer reported as paused.
+	eventReasonResumed = "Resumed"
+
+	// eventReasonCanaryStarted is recorded when a changed PodInfo image starts a canary rollout.
+	eventReasonCanaryStarted = "CanaryStarted"
+	// eventReasonCanaryPromoted is recorded when the last canary step is complete and the image is promoted.
+	eventReasonCanaryPromoted = "CanaryPromoted"
+	// eventReasonCanaryAborted is recorded when a canary rollout is aborted, by hand or because it stalled.
+	eventReasonCanaryAborted = "CanaryAborted"
+
+	// eventReasonSnapshotStarted is recorded when the Snapshot deletionPolicy starts the Redis dump.
+	eventReasonSnapshotStarted = "SnapshotStarted"
+	// eventReasonSnapshotCompleted is recorded when the Redis dump completed.
+	eventReasonSnapshotCompleted = "SnapshotCompleted"
+	// eventReasonSnapshotFailed is recorded while the Redis dump Job is failed.
+	eventReasonSnapshotFailed = "SnapshotFailed"
+
+	// eventReasonReconcileFailed is recorded when a reconcile returns an error.
+	eventReasonReconcileFailed = "ReconcileFailed"
+)
+
+// warningReasons are the condition reasons recorded as a Warning when a condition changes to them.
+var warningReasons = map[string]bool{
+	v1beta1.ReasonProgressDeadlineExceeded: true,
+	v1beta1.ReasonReplicaFailure:           true,
+	v1beta1.ReasonClaimLost:                true,
+	v1beta1.ReasonImageNotAllowed:          true,
+	v1beta1.ReasonRedisCacheFull:           true,
+	v1beta1.ReasonNoFreeDatabase:           true,
+}
+
+// recordEvent records an event on the MyAppResource or RedisCache obj belongs to. obj is either the
+// owner itself or one of its child objects, a child that is controlled by neither is ignored.
+func (a *applier) recordEvent(obj client.Object, eventType, reason, messageFmt string, args ...interface{}) {
+	if a.recorder == nil {
+		return
+	}
+
+	owner := obj
+	switch obj.(type) {
+	case *v1beta1.MyAppResource, *v1beta1.RedisCache:
+	default:
+		ref := metav1.GetControllerOf(obj)
+		if ref == nil {
+			return
+		}
+		objectMeta := metav1.ObjectMeta{Name: ref.Name, Namespace: obj.GetNamespace(), UID: ref.UID}
+		switch ref.Kind {
+		case "MyAppResource":
+			owner = &v1beta1.MyAppResource{ObjectMeta: objectMeta}
+		case "RedisCache":
+			owner = &v1beta1.RedisCache{ObjectMeta: objectMeta}
+		default:
+			return
+		}
+	}
+
+	a.recorder.Eventf(owner, eventType, reason, messageFmt, args...)
+}
+
+// recordStatusEvents records the changes between the old and updated status of the MyAppResource: Redis
+// being enabled or disabled, pausing and resuming, and every other condition that changes its status. The condition reason is
+// recorded as the event reason, as a Warning for a stalled rollout, a lost claim, an image policy violation or Degraded.
+func (r *MyAppResourceReconciler) recordStatusEvents(myAppResource *v1beta1.MyAppResource, old, updated v1beta1.MyAppResourceStatus) {
+	hadRedis := meta.FindStatusCondition(old.Conditions, v1beta1.ConditionTypeRedisReady) != nil
+	hasRedis := meta.FindStatusCondition(updated.Conditions, v1beta1.ConditionTypeRedisReady) != nil
+	switch {
+	case !hadRedis && hasRedis:
+		r.recordEvent(myAppResource, corev1.EventTypeNormal, eventReasonRedisEnabled, "Redis is enabled")
+	case hadRedis && !hasRedis:
+		r.recordEvent(myAppResource, corev1.EventTypeNormal, eventReasonRedisDisabled, "Redis is disabled")
+	}
+
+	wasPaused := meta.IsStatusConditionTrue(old.Conditions, v1beta1.ConditionTypePaused)
+	paused := meta.IsStatusConditionTrue(updated.Conditions, v1beta1.ConditionTypePaused)
+	switch {
+	case !wasPaused && paused:
+		r.recordEvent(myAppResource, corev1.EventTypeNormal, eventReasonPaused, "Paused, child objects are not changed")
+	case wasPaused && !paused:
+		r.recordEvent(myAppResource, corev1.EventTypeNormal, eventReasonResumed, "Resumed, child objects are brought back to the desired state")
+	}
+
+	for _, condition := range updated.Conditions {
+		if condition.Type == v1beta1.ConditionTypePaused {
+			continue
+		}
+
+		warning := warningReasons[condition.Reason] ||
+			(condition.Type == v1beta1.ConditionTypeDegraded && condition.Status == metav1.ConditionTrue)
+
+		// a condition showing up in its expected state is not worth an event, the first reconcile sets them all
+		previous := meta.FindStatusCondition(old.Conditions, condition.Type)
+		if previous == nil && !warning || previous != nil && previous.Status == condition.Status {
+			continue
+		}
+
+		eventType := corev1.EventTypeNormal
+		if warning {
+			eventType = corev1.EventTypeWarning
+		}
+		r.recordEvent(myAppResource, eventType, condition.Reason, "%s is %s: %s", condition.Type, condition.Status, condition.Message)
+	}
+}
@@ -0,0 +1,25 @@
+package controller
+
+import (
+	"github.com/domenicbove/angi/api/v1beta1"
+	"github.com/domenicbove/angi/internal/podinfo"
+	"github.com/domenicbove/angi/internal/redis"
+)
+
+// checkImagePolicy returns why the images of the MyAppResource are not allowed by the ImagePolicy,
+// nothing when they all are. The Redis image is only checked while Redis is enabled.
+func (r *MyAppResourceReconciler) checkImagePolicy(myAppResource v1beta1.MyAppResource) []string {
+	images := []string{podinfo.GetImage(myAppResource, r.Config)}
+	if myAppResource.Spec.Redis.Enabled {
+		images = append(images, redis.GetImage(myAppResource, r.Config))
+	}
+
+	var violations []string
+	for _, image := range images {
+		if err := r.ImagePolicy.Check(image); err != nil {
+			violations = append(violations, err.Error())
+		}
+	}
+
+	return violations
+}
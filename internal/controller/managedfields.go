@@ -0,0 +1,220 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// appliedFields returns the fields manager applied, as the FieldsV1 tree of its managedFields entry,
+// or nil when manager applied none.
+func appliedFields(managedFields []metav1.ManagedFieldsEntry, manager string) map[string]interface{} {
+	for _, entry := range managedFields {
+		if entry.Manager != manager || entry.Operation != metav1.ManagedFieldsOperationApply || entry.FieldsV1 == nil {
+			continue
+		}
+		fields := map[string]interface{}{}
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			continue
+		}
+		return fields
+	}
+	return nil
+}
+
+// ownsField returns true when manager applied the field at path, given as FieldsV1 keys such as "f:spec".
+func ownsField(managedFields []metav1.ManagedFieldsEntry, manager string, path ...string) bool {
+	fields := appliedFields(managedFields, manager)
+	if fields == nil {
+		return false
+	}
+	for _, key := range path {
+		child, ok := fields[key].(map[string]interface{})
+		if !ok {
+			return false
+		}
+		fields = child
+	}
+	return true
+}
+
+// appliedAsDesired returns true when applying desired as manager would leave existing as it is: every
+// field desired sets has its value in existing and is applied by manager, and manager applied no field
+// that desired leaves out.
+// Only the fields of manager are compared, so values defaulted by the API server or added by others
+// do not count. API servers before Kubernetes 1.27 write an apply that only moves the managedFields
+// timestamps, which wakes up every watcher of the object, so such an apply is not sent.
+func appliedAsDesired(existing, desired client.Object, manager string) (bool, error) {
+	fields := appliedFields(existing.GetManagedFields(), manager)
+	if fields == nil {
+		return false, nil
+	}
+
+	existingContent, err := runtime.DefaultUnstructuredConverter.ToUnstructured(existing)
+	if err != nil {
+		return false, err
+	}
+	desiredContent, err := runtime.DefaultUnstructuredConverter.ToUnstructured(desired)
+	if err != nil {
+		return false, err
+	}
+	// the identity of the object and its status are not applied
+	delete(desiredContent, "apiVersion")
+	delete(desiredContent, "kind")
+	delete(desiredContent, "status")
+	if metadata, ok := desiredContent["metadata"].(map[string]interface{}); ok {
+		delete(metadata, "name")
+		delete(metadata, "namespace")
+	}
+
+	return hasValues(existingContent, desiredContent) && setsFields(desiredContent, fields) &&
+		ownsFields(desiredContent, fields), nil
+}
+
+// hasValues returns true when every value set in desired has the same value in existing. List items
+// are matched in order, so items added by others in between are skipped.
+func hasValues(existing, desired interface{}) bool {
+	switch desired := desired.(type) {
+	case nil:
+		return true
+	case map[string]interface{}:
+		existing, ok := existing.(map[string]interface{})
+		if !ok {
+			return existing == nil && len(desired) == 0
+		}
+		for key, value := range desired {
+			if !hasValues(existing[key], value) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		existing, ok := existing.([]interface{})
+		if !ok {
+			return existing == nil && len(desired) == 0
+		}
+		next := 0
+		for _, item := range desired {
+			for next < len(existing) && !hasValues(existing[next], item) {
+				next++
+			}
+			if next == len(existing) {
+				return false
+			}
+			next++
+		}
+		return true
+	default:
+		return reflect.DeepEqual(existing, desired)
+	}
+}
+
+// ownsFields returns true when the FieldsV1 tree fields holds every field desired sets. The items of a
+// list are not compared, how they are keyed depends on the schema of the list.
+func ownsFields(desired map[string]interface{}, fields map[string]interface{}) bool {
+	for key, value := range desired {
+		if value == nil {
+			continue
+		}
+		childFields, ok := fields["f:"+key].(map[string]interface{})
+		if !ok {
+			return false
+		}
+		// an atomic field, such as a selector, is owned as a whole
+		if object, ok := value.(map[string]interface{}); ok && len(childFields) > 0 && !ownsFields(object, childFields) {
+			return false
+		}
+	}
+	return true
+}
+
+// setsFields returns true when desired sets every field of the FieldsV1 tree fields.
+func setsFields(desired interface{}, fields map[string]interface{}) bool {
+	for key, child := range fields {
+		childFields, _ := child.(map[string]interface{})
+		switch {
+		case key == ".":
+			continue
+		case strings.HasPrefix(key, "f:"):
+			// a field applied as null, such as the creationTimestamp of a pod template, is set as well
+			object, ok := desired.(map[string]interface{})
+			if !ok {
+				return false
+			}
+			value, ok := object[strings.TrimPrefix(key, "f:")]
+			if !ok || !setsFields(value, childFields) {
+				return false
+			}
+		case strings.HasPrefix(key, "k:"), strings.HasPrefix(key, "v:"), strings.HasPrefix(key, "i:"):
+			item, ok := listItem(desired, key)
+			if !ok || !setsFields(item, childFields) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// listItem returns the item of the desired list a FieldsV1 key of a list item points to: "k:" names
+// the keys of an item, "v:" its value and "i:" its index.
+func listItem(desired interface{}, key string) (interface{}, bool) {
+	list, ok := desired.([]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	switch key[:2] {
+	case "i:":
+		index, err := strconv.Atoi(key[2:])
+		if err != nil || index < 0 || index >= len(list) {
+			return nil, false
+		}
+		return list[index], true
+	case "v:":
+		for _, item := range list {
+			if value, err := json.Marshal(item); err == nil && jsonEqual(value, []byte(key[2:])) {
+				return item, true
+			}
+		}
+	case "k:":
+		itemKeys := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(key[2:]), &itemKeys); err != nil {
+			return nil, false
+		}
+		for _, item := range list {
+			object, ok := item.(map[string]interface{})
+			if ok && hasKeys(object, itemKeys) {
+				return item, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// hasKeys returns true when the list item has the values of itemKeys. A key the item leaves out is
+// defaulted by the API server, such as the protocol of a port, so it is not compared.
+func hasKeys(item, itemKeys map[string]interface{}) bool {
+	for key, value := range itemKeys {
+		if itemValue, ok := item[key]; ok && fmt.Sprint(itemValue) != fmt.Sprint(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// jsonEqual returns true when both JSON documents hold the same value.
+func jsonEqual(a, b []byte) bool {
+	var valueA, valueB interface{}
+	if json.Unmarshal(a, &valueA) != nil || json.Unmarshal(b, &valueB) != nil {
+		return false
+	}
+	return reflect.DeepEqual(valueA, valueB)
+}
@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/domenicbove/angi/api/v1beta1"
+)
+
+// Components of a MyAppResource, the component label of the replica metrics.
+const (
+	componentPodInfo = "podinfo"
+	componentRedis   = "redis"
+)
+
+// Phases of a reconcile, the phase label of the reconcile errors metric.
+const (
+	phaseGet      = "get"
+	phaseFinalize = "finalize"
+	phaseRedis    = "redis"
+	phasePodInfo  = "podinfo"
+	phaseStatus   = "status"
+)
+
+var (
+	desiredReplicas = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "myappresource_desired_replicas",
+		Help: "Number of replicas a MyAppResource component should run.",
+	}, []string{"namespace", "name", "component"})
+
+	readyReplicas = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "myappresource_ready_replicas",
+		Help: "Number of ready replicas of a MyAppResource component.",
+	}, []string{"namespace", "name", "component"})
+
+	redisEnabled = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "myappresource_redis_enabled",
+		Help: "Whether the operator manages a Redis for a MyAppResource, 1 when it does.",
+	}, []string{"namespace", "name"})
+
+	reconcileErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "myappresource_reconcile_errors_total",
+		Help: "Number of reconciles of a MyAppResource that failed, by the phase they failed in.",
+	}, []string{"namespace", "name", "phase"})
+
+	lastSuccessfulReconcile = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "myappresource_last_successful_reconcile_timestamp_seconds",
+		Help: "Unix time of the last reconcile of a MyAppResource that succeeded, including the status refresh while it is held.",
+	}, []string{"namespace", "name"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(desiredReplicas, readyReplicas, redisEnabled, reconcileErrors, lastSuccessfulReconcile)
+}
+
+// recordReconcileError counts a reconcile of the MyAppResource that failed in phase.
+func recordReconcileError(namespace, name, phase string) {
+	reconcileErrors.WithLabelValues(namespace, name, phase).Inc()
+}
+
+// recordReplicas updates the replica metrics of the MyAppResource. Redis replicas are only
+// reported while the operator manages a Redis for it, not for a RedisCache or an external Redis.
+func recordReplicas(myAppResource v1beta1.MyAppResource, podInfoDesired, podInfoReady int32, redis *redisState) {
+	namespace, name := myAppResource.Namespace, myAppResource.Name
+
+	desiredReplicas.WithLabelValues(namespace, name, componentPodInfo).Set(float64(podInfoDesired))
+	readyReplicas.WithLabelValues(namespace, name, componentPodInfo).Set(float64(podInfoReady))
+	if redis != nil && redis.source == v1beta1.RedisSourceManaged {
+		redisEnabled.WithLabelValues(namespace, name).Set(1)
+		desiredReplicas.WithLabelValues(namespace, name, componentRedis).Set(float64(redis.desiredReplicas))
+		readyReplicas.WithLabelValues(namespace, name, componentRedis).Set(float64(redis.readyReplicas))
+	} else {
+		redisEnabled.WithLabelValues(namespace, name).Set(0)
+		desiredReplicas.DeleteLabelValues(namespace, name, componentRedis)
+		readyReplicas.DeleteLabelValues(namespace, name, componentRedis)
+	}
+}
+
+// recordReconcileSuccess records the time of a reconcile of the MyAppResource that succeeded.
+func recordReconcileSuccess(namespace, name string) {
+	lastSuccessfulReconcile.WithLabelValues(namespace, name).SetToCurrentTime()
+}
+
+// deleteMetrics removes the series of a MyAppResource that no longer exists.
+func deleteMetrics(namespace, name string) {
+	labels := prometheus.Labels{"namespace": namespace, "name": name}
+	for _, vec := range []interface {
+		DeletePartialMatch(prometheus.Labels) int
+	}{desiredReplicas, readyReplicas, redisEnabled, reconcileErrors, lastSuccessfulReconcile} {
+		vec.DeletePartialMatch(labels)
+	}
+}
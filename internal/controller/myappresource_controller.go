@@ -2,20 +2,30 @@ package controller
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/go-logr/logr"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
-	"github.com/domenicbove/angi/api/v1alpha1"
+	"github.com/domenicbove/angi/api/v1beta1"
+	"github.com/domenicbove/angi/internal/config"
+	"github.com/domenicbove/angi/internal/imagepolicy"
 	"github.com/domenicbove/angi/internal/podinfo"
 	"github.com/domenicbove/angi/internal/redis"
 )
@@ -24,14 +34,38 @@ import (
 type MyAppResourceReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+	// RedisInspector queries the Redis replication state. When nil, the primary is not asked
+	// from Sentinel and the replicas in sync are not reported.
+	RedisInspector redis.Inspector
+	// Recorder records events on the MyAppResource about its child objects, status changes and
+	// reconcile failures. When nil, no events are recorded.
+	Recorder record.EventRecorder
+	// Config holds the defaults the child objects are built with. It must be defaulted, see config.New.
+	Config config.OperatorConfig
+	// ImagePolicy restricts the images of the child objects. A MyAppResource with an image it does not
+	// allow is held like a paused one, until the image is changed.
+	ImagePolicy imagepolicy.Policy
+
+	applier
 }
 
 //+kubebuilder:rbac:groups=my.api.group,resources=myappresources,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=my.api.group,resources=myappresources/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=my.api.group,resources=myappresources/finalizers,verbs=update
-//+kubebuilder:rbac:groups=apps,resources=deployments,verbs=list;watch;get;patch;create;update
+//+kubebuilder:rbac:groups=my.api.group,resources=rediscaches,verbs=get;list;watch
+//+kubebuilder:rbac:groups=apps,resources=deployments,verbs=list;watch;get;patch;create;update;delete
 //+kubebuilder:rbac:groups=apps,resources=deployments/status,verbs=get
-//+kubebuilder:rbac:groups=core,resources=services,verbs=list;watch;get;patch;create;update
+//+kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=list;watch;get;patch;create;update;delete
+//+kubebuilder:rbac:groups=apps,resources=statefulsets/status,verbs=get
+//+kubebuilder:rbac:groups=core,resources=services,verbs=list;watch;get;patch;create;update;delete
+//+kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=list;watch;get;patch;create;update;delete
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=list;watch;get;patch;create;update;delete
+//+kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=list;watch;get;patch;create;update;delete
+//+kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=list;watch;get;create
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=list;watch;get;patch;create;update;delete
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=list;watch;get;patch;create
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=list;watch;get;patch
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -39,170 +73,187 @@ func (r *MyAppResourceReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 	log := log.FromContext(ctx)
 
 	// get myappresource cr
-	var myAppResource v1alpha1.MyAppResource
+	var myAppResource v1beta1.MyAppResource
 	if err := r.Get(ctx, req.NamespacedName, &myAppResource); err != nil {
 		log.Error(err, "unable to fetch MyAppResource")
 		// we'll ignore not-found errors, since they can't be fixed by an immediate
 		// requeue (we'll need to wait for a new notification), and we can get them
 		// on deleted requests.
-		return ctrl.Result{}, client.IgnoreNotFound(err)
-	}
-
-	// in the case someone disables redis after enabling it, it should be cleaned up
-	if myAppResource.Spec.Redis == nil || !myAppResource.Spec.Redis.Enabled {
-		name := redis.GetDeploymentName(myAppResource.Name)
-		lookupKey := client.ObjectKey{Namespace: myAppResource.Namespace, Name: name}
-
-		redisDeployment := appsv1.Deployment{}
-		err := r.Client.Get(ctx, lookupKey, &redisDeployment)
-		if client.IgnoreNotFound(err) != nil {
-			log.Error(err, "unable to fetch Redis Deployment")
-		}
-		if err == nil {
-			// deployment was fetched successfully, should be deleted
-			if err := r.Delete(ctx, &redisDeployment); err != nil {
-				return ctrl.Result{}, err
-			}
-			log.V(1).Info("deleted Deployment for MyAppResource", "myappresource", myAppResource.Name, "deployment", name)
-		}
-
-		redisService := corev1.Service{}
-		err = r.Client.Get(ctx, lookupKey, &redisService)
-		if client.IgnoreNotFound(err) != nil {
-			log.Error(err, "unable to fetch Redis Service")
-		}
-		if err == nil {
-			// service was fetched successfully, should be deleted
-			if err := r.Delete(ctx, &redisService); err != nil {
-				return ctrl.Result{}, err
-			}
-			log.V(1).Info("deleted Service for MyAppResource", "myappresource", myAppResource.Name, "service", name)
+		if errors.IsNotFound(err) {
+			deleteMetrics(req.Namespace, req.Name)
+			return ctrl.Result{}, nil
 		}
+		recordReconcileError(req.Namespace, req.Name, phaseGet)
+		return ctrl.Result{}, err
 	}
 
-	// create or update the redis deployment and service
-	var redisDeployment *appsv1.Deployment
-	if myAppResource.Spec.Redis != nil && myAppResource.Spec.Redis.Enabled {
-
-		redisName := redis.GetDeploymentName(myAppResource.Name)
+	result, err := r.reconcile(ctx, myAppResource, log)
+	// a conflict only means a newer version of an object is being reconciled, it is not worth alerting on
+	if err != nil && !errors.IsConflict(err) {
+		r.recordEvent(&myAppResource, corev1.EventTypeWarning, eventReasonReconcileFailed, "Reconcile failed: %v", err)
+	}
 
-		var err error
-		redisDeployment, err = r.createOrUpdateDeployment(ctx, redisName, myAppResource.Namespace,
-			redis.ConstructRedisDeployment(myAppResource), log)
+	return result, err
+}
 
-		if err != nil {
+// reconcile moves the child objects and status of the fetched MyAppResource to the desired state.
+func (r *MyAppResourceReconciler) reconcile(ctx context.Context, myAppResource v1beta1.MyAppResource, log logr.Logger) (ctrl.Result, error) {
+	// carry out the deletion policy before the MyAppResource goes away
+	if !myAppResource.DeletionTimestamp.IsZero() {
+		if err := r.finalize(ctx, myAppResource, log); err != nil {
+			recordReconcileError(myAppResource.Namespace, myAppResource.Name, phaseFinalize)
 			return ctrl.Result{}, err
 		}
+		return ctrl.Result{}, nil
+	}
+	if err := r.addFinalizer(ctx, &myAppResource, log); err != nil {
+		recordReconcileError(myAppResource.Namespace, myAppResource.Name, phaseFinalize)
+		return ctrl.Result{}, err
+	}
 
-		if err := r.createOrUpdateService(ctx, redisName, myAppResource.Namespace,
-			redis.ConstructRedisService(myAppResource), log); err != nil {
-
-			return ctrl.Result{}, err
-		}
+	// while paused only the status is refreshed, so the child objects can be changed by hand
+	if isPaused(myAppResource) {
+		log.V(1).Info("MyAppResource is paused, only refreshing its status", "myappresource", myAppResource.Name)
+		return ctrl.Result{}, r.refreshStatus(ctx, myAppResource, log)
 	}
 
-	// create or update the podInfo deployment
-	podInfoDeployment, err := r.createOrUpdateDeployment(ctx, myAppResource.Name,
-		myAppResource.Namespace, podinfo.ConstructPodInfoDeployment(myAppResource), log)
+	// images the policy does not allow are never rolled out, the child objects keep what they run
+	if violations := r.checkImagePolicy(myAppResource); len(violations) > 0 {
+		log.Info("MyAppResource violates the image policy, only refreshing its status", "myappresource", myAppResource.Name,
+			"violations", violations)
+		return ctrl.Result{}, r.refreshStatus(ctx, myAppResource, log)
+	}
 
+	// create, update or clean up redis
+	redisState, err := r.reconcileRedis(ctx, myAppResource, log)
+	if err == nil {
+		err = r.reconcileEncodedRedisPassword(ctx, myAppResource, redisState, log)
+	}
 	if err != nil {
+		recordReconcileError(myAppResource.Namespace, myAppResource.Name, phaseRedis)
 		return ctrl.Result{}, err
 	}
 
-	// update the CR status
-	updateStatus := false
-	if redisDeployment != nil && redisDeployment.Status.ReadyReplicas != myAppResource.Status.RedisReadyReplicas {
-		updateStatus = true
-		myAppResource.Status.RedisReadyReplicas = redisDeployment.Status.ReadyReplicas
+	// create, update or clean up the podInfo objects, which cache in the redis when there is one
+	var connection *redis.Connection
+	if redisState != nil {
+		connection = redisState.connection
 	}
-	if myAppResource.Status.PodInfoReadyReplicas != podInfoDeployment.Status.ReadyReplicas {
-		updateStatus = true
-		myAppResource.Status.PodInfoReadyReplicas = podInfoDeployment.Status.ReadyReplicas
+	podInfo, err := r.reconcilePodInfo(ctx, myAppResource, connection, log)
+	if err != nil {
+		recordReconcileError(myAppResource.Namespace, myAppResource.Name, phasePodInfo)
+		return ctrl.Result{}, err
 	}
 
-	if updateStatus {
-		log.V(1).Info("updating MyAppResource status", "myappresource", myAppResource.Name)
+	// update the CR status
+	if err := r.updateStatus(ctx, myAppResource, podInfo, redisState); err != nil {
+		log.Error(err, "failed to update MyAppResource status", "myappresource", myAppResource.Name)
+		recordReconcileError(myAppResource.Namespace, myAppResource.Name, phaseStatus)
+		return ctrl.Result{}, err
+	}
 
-		if r.Client.Status().Update(ctx, &myAppResource); err != nil {
-			log.Error(err, "failed to update MyAppResource status", "myappresource", myAppResource.Name)
+	// the canary action is only removed once the status records that it was carried out
+	if podInfo.canary.clearAction {
+		if err := r.removeCanaryAnnotation(ctx, myAppResource, log); err != nil {
+			recordReconcileError(myAppResource.Namespace, myAppResource.Name, phasePodInfo)
 			return ctrl.Result{}, err
 		}
 	}
+	recordReconcileSuccess(myAppResource.Namespace, myAppResource.Name)
 
-	return ctrl.Result{}, nil
+	result := ctrl.Result{RequeueAfter: podInfo.canary.requeueAfter}
+	if myAppResource.Spec.Redis.Enabled && redis.IsReplicated(myAppResource) &&
+		(result.RequeueAfter == 0 || redisReplicationSyncPeriod < result.RequeueAfter) {
+		result.RequeueAfter = redisReplicationSyncPeriod
+	}
+
+	return result, nil
 }
 
-func (r *MyAppResourceReconciler) createOrUpdateDeployment(ctx context.Context, name, namespace string, updatedDeployment *appsv1.Deployment, log logr.Logger) (*appsv1.Deployment, error) {
-	// get existing deployment
-	deployment := appsv1.Deployment{}
-	err := r.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, &deployment)
-	if errors.IsNotFound(err) {
-		// if it does not exist, create in next step
-		deployment = *updatedDeployment
-	}
-	if client.IgnoreNotFound(err) != nil {
-		log.Error(err, "failed to get Deployment for MyAppResource", "myappresource", name, "deployment", deployment.Name)
+// podInfoState is the observed state of PodInfo, reported in the MyAppResource status.
+type podInfoState struct {
+	// deployment is the stable PodInfo Deployment, nil when it does not exist.
+	deployment *appsv1.Deployment
+	// canary is the canary rollout of the PodInfo image.
+	canary canaryPlan
+}
+
+// reconcilePodInfo creates or updates the PodInfo objects that match the spec, and removes
+// the optional ones that are no longer set. PodInfo caches in the Redis of connection, when
+// it is not nil. It returns the applied PodInfo Deployment and the canary rollout it is part of.
+func (r *MyAppResourceReconciler) reconcilePodInfo(ctx context.Context, myAppResource v1beta1.MyAppResource, connection *redis.Connection, log logr.Logger) (*podInfoState, error) {
+	plan, err := r.planCanary(ctx, myAppResource, log)
+	if err != nil {
 		return nil, err
 	}
 
-	specr := deploymentSpecr(&deployment, updatedDeployment.Spec)
-
-	if operation, err := controllerutil.CreateOrUpdate(ctx, r.Client, &deployment, specr); err != nil {
-		log.Error(err, "unable to create or update Deployment for MyAppResource", "myappresource", name, "deployment", deployment.Name)
+	// create or update the podInfo deployment, which keeps the stable image during a canary rollout
+	desiredDeployment := podinfo.ConstructPodInfoDeployment(myAppResource, r.Config, connection)
+	desiredDeployment.Spec.Template.Spec.Containers[0].Image = plan.stableImage
+	desiredDeployment.Spec.Replicas = plan.stableReplicas
+	podInfoDeployment, err := r.createOrUpdateDeployment(ctx, myAppResource.Name,
+		myAppResource.Namespace, desiredDeployment, log)
+	if err != nil {
 		return nil, err
-	} else {
-		log.V(1).Info(fmt.Sprintf("%s Deployment for MyAppResource", operation), "myappresource", name, "deployment", deployment.Name)
 	}
 
-	return &deployment, nil
-}
-
-func deploymentSpecr(deploy *appsv1.Deployment, spec appsv1.DeploymentSpec) controllerutil.MutateFn {
-	return func() error {
-		deploy.Spec = spec
-		return nil
+	// create, update or clean up the podInfo canary deployment
+	canaryLookupKey := client.ObjectKey{Namespace: myAppResource.Namespace, Name: podinfo.GetCanaryName(myAppResource.Name)}
+	if !plan.active() {
+		if err := r.deleteIfExists(ctx, canaryLookupKey, &appsv1.Deployment{}, log); err != nil {
+			return nil, err
+		}
+	} else if _, err := r.createOrUpdate(ctx, podinfo.ConstructPodInfoCanaryDeployment(myAppResource, r.Config, connection, plan.canaryReplicas), log); err != nil {
+		return nil, err
 	}
-}
 
-func (r *MyAppResourceReconciler) createOrUpdateService(ctx context.Context, name, namespace string, updatedService *corev1.Service, log logr.Logger) error {
-	// get existing service
-	service := corev1.Service{}
-	err := r.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, &service)
-	if errors.IsNotFound(err) {
-		// if it does not exist, create in next step
-		service = *updatedService
-	}
-	if client.IgnoreNotFound(err) != nil {
-		log.Error(err, "failed to get Service for MyAppResource", "myappresource", name, "service", service.Name)
-		return err
+	// create or update the podInfo service
+	if _, err := r.createOrUpdate(ctx, podinfo.ConstructPodInfoService(myAppResource), log); err != nil {
+		return nil, err
 	}
 
-	specr := serviceSpecr(&service, updatedService.Spec)
-
-	if operation, err := controllerutil.CreateOrUpdate(ctx, r.Client, &service, specr); err != nil {
-		log.Error(err, "unable to create or update Service for MyAppResource", "myappresource", name, "service", service.Name)
-		return err
-	} else {
-		log.V(1).Info(fmt.Sprintf("%s Service for MyAppResource", operation), "myappresource", name, "service", service.Name)
+	// create, update or clean up the podInfo disruption budget
+	pdbLookupKey := client.ObjectKey{Namespace: myAppResource.Namespace, Name: myAppResource.Name}
+	if pdb := podinfo.ConstructPodInfoPodDisruptionBudget(myAppResource); pdb == nil {
+		if err := r.deleteIfExists(ctx, pdbLookupKey, &policyv1.PodDisruptionBudget{}, log); err != nil {
+			return nil, err
+		}
+	} else if _, err := r.createOrUpdate(ctx, pdb, log); err != nil {
+		return nil, err
 	}
 
-	return nil
-}
+	// create, update or clean up the podInfo autoscaler
+	hpaLookupKey := client.ObjectKey{Namespace: myAppResource.Namespace, Name: myAppResource.Name}
+	if myAppResource.Spec.Autoscaling == nil {
+		if err := r.deleteIfExists(ctx, hpaLookupKey, &autoscalingv2.HorizontalPodAutoscaler{}, log); err != nil {
+			return nil, err
+		}
+	} else if _, err := r.createOrUpdate(ctx, podinfo.ConstructPodInfoHorizontalPodAutoscaler(myAppResource), log); err != nil {
+		return nil, err
+	}
 
-func serviceSpecr(service *corev1.Service, spec corev1.ServiceSpec) controllerutil.MutateFn {
-	return func() error {
-		service.Spec = spec
-		return nil
+	// create, update or clean up the podInfo ingress
+	ingressLookupKey := client.ObjectKey{Namespace: myAppResource.Namespace, Name: myAppResource.Name}
+	if myAppResource.Spec.Ingress == nil {
+		// in the case someone removes the ingress after adding it, it should be cleaned up
+		if err := r.deleteIfExists(ctx, ingressLookupKey, &networkingv1.Ingress{}, log); err != nil {
+			return nil, err
+		}
+	} else if _, err := r.createOrUpdate(ctx, podinfo.ConstructPodInfoIngress(myAppResource), log); err != nil {
+		return nil, err
 	}
+
+	return &podInfoState{deployment: podInfoDeployment, canary: plan}, nil
 }
 
 var (
 	jobOwnerKey = ".metadata.controller"
-	apiGVStr    = v1alpha1.GroupVersion.String()
+	apiGroup    = v1beta1.GroupVersion.Group
 )
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *MyAppResourceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.applier = applier{Client: r.Client, recorder: r.Recorder, instanceLabel: r.Config.InstanceLabel()}
 
 	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &appsv1.Deployment{}, jobOwnerKey, func(rawObj client.Object) []string {
 		// grab the deployment object, extract the owner...
@@ -211,8 +262,9 @@ func (r *MyAppResourceReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		if owner == nil {
 			return nil
 		}
-		// ...make sure it's a MyAppResource...
-		if owner.APIVersion != apiGVStr || owner.Kind != "MyAppResource" {
+		// ...make sure it's a MyAppResource of any version...
+		gv, err := schema.ParseGroupVersion(owner.APIVersion)
+		if err != nil || gv.Group != apiGroup || owner.Kind != "MyAppResource" {
 			return nil
 		}
 
@@ -223,7 +275,50 @@ func (r *MyAppResourceReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	}
 
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&v1alpha1.MyAppResource{}).
+		For(&v1beta1.MyAppResource{}).
 		Owns(&appsv1.Deployment{}).
+		Owns(&appsv1.StatefulSet{}).
+		Owns(&corev1.Service{}).
+		Owns(&corev1.Secret{}).
+		Owns(&networkingv1.Ingress{}).
+		Owns(&autoscalingv2.HorizontalPodAutoscaler{}).
+		Owns(&policyv1.PodDisruptionBudget{}).
+		Owns(&batchv1.Job{}).
+		// claims created from the redis volumeClaimTemplate have no owner, so map them by label, or by name
+		// for the claims labeled before the label prefix was changed
+		Watches(&source.Kind{Type: &corev1.PersistentVolumeClaim{}}, handler.EnqueueRequestsFromMapFunc(func(obj client.Object) []reconcile.Request {
+			name, ok := obj.GetLabels()[r.Config.InstanceLabel()]
+			if !ok {
+				name, ok = redis.GetMyAppResourceNameFromClaim(obj.GetName())
+			}
+			if !ok {
+				return nil
+			}
+			return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: name}}}
+		})).
+		// the password of an existingSecretRef, a RedisCache or an external Redis is held in a Secret the
+		// MyAppResource does not own, its percent-encoded copy follows it
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(func(obj client.Object) []reconcile.Request {
+			ctx := context.Background()
+			myAppResources := &v1beta1.MyAppResourceList{}
+			if err := r.List(ctx, myAppResources, client.InNamespace(obj.GetNamespace())); err != nil {
+				return nil
+			}
+			var requests []reconcile.Request
+			for _, myAppResource := range myAppResources.Items {
+				if r.getPasswordSecretName(ctx, myAppResource) == obj.GetName() {
+					requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&myAppResource)})
+				}
+			}
+			return requests
+		})).
+		// a RedisCache lists the MyAppResources using it, with the database each of them is given
+		Watches(&source.Kind{Type: &v1beta1.RedisCache{}}, handler.EnqueueRequestsFromMapFunc(func(obj client.Object) []reconcile.Request {
+			var requests []reconcile.Request
+			for _, consumer := range obj.(*v1beta1.RedisCache).Status.Consumers {
+				requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: consumer.Name}})
+			}
+			return requests
+		})).
 		Complete(r)
 }
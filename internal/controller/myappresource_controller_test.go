@@ -8,15 +8,27 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/domenicbove/angi/api/v1alpha1"
+	"github.com/domenicbove/angi/api/v1beta1"
+	"github.com/domenicbove/angi/internal/config"
 	"github.com/domenicbove/angi/internal/podinfo"
+	"github.com/domenicbove/angi/internal/podspec"
 	"github.com/domenicbove/angi/internal/redis"
 )
 
@@ -144,9 +156,43 @@ var _ = Describe("MyAppResource controller", func() {
 				corev1.EnvVar{Name: podinfo.UIMessageEnvVar, Value: "some message"}))
 			Expect(podInfoDeployment.Status.ReadyReplicas).Should(Equal(int32(0)))
 
+			By("By checking the podInfo service fields")
+			podInfoService := &corev1.Service{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, lookupKey, podInfoService)
+			}, timeout, interval).Should(Succeed())
+
+			Expect(podInfoService.Spec.Type).Should(Equal(corev1.ServiceTypeClusterIP))
+			Expect(podInfoService.Spec.Selector).Should(Equal(map[string]string{"app": MyAppResourceName}))
+			Expect(podInfoService.Spec.Ports).Should(HaveLen(2))
+			Expect(podInfoService.Spec.Ports[0].Port).Should(Equal(int32(9898)))
+			Expect(podInfoService.Spec.Ports[0].TargetPort).Should(Equal(intstr.FromString("http")))
+			Expect(podInfoService.Spec.Ports[1].Port).Should(Equal(int32(9797)))
+			Expect(podInfoService.Spec.Ports[1].TargetPort).Should(Equal(intstr.FromString("http-metrics")))
+
+			By("By checking the myappresource is not ready before the rollout")
+			Eventually(func() (string, error) {
+				err := k8sClient.Get(ctx, lookupKey, createdMyAppResource)
+				if err != nil {
+					return "", err
+				}
+				ready := meta.FindStatusCondition(createdMyAppResource.Status.Conditions, v1beta1.ConditionTypeReady)
+				if ready == nil || ready.Status != metav1.ConditionFalse {
+					return "", nil
+				}
+				return ready.Reason, nil
+			}, timeout, interval).Should(Equal(v1beta1.ReasonPodInfoNotReady))
+			Expect(createdMyAppResource.Status.ObservedGeneration).Should(Equal(createdMyAppResource.Generation))
+			Expect(meta.IsStatusConditionTrue(createdMyAppResource.Status.Conditions, v1beta1.ConditionTypeProgressing)).Should(BeTrue())
+			Expect(meta.IsStatusConditionFalse(createdMyAppResource.Status.Conditions, v1beta1.ConditionTypeDegraded)).Should(BeTrue())
+			Expect(meta.FindStatusCondition(createdMyAppResource.Status.Conditions, v1beta1.ConditionTypeRedisReady)).Should(BeNil())
+
 			By("By updating the podInfo deployment status")
+			podInfoDeployment.Status.ObservedGeneration = podInfoDeployment.Generation
 			podInfoDeployment.Status.ReadyReplicas = int32(2)
 			podInfoDeployment.Status.Replicas = int32(2)
+			podInfoDeployment.Status.UpdatedReplicas = int32(2)
+			podInfoDeployment.Status.AvailableReplicas = int32(2)
 			Expect(k8sClient.Status().Update(ctx, podInfoDeployment)).Should(Succeed())
 
 			By("By checking the myappresource status updated")
@@ -159,6 +205,35 @@ var _ = Describe("MyAppResource controller", func() {
 				return int(createdMyAppResource.Status.PodInfoReadyReplicas), nil
 			}, timeout, interval).Should(Equal(2), "podInfoReadyReplicas in status should match the deployment")
 
+			By("By checking the myappresource conditions updated")
+			Eventually(func() (bool, error) {
+				err := k8sClient.Get(ctx, lookupKey, createdMyAppResource)
+				if err != nil {
+					return false, err
+				}
+				return meta.IsStatusConditionTrue(createdMyAppResource.Status.Conditions, v1beta1.ConditionTypeReady), nil
+			}, timeout, interval).Should(BeTrue())
+			Expect(meta.IsStatusConditionFalse(createdMyAppResource.Status.Conditions, v1beta1.ConditionTypeProgressing)).Should(BeTrue())
+			Expect(meta.IsStatusConditionFalse(createdMyAppResource.Status.Conditions, v1beta1.ConditionTypeDegraded)).Should(BeTrue())
+
+			By("By marking the podInfo rollout as stalled")
+			Expect(k8sClient.Get(ctx, lookupKey, podInfoDeployment)).Should(Succeed())
+			podInfoDeployment.Status.Conditions = []appsv1.DeploymentCondition{{
+				Type:    appsv1.DeploymentProgressing,
+				Status:  corev1.ConditionFalse,
+				Reason:  "ProgressDeadlineExceeded",
+				Message: "ReplicaSet has timed out progressing.",
+			}}
+			Expect(k8sClient.Status().Update(ctx, podInfoDeployment)).Should(Succeed())
+
+			Eventually(func() (bool, error) {
+				err := k8sClient.Get(ctx, lookupKey, createdMyAppResource)
+				if err != nil {
+					return false, err
+				}
+				return meta.IsStatusConditionTrue(createdMyAppResource.Status.Conditions, v1beta1.ConditionTypeDegraded), nil
+			}, timeout, interval).Should(BeTrue())
+			Expect(meta.IsStatusConditionFalse(createdMyAppResource.Status.Conditions, v1beta1.ConditionTypeReady)).Should(BeTrue())
 		})
 
 		It("Should create MyAppResourceName with Defaults", func() {
@@ -198,6 +273,9 @@ var _ = Describe("MyAppResource controller", func() {
 
 			Expect(createdMyAppResource.Spec.UI.Color).Should(Equal("#34577c"))
 			Expect(*createdMyAppResource.Spec.ReplicaCount).Should(Equal(int32(1)))
+			defaultedMyAppResource := &v1beta1.MyAppResource{}
+			Expect(k8sClient.Get(ctx, lookupKey, defaultedMyAppResource)).Should(Succeed())
+			Expect(defaultedMyAppResource.Spec.Image).Should(Equal(v1beta1.Image{Repository: "ghcr.io/stefanprodan/podinfo", Tag: "6.3.4"}))
 
 			By("By checking the podInfo deployment fields")
 			podInfoDeployment := &appsv1.Deployment{}
@@ -213,14 +291,963 @@ var _ = Describe("MyAppResource controller", func() {
 			Expect(*podInfoDeployment.Spec.Replicas).Should(Equal(int32(1)))
 			Expect(len(podInfoDeployment.Spec.Template.Spec.Containers)).Should(Equal(1))
 			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].Name).Should(Equal("podinfo"))
-			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].Image).Should(Equal("ghcr.io/stefanprodan/podinfo:latest"))
+			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].Image).Should(Equal("ghcr.io/stefanprodan/podinfo:6.3.4"))
 			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].Env).Should(ContainElement(
 				corev1.EnvVar{Name: podinfo.UIColorEnvVar, Value: "#34577c"}))
 			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].Env).Should(ContainElement(
 				corev1.EnvVar{Name: podinfo.UIMessageEnvVar, Value: "some message"}))
+			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].LivenessProbe.HTTPGet.Path).Should(Equal("/healthz"))
+			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].ReadinessProbe.HTTPGet.Path).Should(Equal("/readyz"))
+			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].ReadinessProbe.HTTPGet.Port).Should(Equal(intstr.FromInt(9898)))
+			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].StartupProbe).Should(BeNil())
+
+			By("By checking the pods meet the restricted pod security standard")
+			podSecurityContext := podInfoDeployment.Spec.Template.Spec.SecurityContext
+			Expect(*podSecurityContext.RunAsNonRoot).Should(BeTrue())
+			Expect(podSecurityContext.SeccompProfile.Type).Should(Equal(corev1.SeccompProfileTypeRuntimeDefault))
+			securityContext := podInfoDeployment.Spec.Template.Spec.Containers[0].SecurityContext
+			Expect(*securityContext.AllowPrivilegeEscalation).Should(BeFalse())
+			Expect(*securityContext.ReadOnlyRootFilesystem).Should(BeTrue())
+			Expect(securityContext.Capabilities.Drop).Should(Equal([]corev1.Capability{"ALL"}))
+			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].VolumeMounts).Should(ContainElement(
+				corev1.VolumeMount{Name: podspec.TmpVolumeName, MountPath: podspec.TmpMountPath}))
+
+			By("By checking the instance label is set on the deployment and its pods, but not in its selector")
+			instanceLabel := config.New().InstanceLabel()
+			Expect(podInfoDeployment.Labels).Should(HaveKeyWithValue(instanceLabel, MyAppResourceName))
+			Expect(podInfoDeployment.Spec.Template.Labels).Should(HaveKeyWithValue(instanceLabel, MyAppResourceName))
+			Expect(podInfoDeployment.Spec.Selector.MatchLabels).ShouldNot(HaveKey(instanceLabel))
+			podInfoService := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, lookupKey, podInfoService)).Should(Succeed())
+			Expect(podInfoService.Labels).Should(HaveKeyWithValue(instanceLabel, MyAppResourceName))
+			Expect(podInfoService.Spec.Selector).ShouldNot(HaveKey(instanceLabel))
+		})
+
+		It("Should replace the default podInfo security contexts with the ones of the spec", func() {
+			By("By creating a new MyAppResource with security contexts")
+			ctx := context.Background()
+
+			runAsUser := int64(1001)
+			readOnlyRootFilesystem := false
+			myAppResource := &v1beta1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      MyAppResourceName,
+					Namespace: MyAppResourceNamespace,
+				},
+				Spec: v1beta1.MyAppResourceSpec{
+					UI:                 v1beta1.UI{Color: "#34577c", Message: "some message"},
+					PodSecurityContext: &corev1.PodSecurityContext{RunAsUser: &runAsUser},
+					SecurityContext:    &corev1.SecurityContext{ReadOnlyRootFilesystem: &readOnlyRootFilesystem},
+				},
+			}
+			Expect(k8sClient.Create(ctx, myAppResource)).Should(Succeed())
+
+			By("By checking the podInfo deployment security contexts")
+			lookupKey := types.NamespacedName{Name: MyAppResourceName, Namespace: MyAppResourceNamespace}
+			podInfoDeployment := &appsv1.Deployment{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, lookupKey, podInfoDeployment)
+			}, timeout, interval).Should(Succeed())
+
+			Expect(podInfoDeployment.Spec.Template.Spec.SecurityContext).Should(Equal(&corev1.PodSecurityContext{RunAsUser: &runAsUser}))
+			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].SecurityContext).Should(Equal(
+				&corev1.SecurityContext{ReadOnlyRootFilesystem: &readOnlyRootFilesystem}))
+		})
+
+		It("Should replace the default podInfo probes with the probes of the spec", func() {
+			By("By creating a new MyAppResource with a readiness and a startup probe")
+			ctx := context.Background()
+
+			myAppResource := &v1beta1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      MyAppResourceName,
+					Namespace: MyAppResourceNamespace,
+				},
+				Spec: v1beta1.MyAppResourceSpec{
+					UI: v1beta1.UI{Color: "#34577c", Message: "some message"},
+					Probes: &v1beta1.Probes{
+						Readiness: &corev1.Probe{
+							ProbeHandler:  corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{Path: "/readyz", Port: intstr.FromInt(9898)}},
+							PeriodSeconds: 5,
+						},
+						Startup: &corev1.Probe{
+							ProbeHandler:     corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{Path: "/healthz", Port: intstr.FromInt(9898)}},
+							FailureThreshold: 30,
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, myAppResource)).Should(Succeed())
+
+			By("By checking the podInfo deployment probes")
+			lookupKey := types.NamespacedName{Name: MyAppResourceName, Namespace: MyAppResourceNamespace}
+			podInfoDeployment := &appsv1.Deployment{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, lookupKey, podInfoDeployment)
+			}, timeout, interval).Should(Succeed())
+
+			container := podInfoDeployment.Spec.Template.Spec.Containers[0]
+			Expect(container.LivenessProbe.HTTPGet.Path).Should(Equal("/healthz"))
+			Expect(container.ReadinessProbe.PeriodSeconds).Should(Equal(int32(5)))
+			Expect(container.StartupProbe.FailureThreshold).Should(Equal(int32(30)))
+		})
+
+		It("Should configure the podInfo service", func() {
+			By("By creating a new MyAppResource with a NodePort service")
+			ctx := context.Background()
+
+			myAppResource := &v1beta1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      MyAppResourceName,
+					Namespace: MyAppResourceNamespace,
+				},
+				Spec: v1beta1.MyAppResourceSpec{
+					UI: v1beta1.UI{
+						Color:   "#34577c",
+						Message: "some message",
+					},
+					Service: v1beta1.Service{
+						Type:            corev1.ServiceTypeNodePort,
+						HTTPPort:        80,
+						Annotations:     map[string]string{"some": "annotation"},
+						SessionAffinity: corev1.ServiceAffinityClientIP,
+					},
+				},
+			}
+
+			Expect(k8sClient.Create(ctx, myAppResource)).Should(Succeed())
+
+			By("By checking the service defaults")
+			lookupKey := types.NamespacedName{Name: MyAppResourceName, Namespace: MyAppResourceNamespace}
+			createdMyAppResource := &v1beta1.MyAppResource{}
+			Expect(k8sClient.Get(ctx, lookupKey, createdMyAppResource)).Should(Succeed())
+			Expect(createdMyAppResource.Spec.Service.MetricsPort).Should(Equal(int32(9797)))
+
+			By("By checking the podInfo service fields")
+			podInfoService := &corev1.Service{}
+			Eventually(func() (corev1.ServiceType, error) {
+				err := k8sClient.Get(ctx, lookupKey, podInfoService)
+				return podInfoService.Spec.Type, err
+			}, timeout, interval).Should(Equal(corev1.ServiceTypeNodePort))
+
+			Expect(podInfoService.Annotations).Should(HaveKeyWithValue("some", "annotation"))
+			Expect(podInfoService.Spec.SessionAffinity).Should(Equal(corev1.ServiceAffinityClientIP))
+			Expect(podInfoService.Spec.Ports[0].Port).Should(Equal(int32(80)))
+			Expect(podInfoService.Spec.Ports[0].NodePort).ShouldNot(BeZero())
+			Expect(podInfoService.Spec.Ports[1].Port).Should(Equal(int32(9797)))
+		})
+
+		It("Should leave the replicas to the autoscaler", func() {
+			By("By creating a new MyAppResource with autoscaling")
+			ctx := context.Background()
+
+			minReplicas := int32(2)
+			targetMemory := int32(70)
+			myAppResource := &v1beta1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      MyAppResourceName,
+					Namespace: MyAppResourceNamespace,
+				},
+				Spec: v1beta1.MyAppResourceSpec{
+					UI: v1beta1.UI{
+						Color:   "#34577c",
+						Message: "some message",
+					},
+					Autoscaling: &v1beta1.Autoscaling{
+						MinReplicas:                       &minReplicas,
+						MaxReplicas:                       5,
+						TargetMemoryUtilizationPercentage: &targetMemory,
+					},
+				},
+			}
+
+			Expect(k8sClient.Create(ctx, myAppResource)).Should(Succeed())
+
+			By("By checking the autoscaler fields")
+			lookupKey := types.NamespacedName{Name: MyAppResourceName, Namespace: MyAppResourceNamespace}
+			hpa := &autoscalingv2.HorizontalPodAutoscaler{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, lookupKey, hpa)
+			}, timeout, interval).Should(Succeed())
+
+			Expect(hpa.Spec.ScaleTargetRef.Kind).Should(Equal("Deployment"))
+			Expect(hpa.Spec.ScaleTargetRef.Name).Should(Equal(MyAppResourceName))
+			Expect(*hpa.Spec.MinReplicas).Should(Equal(int32(2)))
+			Expect(hpa.Spec.MaxReplicas).Should(Equal(int32(5)))
+			Expect(hpa.Spec.Metrics).Should(HaveLen(1))
+			Expect(hpa.Spec.Metrics[0].Resource.Name).Should(Equal(corev1.ResourceMemory))
+			Expect(*hpa.Spec.Metrics[0].Resource.Target.AverageUtilization).Should(Equal(int32(70)))
+
+			By("By scaling the podInfo deployment as the autoscaler would")
+			podInfoDeployment := &appsv1.Deployment{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, lookupKey, podInfoDeployment)
+			}, timeout, interval).Should(Succeed())
+			replicas := int32(4)
+			podInfoDeployment.Spec.Replicas = &replicas
+			Expect(k8sClient.Update(ctx, podInfoDeployment)).Should(Succeed())
+
+			createdMyAppResource := &v1beta1.MyAppResource{}
+			Eventually(func() error {
+				if err := k8sClient.Get(ctx, lookupKey, createdMyAppResource); err != nil {
+					return err
+				}
+				createdMyAppResource.Spec.UI.Message = "scaled"
+				return k8sClient.Update(ctx, createdMyAppResource)
+			}, timeout, interval).Should(Succeed())
+
+			By("By checking the replicas are kept")
+			Eventually(func() ([]corev1.EnvVar, error) {
+				err := k8sClient.Get(ctx, lookupKey, podInfoDeployment)
+				return podInfoDeployment.Spec.Template.Spec.Containers[0].Env, err
+			}, timeout, interval).Should(ContainElement(corev1.EnvVar{Name: podinfo.UIMessageEnvVar, Value: "scaled"}))
+			Expect(*podInfoDeployment.Spec.Replicas).Should(Equal(int32(4)))
+
+			By("By removing autoscaling")
+			// the reconciler patches the status concurrently, so retry on conflicts
+			Eventually(func() error {
+				if err := k8sClient.Get(ctx, lookupKey, createdMyAppResource); err != nil {
+					return err
+				}
+				createdMyAppResource.Spec.Autoscaling = nil
+				return k8sClient.Update(ctx, createdMyAppResource)
+			}, timeout, interval).Should(Succeed())
+
+			By("By checking the autoscaler gets deleted and replicaCount applies again")
+			Eventually(func() error {
+				return k8sClient.Get(ctx, lookupKey, &autoscalingv2.HorizontalPodAutoscaler{})
+			}, timeout, interval).ShouldNot(Succeed())
+			Eventually(func() (int32, error) {
+				err := k8sClient.Get(ctx, lookupKey, podInfoDeployment)
+				return *podInfoDeployment.Spec.Replicas, err
+			}, timeout, interval).Should(Equal(int32(1)))
+		})
+
+		It("Should hand the replicas over to the autoscaler and take them back", func() {
+			By("By creating a new MyAppResource without autoscaling")
+			ctx := context.Background()
+
+			replicaCount := int32(3)
+			myAppResource := &v1beta1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      MyAppResourceName,
+					Namespace: MyAppResourceNamespace,
+				},
+				Spec: v1beta1.MyAppResourceSpec{
+					ReplicaCount: &replicaCount,
+					UI: v1beta1.UI{
+						Color:   "#34577c",
+						Message: "some message",
+					},
+				},
+			}
+
+			Expect(k8sClient.Create(ctx, myAppResource)).Should(Succeed())
+
+			lookupKey := types.NamespacedName{Name: MyAppResourceName, Namespace: MyAppResourceNamespace}
+			podInfoDeployment := &appsv1.Deployment{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, lookupKey, podInfoDeployment)
+			}, timeout, interval).Should(Succeed())
+
+			setAutoscaling := func(autoscaling *v1beta1.Autoscaling, replicas int32) {
+				createdMyAppResource := &v1beta1.MyAppResource{}
+				// the reconciler patches the status concurrently, so retry on conflicts
+				Eventually(func() error {
+					if err := k8sClient.Get(ctx, lookupKey, createdMyAppResource); err != nil {
+						return err
+					}
+					createdMyAppResource.Spec.Autoscaling = autoscaling
+					createdMyAppResource.Spec.ReplicaCount = &replicas
+					return k8sClient.Update(ctx, createdMyAppResource)
+				}, timeout, interval).Should(Succeed())
+			}
+			handedOver := func() (bool, error) {
+				err := k8sClient.Get(ctx, lookupKey, podInfoDeployment)
+				return ownsField(podInfoDeployment.ManagedFields, handoverFieldManager, "f:spec", "f:replicas"), err
+			}
+
+			By("By turning autoscaling on")
+			autoscaling := &v1beta1.Autoscaling{MaxReplicas: 5}
+			setAutoscaling(autoscaling, 3)
+			Eventually(handedOver, timeout, interval).Should(BeTrue())
+			Expect(*podInfoDeployment.Spec.Replicas).Should(Equal(int32(3)))
+
+			By("By turning autoscaling off at the replicas handed over")
+			setAutoscaling(nil, 3)
+			Eventually(handedOver, timeout, interval).Should(BeFalse())
+			Expect(ownsField(podInfoDeployment.ManagedFields, fieldManager, "f:spec", "f:replicas")).Should(BeTrue())
+			Expect(*podInfoDeployment.Spec.Replicas).Should(Equal(int32(3)))
+
+			By("By turning autoscaling on and off again at other replicas")
+			setAutoscaling(autoscaling, 3)
+			Eventually(handedOver, timeout, interval).Should(BeTrue())
+			setAutoscaling(nil, 2)
+			Eventually(func() (int32, error) {
+				err := k8sClient.Get(ctx, lookupKey, podInfoDeployment)
+				return *podInfoDeployment.Spec.Replicas, err
+			}, timeout, interval).Should(Equal(int32(2)))
+			Expect(handedOver()).Should(BeFalse())
+
+			By("By checking taking the replicas back is not recorded as drift")
+			events := &corev1.EventList{}
+			Expect(k8sClient.List(ctx, events, client.InNamespace(MyAppResourceNamespace))).Should(Succeed())
+			for _, event := range events.Items {
+				if event.InvolvedObject.UID == myAppResource.UID {
+					Expect(event.Reason).ShouldNot(Equal("DriftCorrected"))
+				}
+			}
+		})
+
+		It("Should create and clean up the podInfo ingress", func() {
+			By("By creating a new MyAppResource with an ingress")
+			ctx := context.Background()
+
+			ingressClassName := "nginx"
+			myAppResource := &v1beta1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      MyAppResourceName,
+					Namespace: MyAppResourceNamespace,
+				},
+				Spec: v1beta1.MyAppResourceSpec{
+					UI: v1beta1.UI{
+						Color:   "#34577c",
+						Message: "some message",
+					},
+					Ingress: &v1beta1.Ingress{
+						Hosts:            []string{"podinfo.example.com"},
+						IngressClassName: &ingressClassName,
+						Annotations:      map[string]string{"some": "annotation"},
+						TLSSecretName:    "podinfo-tls",
+					},
+				},
+			}
+
+			Expect(k8sClient.Create(ctx, myAppResource)).Should(Succeed())
+
+			By("By checking the ingress fields")
+			lookupKey := types.NamespacedName{Name: MyAppResourceName, Namespace: MyAppResourceNamespace}
+			ingress := &networkingv1.Ingress{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, lookupKey, ingress)
+			}, timeout, interval).Should(Succeed())
+
+			Expect(*ingress.Spec.IngressClassName).Should(Equal("nginx"))
+			Expect(ingress.Annotations).Should(HaveKeyWithValue("some", "annotation"))
+			Expect(ingress.Spec.Rules).Should(HaveLen(1))
+			Expect(ingress.Spec.Rules[0].Host).Should(Equal("podinfo.example.com"))
+			path := ingress.Spec.Rules[0].HTTP.Paths[0]
+			Expect(path.Path).Should(Equal("/"))
+			Expect(path.Backend.Service.Name).Should(Equal(MyAppResourceName))
+			Expect(path.Backend.Service.Port.Name).Should(Equal("http"))
+			Expect(ingress.Spec.TLS).Should(Equal([]networkingv1.IngressTLS{
+				{Hosts: []string{"podinfo.example.com"}, SecretName: "podinfo-tls"},
+			}))
+
+			By("By removing the ingress")
+			createdMyAppResource := &v1beta1.MyAppResource{}
+			Expect(k8sClient.Get(ctx, lookupKey, createdMyAppResource)).Should(Succeed())
+			createdMyAppResource.Spec.Ingress = nil
+			Expect(k8sClient.Update(ctx, createdMyAppResource)).Should(Succeed())
+
+			By("By checking the ingress gets deleted")
+			Eventually(func() error {
+				return k8sClient.Get(ctx, lookupKey, &networkingv1.Ingress{})
+			}, timeout, interval).ShouldNot(Succeed())
+		})
+
+		It("Should keep the podInfo pods available during disruptions", func() {
+			By("By creating a new MyAppResource with two replicas")
+			ctx := context.Background()
+
+			replicas := int32(2)
+			myAppResource := &v1beta1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      MyAppResourceName,
+					Namespace: MyAppResourceNamespace,
+				},
+				Spec: v1beta1.MyAppResourceSpec{
+					ReplicaCount: &replicas,
+					UI: v1beta1.UI{
+						Color:   "#34577c",
+						Message: "some message",
+					},
+				},
+			}
+
+			Expect(k8sClient.Create(ctx, myAppResource)).Should(Succeed())
+
+			By("By checking the default disruption budget")
+			lookupKey := types.NamespacedName{Name: MyAppResourceName, Namespace: MyAppResourceNamespace}
+			pdb := &policyv1.PodDisruptionBudget{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, lookupKey, pdb)
+			}, timeout, interval).Should(Succeed())
+
+			Expect(pdb.Spec.Selector.MatchLabels).Should(Equal(map[string]string{"app": MyAppResourceName}))
+			Expect(pdb.Spec.MinAvailable).Should(BeNil())
+			Expect(*pdb.Spec.MaxUnavailable).Should(Equal(intstr.FromInt(1)))
+
+			By("By setting the disruption budget")
+			minAvailable := intstr.FromString("50%")
+			createdMyAppResource := &v1beta1.MyAppResource{}
+			Eventually(func() error {
+				if err := k8sClient.Get(ctx, lookupKey, createdMyAppResource); err != nil {
+					return err
+				}
+				createdMyAppResource.Spec.DisruptionBudget = &v1beta1.DisruptionBudget{MinAvailable: &minAvailable}
+				return k8sClient.Update(ctx, createdMyAppResource)
+			}, timeout, interval).Should(Succeed())
+
+			Eventually(func() (*intstr.IntOrString, error) {
+				err := k8sClient.Get(ctx, lookupKey, pdb)
+				return pdb.Spec.MinAvailable, err
+			}, timeout, interval).Should(Equal(&minAvailable))
+			Expect(pdb.Spec.MaxUnavailable).Should(BeNil())
+
+			By("By scaling down to a single replica without a budget")
+			Eventually(func() error {
+				if err := k8sClient.Get(ctx, lookupKey, createdMyAppResource); err != nil {
+					return err
+				}
+				replicas := int32(1)
+				createdMyAppResource.Spec.ReplicaCount = &replicas
+				createdMyAppResource.Spec.DisruptionBudget = nil
+				return k8sClient.Update(ctx, createdMyAppResource)
+			}, timeout, interval).Should(Succeed())
+
+			By("By checking the disruption budget gets deleted")
+			Eventually(func() error {
+				return k8sClient.Get(ctx, lookupKey, &policyv1.PodDisruptionBudget{})
+			}, timeout, interval).ShouldNot(Succeed())
 		})
+
+		It("Should keep the fields set by others and not write unchanged children", func() {
+			By("By creating a new MyAppResource")
+			ctx := context.Background()
+
+			myAppResource := &v1beta1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      MyAppResourceName,
+					Namespace: MyAppResourceNamespace,
+				},
+				Spec: v1beta1.MyAppResourceSpec{
+					UI: v1beta1.UI{
+						Color:   "#34577c",
+						Message: "some message",
+					},
+				},
+			}
+
+			Expect(k8sClient.Create(ctx, myAppResource)).Should(Succeed())
+
+			lookupKey := types.NamespacedName{Name: MyAppResourceName, Namespace: MyAppResourceNamespace}
+			podInfoDeployment := &appsv1.Deployment{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, lookupKey, podInfoDeployment)
+			}, timeout, interval).Should(Succeed())
+			podInfoService := &corev1.Service{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, lookupKey, podInfoService)
+			}, timeout, interval).Should(Succeed())
+			clusterIP := podInfoService.Spec.ClusterIP
+
+			By("By injecting a sidecar and annotating the service as other controllers would")
+			deploymentPatch := client.MergeFrom(podInfoDeployment.DeepCopy())
+			podInfoDeployment.Spec.Template.Spec.Containers = append(podInfoDeployment.Spec.Template.Spec.Containers,
+				corev1.Container{Name: "sidecar", Image: "busybox"})
+			Expect(k8sClient.Patch(ctx, podInfoDeployment, deploymentPatch, client.FieldOwner("injector"))).Should(Succeed())
+			servicePatch := client.MergeFrom(podInfoService.DeepCopy())
+			metav1.SetMetaDataAnnotation(&podInfoService.ObjectMeta, "cloud.example.com/id", "1234")
+			Expect(k8sClient.Patch(ctx, podInfoService, servicePatch, client.FieldOwner("cloud-controller"))).Should(Succeed())
+
+			By("By updating the MyAppResource")
+			createdMyAppResource := &v1beta1.MyAppResource{}
+			Eventually(func() error {
+				if err := k8sClient.Get(ctx, lookupKey, createdMyAppResource); err != nil {
+					return err
+				}
+				createdMyAppResource.Spec.UI.Message = "applied"
+				return k8sClient.Update(ctx, createdMyAppResource)
+			}, timeout, interval).Should(Succeed())
+
+			By("By checking the fields set by others are kept")
+			Eventually(func() ([]corev1.EnvVar, error) {
+				err := k8sClient.Get(ctx, lookupKey, podInfoDeployment)
+				return podInfoDeployment.Spec.Template.Spec.Containers[0].Env, err
+			}, timeout, interval).Should(ContainElement(corev1.EnvVar{Name: podinfo.UIMessageEnvVar, Value: "applied"}))
+			Expect(podInfoDeployment.Spec.Template.Spec.Containers).Should(HaveLen(2))
+			Expect(podInfoDeployment.Spec.Template.Spec.Containers[1].Name).Should(Equal("sidecar"))
+
+			Expect(k8sClient.Get(ctx, lookupKey, podInfoService)).Should(Succeed())
+			Expect(podInfoService.Annotations).Should(HaveKeyWithValue("cloud.example.com/id", "1234"))
+			Expect(podInfoService.Spec.ClusterIP).Should(Equal(clusterIP))
+
+			By("By checking an unchanged spec causes no writes")
+			// wait for the reconciles of the update to settle, this also makes the next apply fall into
+			// another second than the last one, which older API servers write as a new managedFields timestamp
+			var resourceVersion string
+			Eventually(func() (bool, error) {
+				previous := resourceVersion
+				err := k8sClient.Get(ctx, lookupKey, podInfoDeployment)
+				resourceVersion = podInfoDeployment.ResourceVersion
+				return previous == resourceVersion, err
+			}, timeout, time.Second).Should(BeTrue())
+			Eventually(func() error {
+				if err := k8sClient.Get(ctx, lookupKey, createdMyAppResource); err != nil {
+					return err
+				}
+				createdMyAppResource.Labels = map[string]string{"touched": "true"}
+				return k8sClient.Update(ctx, createdMyAppResource)
+			}, timeout, interval).Should(Succeed())
+			Consistently(func() (string, error) {
+				err := k8sClient.Get(ctx, lookupKey, podInfoDeployment)
+				return podInfoDeployment.ResourceVersion, err
+			}, time.Second*2, interval).Should(Equal(resourceVersion))
+		})
+
+		It("Should revert drift on the podInfo service", func() {
+			By("By creating a new MyAppResource")
+			ctx := context.Background()
+
+			myAppResource := &v1beta1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      MyAppResourceName,
+					Namespace: MyAppResourceNamespace,
+				},
+				Spec: v1beta1.MyAppResourceSpec{
+					UI: v1beta1.UI{
+						Color:   "#34577c",
+						Message: "some message",
+					},
+				},
+			}
+
+			Expect(k8sClient.Create(ctx, myAppResource)).Should(Succeed())
+
+			lookupKey := types.NamespacedName{Name: MyAppResourceName, Namespace: MyAppResourceNamespace}
+			podInfoService := &corev1.Service{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, lookupKey, podInfoService)
+			}, timeout, interval).Should(Succeed())
+
+			By("By editing the service selector by hand")
+			podInfoService.Spec.Selector = map[string]string{"app": "something-else"}
+			Expect(k8sClient.Update(ctx, podInfoService, client.FieldOwner("kubectl-edit"))).Should(Succeed())
+
+			By("By checking the selector is reverted and the drift recorded")
+			Eventually(func() (map[string]string, error) {
+				err := k8sClient.Get(ctx, lookupKey, podInfoService)
+				return podInfoService.Spec.Selector, err
+			}, timeout, interval).Should(Equal(map[string]string{"app": MyAppResourceName}))
+
+			Eventually(func() ([]string, error) {
+				events := &corev1.EventList{}
+				err := k8sClient.List(ctx, events, client.InNamespace(MyAppResourceNamespace))
+				var messages []string
+				for _, event := range events.Items {
+					if event.Reason == "DriftCorrected" && event.InvolvedObject.Name == MyAppResourceName {
+						messages = append(messages, event.Message)
+					}
+				}
+				return messages, err
+			}, timeout, interval).Should(ContainElement(And(ContainSubstring("Service whatever"), ContainSubstring("kubectl-edit"))))
+
+			By("By deleting the service")
+			Expect(k8sClient.Delete(ctx, podInfoService)).Should(Succeed())
+
+			By("By checking the service gets recreated")
+			Eventually(func() (map[string]string, error) {
+				service := &corev1.Service{}
+				err := k8sClient.Get(ctx, lookupKey, service)
+				return service.Spec.Selector, err
+			}, timeout, interval).Should(Equal(map[string]string{"app": MyAppResourceName}))
+		})
+
+		It("Should leave the children alone while paused", func() {
+			By("By creating a new MyAppResource")
+			ctx := context.Background()
+
+			myAppResource := &v1beta1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      MyAppResourceName,
+					Namespace: MyAppResourceNamespace,
+				},
+				Spec: v1beta1.MyAppResourceSpec{
+					UI: v1beta1.UI{
+						Color:   "#34577c",
+						Message: "some message",
+					},
+				},
+			}
+
+			Expect(k8sClient.Create(ctx, myAppResource)).Should(Succeed())
+
+			lookupKey := types.NamespacedName{Name: MyAppResourceName, Namespace: MyAppResourceNamespace}
+			podInfoDeployment := &appsv1.Deployment{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, lookupKey, podInfoDeployment)
+			}, timeout, interval).Should(Succeed())
+			image := podInfoDeployment.Spec.Template.Spec.Containers[0].Image
+
+			By("By pausing the MyAppResource")
+			// the reconciler patches the status concurrently, so retry on conflicts
+			Eventually(func() error {
+				if err := k8sClient.Get(ctx, lookupKey, myAppResource); err != nil {
+					return err
+				}
+				metav1.SetMetaDataAnnotation(&myAppResource.ObjectMeta, v1beta1.PausedAnnotation, "true")
+				return k8sClient.Update(ctx, myAppResource)
+			}, timeout, interval).Should(Succeed())
+			Eventually(func() (bool, error) {
+				err := k8sClient.Get(ctx, lookupKey, myAppResource)
+				return meta.IsStatusConditionTrue(myAppResource.Status.Conditions, v1beta1.ConditionTypePaused), err
+			}, timeout, interval).Should(BeTrue())
+			observedGeneration := myAppResource.Status.ObservedGeneration
+			pausedReconcile := testutil.ToFloat64(lastSuccessfulReconcile.WithLabelValues(lookupKey.Namespace, lookupKey.Name))
+
+			By("By patching the deployment by hand and changing the spec")
+			podInfoDeployment.Spec.Template.Spec.Containers[0].Image = "ghcr.io/stefanprodan/podinfo:hotfix"
+			Expect(k8sClient.Update(ctx, podInfoDeployment, client.FieldOwner("kubectl-edit"))).Should(Succeed())
+			Eventually(func() error {
+				if err := k8sClient.Get(ctx, lookupKey, myAppResource); err != nil {
+					return err
+				}
+				myAppResource.Spec.UI.Message = "resumed"
+				return k8sClient.Update(ctx, myAppResource)
+			}, timeout, interval).Should(Succeed())
+
+			By("By checking the deployment is left alone")
+			Consistently(func() (string, error) {
+				err := k8sClient.Get(ctx, lookupKey, podInfoDeployment)
+				return podInfoDeployment.Spec.Template.Spec.Containers[0].Image, err
+			}, time.Second*2, interval).Should(Equal("ghcr.io/stefanprodan/podinfo:hotfix"))
+			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].Env).ShouldNot(ContainElement(
+				corev1.EnvVar{Name: podinfo.UIMessageEnvVar, Value: "resumed"}))
+
+			By("By checking the status is still refreshed")
+			podInfoDeployment.Status.Replicas = 1
+			podInfoDeployment.Status.ReadyReplicas = 1
+			Expect(k8sClient.Status().Update(ctx, podInfoDeployment)).Should(Succeed())
+			Eventually(func() (int32, error) {
+				err := k8sClient.Get(ctx, lookupKey, myAppResource)
+				return myAppResource.Status.PodInfoReadyReplicas, err
+			}, timeout, interval).Should(Equal(int32(1)))
+			Expect(myAppResource.Status.ObservedGeneration).Should(Equal(observedGeneration))
+			Expect(testutil.ToFloat64(lastSuccessfulReconcile.WithLabelValues(lookupKey.Namespace, lookupKey.Name))).Should(
+				BeNumerically(">", pausedReconcile))
+
+			By("By resuming the MyAppResource")
+			Eventually(func() error {
+				if err := k8sClient.Get(ctx, lookupKey, myAppResource); err != nil {
+					return err
+				}
+				delete(myAppResource.Annotations, v1beta1.PausedAnnotation)
+				return k8sClient.Update(ctx, myAppResource)
+			}, timeout, interval).Should(Succeed())
+
+			By("By checking the deployment is brought back to the desired state")
+			Eventually(func() (string, error) {
+				err := k8sClient.Get(ctx, lookupKey, podInfoDeployment)
+				return podInfoDeployment.Spec.Template.Spec.Containers[0].Image, err
+			}, timeout, interval).Should(Equal(image))
+			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].Env).Should(ContainElement(
+				corev1.EnvVar{Name: podinfo.UIMessageEnvVar, Value: "resumed"}))
+			Eventually(func() (*metav1.Condition, error) {
+				err := k8sClient.Get(ctx, lookupKey, myAppResource)
+				return meta.FindStatusCondition(myAppResource.Status.Conditions, v1beta1.ConditionTypePaused), err
+			}, timeout, interval).Should(BeNil())
+			Expect(myAppResource.Status.ObservedGeneration).Should(Equal(myAppResource.Generation))
+
+			Eventually(func() ([]string, error) {
+				return getEvents(ctx, myAppResource)
+			}, timeout, interval).Should(ContainElements(
+				"Normal Paused Paused, child objects are not changed",
+				"Normal Resumed Resumed, child objects are brought back to the desired state",
+			))
+		})
+		It("Should hold images the policy does not allow", func() {
+			By("By creating a new MyAppResource with an image from another registry")
+			ctx := context.Background()
+
+			myAppResource := &v1beta1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      MyAppResourceName,
+					Namespace: MyAppResourceNamespace,
+				},
+				Spec: v1beta1.MyAppResourceSpec{
+					Image: v1beta1.Image{
+						Repository: "registry.example.com/podinfo",
+						Tag:        "6.3.0",
+					},
+					UI: v1beta1.UI{
+						Color:   "#34577c",
+						Message: "some message",
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, myAppResource)).Should(Succeed())
+
+			By("By checking the violation is reported and nothing is deployed")
+			lookupKey := types.NamespacedName{Name: MyAppResourceName, Namespace: MyAppResourceNamespace}
+			Eventually(func() (*metav1.Condition, error) {
+				err := k8sClient.Get(ctx, lookupKey, myAppResource)
+				return meta.FindStatusCondition(myAppResource.Status.Conditions, v1beta1.ConditionTypePolicyViolation), err
+			}, timeout, interval).Should(And(
+				HaveField("Status", metav1.ConditionTrue),
+				HaveField("Reason", v1beta1.ReasonImageNotAllowed),
+				HaveField("Message", "image registry.example.com/podinfo:6.3.0 is not from an allowed repository: ghcr.io/stefanprodan, docker.io/redis"),
+			))
+			Expect(k8sClient.Get(ctx, lookupKey, &appsv1.Deployment{})).ShouldNot(Succeed())
+			Eventually(func() ([]string, error) {
+				return getEvents(ctx, myAppResource)
+			}, timeout, interval).Should(ContainElement(
+				"Warning ImageNotAllowed PolicyViolation is True: image registry.example.com/podinfo:6.3.0 is not from an allowed repository: ghcr.io/stefanprodan, docker.io/redis"))
+
+			By("By changing to an allowed image")
+			Eventually(func() error {
+				if err := k8sClient.Get(ctx, lookupKey, myAppResource); err != nil {
+					return err
+				}
+				myAppResource.Spec.Image.Repository = "ghcr.io/stefanprodan/podinfo"
+				return k8sClient.Update(ctx, myAppResource)
+			}, timeout, interval).Should(Succeed())
+
+			By("By checking the deployment is created and the violation is gone")
+			podInfoDeployment := &appsv1.Deployment{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, lookupKey, podInfoDeployment)
+			}, timeout, interval).Should(Succeed())
+			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].Image).Should(Equal("ghcr.io/stefanprodan/podinfo:6.3.0"))
+			Eventually(func() (*metav1.Condition, error) {
+				err := k8sClient.Get(ctx, lookupKey, myAppResource)
+				return meta.FindStatusCondition(myAppResource.Status.Conditions, v1beta1.ConditionTypePolicyViolation), err
+			}, timeout, interval).Should(BeNil())
+			Expect(myAppResource.Status.ObservedGeneration).Should(Equal(myAppResource.Generation))
+		})
+	})
+
+})
+
+var _ = Describe("MyAppResource controller - Canary rollout", func() {
+
+	const (
+		MyAppResourceName      = "canary"
+		MyAppResourceNamespace = "default"
+
+		timeout  = time.Second * 10
+		interval = time.Millisecond * 250
+	)
+
+	lookupKey := types.NamespacedName{Name: MyAppResourceName, Namespace: MyAppResourceNamespace}
+	canaryLookupKey := types.NamespacedName{Name: podinfo.GetCanaryName(MyAppResourceName), Namespace: MyAppResourceNamespace}
+
+	// rollOut marks the deployment as rolled out, as the deployment controller would
+	rollOut := func(ctx context.Context, key types.NamespacedName) {
+		Eventually(func() error {
+			deployment := &appsv1.Deployment{}
+			if err := k8sClient.Get(ctx, key, deployment); err != nil {
+				return err
+			}
+			deployment.Status.ObservedGeneration = deployment.Generation
+			deployment.Status.Replicas = *deployment.Spec.Replicas
+			deployment.Status.UpdatedReplicas = *deployment.Spec.Replicas
+			deployment.Status.ReadyReplicas = *deployment.Spec.Replicas
+			deployment.Status.AvailableReplicas = *deployment.Spec.Replicas
+			return k8sClient.Status().Update(ctx, deployment)
+		}, timeout, interval).Should(Succeed())
+	}
+
+	// getCanaryStatus returns the canary rollout reported by the myappresource
+	getCanaryStatus := func(ctx context.Context) func() (*v1beta1.CanaryStatus, error) {
+		return func() (*v1beta1.CanaryStatus, error) {
+			myAppResource := &v1beta1.MyAppResource{}
+			err := k8sClient.Get(ctx, lookupKey, myAppResource)
+			return myAppResource.Status.Canary, err
+		}
+	}
+
+	// getReplicasAndImage returns the replicas and podinfo image of a deployment
+	getReplicasAndImage := func(ctx context.Context, key types.NamespacedName) func() (string, error) {
+		return func() (string, error) {
+			deployment := &appsv1.Deployment{}
+			if err := k8sClient.Get(ctx, key, deployment); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d %s", *deployment.Spec.Replicas, deployment.Spec.Template.Spec.Containers[0].Image), nil
+		}
+	}
+
+	// annotate sets an annotation on the myappresource, the reconciler patches it concurrently
+	annotate := func(ctx context.Context, key, value string) {
+		Eventually(func() error {
+			myAppResource := &v1beta1.MyAppResource{}
+			if err := k8sClient.Get(ctx, lookupKey, myAppResource); err != nil {
+				return err
+			}
+			metav1.SetMetaDataAnnotation(&myAppResource.ObjectMeta, key, value)
+			return k8sClient.Update(ctx, myAppResource)
+		}, timeout, interval).Should(Succeed())
+	}
+
+	// setTag changes the podinfo image tag of the myappresource
+	setTag := func(ctx context.Context, tag string) {
+		Eventually(func() error {
+			myAppResource := &v1beta1.MyAppResource{}
+			if err := k8sClient.Get(ctx, lookupKey, myAppResource); err != nil {
+				return err
+			}
+			myAppResource.Spec.Image.Tag = tag
+			return k8sClient.Update(ctx, myAppResource)
+		}, timeout, interval).Should(Succeed())
+	}
+
+	BeforeEach(func() {
+		ctx := context.Background()
+
+		replicas := int32(2)
+		myAppResource := &v1beta1.MyAppResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      MyAppResourceName,
+				Namespace: MyAppResourceNamespace,
+			},
+			Spec: v1beta1.MyAppResourceSpec{
+				ReplicaCount: &replicas,
+				Image: v1beta1.Image{
+					Repository: "ghcr.io/stefanprodan/podinfo",
+					Tag:        "6.0.0",
+				},
+				UI: v1beta1.UI{
+					Color:   "#34577c",
+					Message: "some message",
+				},
+				Rollout: &v1beta1.Rollout{
+					Canary: &v1beta1.CanaryRollout{
+						Steps: []v1beta1.CanaryStep{
+							{Weight: 50},
+							{Weight: 100, Pause: &metav1.Duration{Duration: time.Second}},
+						},
+					},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, myAppResource)).Should(Succeed())
+
+		Eventually(getReplicasAndImage(ctx, lookupKey), timeout, interval).Should(Equal("2 ghcr.io/stefanprodan/podinfo:6.0.0"))
+		rollOut(ctx, lookupKey)
+		Expect(getCanaryStatus(ctx)()).Should(BeNil())
+	})
+
+	AfterEach(func() {
+		Eventually(func() error {
+			myApp := &v1beta1.MyAppResource{}
+			k8sClient.Get(context.Background(), lookupKey, myApp)
+			return k8sClient.Delete(context.Background(), myApp)
+		}, timeout, interval).Should(Succeed())
+		Eventually(func() error {
+			return k8sClient.Get(context.Background(), lookupKey, &v1beta1.MyAppResource{})
+		}, timeout, interval).ShouldNot(Succeed())
+
+		// there is no garbage collector in the test environment, cleanup what the tests leave behind
+		for _, child := range []client.Object{
+			&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: MyAppResourceName, Namespace: MyAppResourceNamespace}},
+			&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: podinfo.GetCanaryName(MyAppResourceName), Namespace: MyAppResourceNamespace}},
+			&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: MyAppResourceName, Namespace: MyAppResourceNamespace}},
+			&policyv1.PodDisruptionBudget{ObjectMeta: metav1.ObjectMeta{Name: MyAppResourceName, Namespace: MyAppResourceNamespace}},
+		} {
+			Expect(client.IgnoreNotFound(k8sClient.Delete(context.Background(), child))).Should(Succeed())
+		}
+	})
+
+	It("Should move the replicas to the canary step by step and promote it", func() {
+		ctx := context.Background()
+
+		By("By changing the image")
+		setTag(ctx, "6.1.0")
+
+		By("By checking half of the replicas run the canary")
+		Eventually(getReplicasAndImage(ctx, canaryLookupKey), timeout, interval).Should(Equal("1 ghcr.io/stefanprodan/podinfo:6.1.0"))
+		Eventually(getReplicasAndImage(ctx, lookupKey), timeout, interval).Should(Equal("1 ghcr.io/stefanprodan/podinfo:6.0.0"))
+		canary := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, canaryLookupKey, canary)).Should(Succeed())
+		Expect(canary.Spec.Selector.MatchLabels).Should(HaveKeyWithValue(podinfo.TrackLabel, podinfo.TrackCanary))
+		Eventually(getCanaryStatus(ctx), timeout, interval).Should(And(Not(BeNil()), HaveField("Phase", v1beta1.CanaryPhaseProgressing)))
+		Expect(getCanaryStatus(ctx)()).Should(And(
+			HaveField("StableImage", "ghcr.io/stefanprodan/podinfo:6.0.0"),
+			HaveField("CanaryImage", "ghcr.io/stefanprodan/podinfo:6.1.0"),
+			HaveField("Step", int32(0)),
+			HaveField("Weight", int32(50)),
+		))
+
+		By("By checking the step waits to be promoted once the canary is available")
+		rollOut(ctx, canaryLookupKey)
+		Eventually(getCanaryStatus(ctx), timeout, interval).Should(HaveField("Phase", v1beta1.CanaryPhasePaused))
+
+		By("By promoting the step")
+		annotate(ctx, v1beta1.CanaryAnnotation, v1beta1.CanaryActionPromote)
+		Eventually(getReplicasAndImage(ctx, canaryLookupKey), timeout, interval).Should(Equal("2 ghcr.io/stefanprodan/podinfo:6.1.0"))
+		Eventually(getReplicasAndImage(ctx, lookupKey), timeout, interval).Should(Equal("0 ghcr.io/stefanprodan/podinfo:6.0.0"))
+		Eventually(getCanaryStatus(ctx), timeout, interval).Should(And(HaveField("Step", int32(1)), HaveField("Weight", int32(100))))
+		Eventually(func() (map[string]string, error) {
+			myAppResource := &v1beta1.MyAppResource{}
+			err := k8sClient.Get(ctx, lookupKey, myAppResource)
+			return myAppResource.Annotations, err
+		}, timeout, interval).ShouldNot(HaveKey(v1beta1.CanaryAnnotation))
+
+		By("By checking the image is promoted after the pause of the last step")
+		rollOut(ctx, canaryLookupKey)
+		Eventually(getReplicasAndImage(ctx, lookupKey), timeout, interval).Should(Equal("2 ghcr.io/stefanprodan/podinfo:6.1.0"))
+		Eventually(getCanaryStatus(ctx), timeout, interval).Should(HaveField("Phase", v1beta1.CanaryPhasePromoting))
+		Expect(k8sClient.Get(ctx, canaryLookupKey, canary)).Should(Succeed())
+
+		By("By checking the canary is removed once the stable deployment is rolled out")
+		rollOut(ctx, lookupKey)
+		Eventually(func() error {
+			return k8sClient.Get(ctx, canaryLookupKey, &appsv1.Deployment{})
+		}, timeout, interval).ShouldNot(Succeed())
+		Eventually(getCanaryStatus(ctx), timeout, interval).Should(BeNil())
+
+		myAppResource := &v1beta1.MyAppResource{}
+		Expect(k8sClient.Get(ctx, lookupKey, myAppResource)).Should(Succeed())
+		Eventually(func() ([]string, error) {
+			return getEvents(ctx, myAppResource)
+		}, timeout, interval).Should(ContainElements(
+			"Normal CanaryStarted Started canary rollout of image ghcr.io/stefanprodan/podinfo:6.1.0, replacing ghcr.io/stefanprodan/podinfo:6.0.0",
+			"Normal CanaryPromoted Promoted canary image ghcr.io/stefanprodan/podinfo:6.1.0",
+		))
+	})
+
+	It("Should go back to the stable image when the canary is aborted", func() {
+		ctx := context.Background()
+
+		By("By changing the image")
+		setTag(ctx, "6.1.0")
+		Eventually(getReplicasAndImage(ctx, canaryLookupKey), timeout, interval).Should(Equal("1 ghcr.io/stefanprodan/podinfo:6.1.0"))
+
+		By("By aborting the rollout")
+		annotate(ctx, v1beta1.CanaryAnnotation, v1beta1.CanaryActionAbort)
+		Eventually(func() error {
+			return k8sClient.Get(ctx, canaryLookupKey, &appsv1.Deployment{})
+		}, timeout, interval).ShouldNot(Succeed())
+		Eventually(getReplicasAndImage(ctx, lookupKey), timeout, interval).Should(Equal("2 ghcr.io/stefanprodan/podinfo:6.0.0"))
+		Eventually(getCanaryStatus(ctx), timeout, interval).Should(HaveField("Phase", v1beta1.CanaryPhaseAborted))
+
+		By("By checking the aborted image is not rolled out again")
+		Consistently(getReplicasAndImage(ctx, lookupKey), time.Second*2, interval).Should(Equal("2 ghcr.io/stefanprodan/podinfo:6.0.0"))
+
+		myAppResource := &v1beta1.MyAppResource{}
+		Expect(k8sClient.Get(ctx, lookupKey, myAppResource)).Should(Succeed())
+		Expect(myAppResource.Annotations).ShouldNot(HaveKey(v1beta1.CanaryAnnotation))
+		Eventually(func() ([]string, error) {
+			return getEvents(ctx, myAppResource)
+		}, timeout, interval).Should(ContainElement(
+			"Warning CanaryAborted Aborted canary rollout of image ghcr.io/stefanprodan/podinfo:6.1.0: aborted with the my.api.group/canary annotation"))
+
+		By("By changing the image again")
+		setTag(ctx, "6.2.0")
+		Eventually(getReplicasAndImage(ctx, canaryLookupKey), timeout, interval).Should(Equal("1 ghcr.io/stefanprodan/podinfo:6.2.0"))
+		Eventually(getCanaryStatus(ctx), timeout, interval).Should(HaveField("Phase", v1beta1.CanaryPhaseProgressing))
 	})
-
 })
 
 var _ = Describe("MyAppResource controller - Redis Enabled", func() {
@@ -318,7 +1345,27 @@ var _ = Describe("MyAppResource controller - Redis Enabled", func() {
 			// validate its fields!
 			Expect(podInfoDeployment.Name).Should(Equal(MyAppResourceName))
 			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].Env).Should(ContainElement(
-				corev1.EnvVar{Name: podinfo.CacheEnvVar, Value: fmt.Sprintf("tcp://whatever-redis.%s.svc.cluster.local:6379", MyAppResourceNamespace)}))
+				corev1.EnvVar{Name: podinfo.CacheEnvVar, Value: fmt.Sprintf("tcp://:$(REDIS_PASSWORD_URLENCODED)@whatever-redis.%s.svc.cluster.local:6379", MyAppResourceNamespace)}))
+			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].Env).Should(ContainElement(
+				corev1.EnvVar{Name: redis.EncodedPasswordEnvVar, ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "whatever-redis-url-auth"},
+					Key:                  redis.PasswordKey,
+				}}}))
+			Eventually(func() (map[string][]byte, error) {
+				encoded := &corev1.Secret{}
+				err := k8sClient.Get(ctx, types.NamespacedName{Name: "whatever-redis-url-auth", Namespace: MyAppResourceNamespace}, encoded)
+				return encoded.Data, err
+			}, timeout, interval).Should(HaveKey(redis.PasswordKey))
+
+			By("By checking the redis password is generated")
+			authLookupKey := types.NamespacedName{Name: "whatever-redis-auth", Namespace: MyAppResourceNamespace}
+			authSecret := &corev1.Secret{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, authLookupKey, authSecret)
+			}, timeout, interval).Should(Succeed())
+			Expect(authSecret.Data[redis.PasswordKey]).ShouldNot(BeEmpty())
+			Expect(authSecret.OwnerReferences).Should(HaveLen(1))
+			password := authSecret.Data[redis.PasswordKey]
 
 			By("By checking the redis deployment fields")
 			redisName := fmt.Sprintf("%s-redis", MyAppResourceName)
@@ -338,6 +1385,8 @@ var _ = Describe("MyAppResource controller - Redis Enabled", func() {
 			Expect(len(redisDeployment.Spec.Template.Spec.Containers)).Should(Equal(1))
 			Expect(redisDeployment.Spec.Template.Spec.Containers[0].Name).Should(Equal("redis"))
 			Expect(redisDeployment.Spec.Template.Spec.Containers[0].Ports[0].ContainerPort).Should(Equal(int32(redis.RedisPort)))
+			Expect(redisDeployment.Spec.Template.Spec.Containers[0].Command[3]).Should(Equal("redis-server"))
+			Expect(redisDeployment.Spec.Template.Spec.Containers[0].Args).Should(BeEmpty())
 
 			By("By checking the redis service fields")
 			redisService := &corev1.Service{}
@@ -371,6 +1420,20 @@ var _ = Describe("MyAppResource controller - Redis Enabled", func() {
 
 				return int(createdMyAppResource.Status.RedisReadyReplicas), nil
 			}, timeout, interval).Should(Equal(1), "podInfoReadyReplicas in status should match the redis deployment")
+			Expect(meta.FindStatusCondition(createdMyAppResource.Status.Conditions, v1beta1.ConditionTypeRedisReady)).ShouldNot(BeNil())
+
+			By("By checking the metrics report the replicas")
+			Eventually(func() float64 {
+				return testutil.ToFloat64(readyReplicas.WithLabelValues(MyAppResourceNamespace, MyAppResourceName, componentRedis))
+			}, timeout, interval).Should(Equal(float64(1)))
+			Expect(testutil.ToFloat64(desiredReplicas.WithLabelValues(MyAppResourceNamespace, MyAppResourceName, componentRedis))).Should(Equal(float64(1)))
+			Expect(testutil.ToFloat64(desiredReplicas.WithLabelValues(MyAppResourceNamespace, MyAppResourceName, componentPodInfo))).Should(Equal(float64(1)))
+			Expect(testutil.ToFloat64(redisEnabled.WithLabelValues(MyAppResourceNamespace, MyAppResourceName))).Should(Equal(float64(1)))
+			Expect(testutil.ToFloat64(lastSuccessfulReconcile.WithLabelValues(MyAppResourceNamespace, MyAppResourceName))).Should(BeNumerically(">", 0))
+
+			By("By checking the generated password is kept")
+			Expect(k8sClient.Get(ctx, authLookupKey, authSecret)).Should(Succeed())
+			Expect(authSecret.Data[redis.PasswordKey]).Should(Equal(password))
 
 			By("By disabling the redis")
 			Eventually(func() bool {
@@ -395,10 +1458,580 @@ var _ = Describe("MyAppResource controller - Redis Enabled", func() {
 				return k8sClient.Get(context.Background(), redisLookupKey, svc)
 			}, timeout, interval).ShouldNot(Succeed())
 
+			Eventually(func() error {
+				return k8sClient.Get(context.Background(), authLookupKey, &corev1.Secret{})
+			}, timeout, interval).ShouldNot(Succeed())
+
+			By("By checking the metrics no longer report redis")
+			Eventually(func() float64 {
+				return testutil.ToFloat64(redisEnabled.WithLabelValues(MyAppResourceNamespace, MyAppResourceName))
+			}, timeout, interval).Should(Equal(float64(0)))
+			Expect(hasSeries(readyReplicas, MyAppResourceNamespace, MyAppResourceName, componentRedis)).Should(BeFalse())
+
+			By("By checking the changes are recorded as events")
+			Eventually(func() ([]string, error) {
+				return getEvents(ctx, createdMyAppResource)
+			}, timeout, interval).Should(ContainElements(
+				"Normal Created Created Deployment whatever-redis",
+				"Normal Created Created Secret whatever-redis-auth",
+				"Normal RedisEnabled Redis is enabled",
+				"Normal RedisDisabled Redis is disabled",
+				"Normal Deleted Deleted Deployment whatever-redis",
+				"Normal Deleted Deleted Secret whatever-redis-auth",
+			))
+		})
+
+		It("Should point podInfo at an external Redis", func() {
+			By("By creating a new MyAppResource with an external Redis")
+			ctx := context.Background()
+
+			myAppResource := &v1beta1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      MyAppResourceName,
+					Namespace: MyAppResourceNamespace,
+				},
+				Spec: v1beta1.MyAppResourceSpec{
+					UI: v1beta1.UI{Color: "#34577c", Message: "some message"},
+					Redis: v1beta1.Redis{
+						External: &v1beta1.RedisExternal{
+							Host: "redis.example.com",
+							Port: 6380,
+							TLS:  true,
+							CredentialsSecretRef: &corev1.SecretKeySelector{
+								LocalObjectReference: corev1.LocalObjectReference{Name: "managed-redis"}, Key: "password"},
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, myAppResource)).Should(Succeed())
+
+			lookupKey := types.NamespacedName{Name: MyAppResourceName, Namespace: MyAppResourceNamespace}
+			createdMyAppResource := &v1beta1.MyAppResource{}
+			Eventually(func() (v1beta1.RedisSource, error) {
+				err := k8sClient.Get(ctx, lookupKey, createdMyAppResource)
+				return createdMyAppResource.Status.RedisSource, err
+			}, timeout, interval).Should(Equal(v1beta1.RedisSourceExternal))
+			Expect(meta.FindStatusCondition(createdMyAppResource.Status.Conditions, v1beta1.ConditionTypeRedisReady)).Should(And(
+				HaveField("Status", metav1.ConditionTrue),
+				HaveField("Reason", v1beta1.ReasonExternalRedis)))
+
+			By("By checking podInfo uses the external Redis")
+			podInfoDeployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, lookupKey, podInfoDeployment)).Should(Succeed())
+			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].Env).Should(ContainElements(
+				corev1.EnvVar{Name: redis.EncodedPasswordEnvVar, ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "whatever-redis-url-auth"}, Key: "password"}}},
+				corev1.EnvVar{Name: podinfo.CacheEnvVar, Value: "rediss://:$(REDIS_PASSWORD_URLENCODED)@redis.example.com:6380"}))
+
+			By("By checking no redis is deployed")
+			redisLookupKey := types.NamespacedName{Name: redis.GetDeploymentName(MyAppResourceName), Namespace: MyAppResourceNamespace}
+			Expect(k8sClient.Get(ctx, redisLookupKey, &appsv1.Deployment{})).ShouldNot(Succeed())
+			Expect(k8sClient.Get(ctx, redisLookupKey, &corev1.Service{})).ShouldNot(Succeed())
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: redis.GetAuthSecretName(MyAppResourceName), Namespace: MyAppResourceNamespace},
+				&corev1.Secret{})).ShouldNot(Succeed())
+
+			By("By checking the metrics do not report a managed Redis")
+			Expect(testutil.ToFloat64(redisEnabled.WithLabelValues(MyAppResourceNamespace, MyAppResourceName))).Should(Equal(float64(0)))
+			Expect(hasSeries(desiredReplicas, MyAppResourceNamespace, MyAppResourceName, componentRedis)).Should(BeFalse())
+
+			By("By creating the credentials Secret with a password holding URL reserved characters")
+			credentials := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "managed-redis", Namespace: MyAppResourceNamespace},
+				Data:       map[string][]byte{"password": []byte("p@ss/word")},
+			}
+			Expect(k8sClient.Create(ctx, credentials)).Should(Succeed())
+			defer func() {
+				Expect(k8sClient.Delete(ctx, credentials)).Should(Succeed())
+			}()
+
+			By("By checking podInfo gets the password percent-encoded")
+			encodedLookupKey := types.NamespacedName{Name: redis.GetEncodedPasswordSecretName(MyAppResourceName), Namespace: MyAppResourceNamespace}
+			getEncodedPassword := func() (string, error) {
+				encoded := &corev1.Secret{}
+				err := k8sClient.Get(ctx, encodedLookupKey, encoded)
+				return string(encoded.Data[redis.PasswordKey]), err
+			}
+			Eventually(getEncodedPassword, timeout, interval).Should(Equal("p%40ss%2Fword"))
+
+			By("By checking the encoded password follows the credentials Secret")
+			credentials.Data["password"] = []byte("new pass")
+			Expect(k8sClient.Update(ctx, credentials)).Should(Succeed())
+			Eventually(getEncodedPassword, timeout, interval).Should(Equal("new%20pass"))
+		})
+	})
+})
+
+var _ = Describe("MyAppResource controller - Redis Persistence", func() {
+
+	const (
+		MyAppResourceName      = "persistent"
+		MyAppResourceNamespace = "default"
+
+		timeout  = time.Second * 10
+		interval = time.Millisecond * 250
+	)
+
+	AfterEach(func() {
+		lookupKey := types.NamespacedName{Name: MyAppResourceName, Namespace: MyAppResourceNamespace}
+
+		// cleanup myappresource
+		Eventually(func() error {
+			myApp := &v1beta1.MyAppResource{}
+			k8sClient.Get(context.Background(), lookupKey, myApp)
+			return k8sClient.Delete(context.Background(), myApp)
+		}, timeout, interval).Should(Succeed())
+
+		Eventually(func() error {
+			myApp := &v1beta1.MyAppResource{}
+			return k8sClient.Get(context.Background(), lookupKey, myApp)
+		}, timeout, interval).ShouldNot(Succeed())
+
+		// cleanup podinfo deployment
+		Eventually(func() error {
+			podInfo := &appsv1.Deployment{}
+			k8sClient.Get(context.Background(), lookupKey, podInfo)
+			return k8sClient.Delete(context.Background(), podInfo)
+		}, timeout, interval).Should(Succeed())
+	})
+
+	Context("When creating MyAppResource with persistent Redis", func() {
+
+		It("Should create a StatefulSet and report the claim", func() {
+			By("By creating a new MyAppResource with Redis persistence")
+			ctx := context.Background()
+
+			myAppResource := &v1beta1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      MyAppResourceName,
+					Namespace: MyAppResourceNamespace,
+				},
+				Spec: v1beta1.MyAppResourceSpec{
+					UI: v1beta1.UI{
+						Color:   "#34577c",
+						Message: "some message",
+					},
+					Redis: v1beta1.Redis{
+						Enabled:     true,
+						Persistence: &v1beta1.RedisPersistence{},
+					},
+				},
+			}
+
+			Expect(k8sClient.Create(ctx, myAppResource)).Should(Succeed())
+
+			lookupKey := types.NamespacedName{Name: MyAppResourceName, Namespace: MyAppResourceNamespace}
+			redisLookupKey := types.NamespacedName{Name: redis.GetDeploymentName(MyAppResourceName), Namespace: MyAppResourceNamespace}
+			headlessLookupKey := types.NamespacedName{Name: redis.GetHeadlessServiceName(MyAppResourceName), Namespace: MyAppResourceNamespace}
+			createdMyAppResource := &v1beta1.MyAppResource{}
+
+			By("By checking the persistence defaults")
+			Expect(k8sClient.Get(ctx, lookupKey, createdMyAppResource)).Should(Succeed())
+			Expect(createdMyAppResource.Spec.Redis.Persistence.Size.String()).Should(Equal("1Gi"))
+			Expect(createdMyAppResource.Spec.Redis.Persistence.AccessMode).Should(Equal(corev1.ReadWriteOnce))
+			Expect(createdMyAppResource.Spec.Redis.Image).Should(Equal(v1beta1.RedisImage{Repository: "redis/redis-stack", Tag: "7.2.0-v6"}))
+
+			By("By checking the redis statefulset fields")
+			redisStatefulSet := &appsv1.StatefulSet{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, redisLookupKey, redisStatefulSet)
+			}, timeout, interval).Should(Succeed())
+			Expect(redisStatefulSet.Spec.Template.Spec.Containers[0].Image).Should(Equal("redis/redis-stack:7.2.0-v6"),
+				"the image should default to the operator configuration")
+
+			Expect(redisStatefulSet.Spec.ServiceName).Should(Equal(headlessLookupKey.Name))
+			Expect(redisStatefulSet.Spec.VolumeClaimTemplates).Should(HaveLen(1))
+			Expect(redisStatefulSet.Spec.VolumeClaimTemplates[0].Spec.Resources.Requests.Storage().String()).Should(Equal("1Gi"))
+			Expect(k8sClient.Get(ctx, redisLookupKey, &appsv1.Deployment{})).ShouldNot(Succeed())
+
+			By("By checking the redis services exist")
+			headlessService := &corev1.Service{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, headlessLookupKey, headlessService)
+			}, timeout, interval).Should(Succeed())
+			Expect(headlessService.Spec.ClusterIP).Should(Equal(corev1.ClusterIPNone))
+			Expect(k8sClient.Get(ctx, redisLookupKey, &corev1.Service{})).Should(Succeed())
+
+			By("By checking the storage is not bound before the claim exists")
+			Eventually(func() (string, error) {
+				err := k8sClient.Get(ctx, lookupKey, createdMyAppResource)
+				if err != nil {
+					return "", err
+				}
+				bound := meta.FindStatusCondition(createdMyAppResource.Status.Conditions, v1beta1.ConditionTypeRedisStorageBound)
+				if bound == nil || bound.Status != metav1.ConditionFalse {
+					return "", nil
+				}
+				return bound.Reason, nil
+			}, timeout, interval).Should(Equal(v1beta1.ReasonClaimPending))
+			Expect(createdMyAppResource.Status.RedisSource).Should(Equal(v1beta1.RedisSourceManaged))
+
+			By("By creating the claim the statefulset controller would have created before the label prefix changed")
+			claim := &corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      redis.GetPersistentVolumeClaimName(MyAppResourceName),
+					Namespace: MyAppResourceNamespace,
+					Labels:    map[string]string{"old.example.com/instance": MyAppResourceName},
+				},
+				Spec: redisStatefulSet.Spec.VolumeClaimTemplates[0].Spec,
+			}
+			Expect(k8sClient.Create(ctx, claim)).Should(Succeed())
+			claim.Status.Phase = corev1.ClaimBound
+			Expect(k8sClient.Status().Update(ctx, claim)).Should(Succeed())
+
+			By("By checking the storage is reported bound")
+			Eventually(func() (bool, error) {
+				err := k8sClient.Get(ctx, lookupKey, createdMyAppResource)
+				if err != nil {
+					return false, err
+				}
+				return meta.IsStatusConditionTrue(createdMyAppResource.Status.Conditions, v1beta1.ConditionTypeRedisStorageBound), nil
+			}, timeout, interval).Should(BeTrue())
+
+			By("By disabling the redis")
+			createdMyAppResource.Spec.Redis.Enabled = false
+			Expect(k8sClient.Update(ctx, createdMyAppResource)).Should(Succeed())
+
+			By("By checking the redis gets deleted")
+			Eventually(func() error {
+				return k8sClient.Get(ctx, redisLookupKey, &appsv1.StatefulSet{})
+			}, timeout, interval).ShouldNot(Succeed())
+			Eventually(func() error {
+				return k8sClient.Get(ctx, headlessLookupKey, &corev1.Service{})
+			}, timeout, interval).ShouldNot(Succeed())
+
+			Eventually(func() (*metav1.Condition, error) {
+				err := k8sClient.Get(ctx, lookupKey, createdMyAppResource)
+				if err != nil {
+					return nil, err
+				}
+				return meta.FindStatusCondition(createdMyAppResource.Status.Conditions, v1beta1.ConditionTypeRedisStorageBound), nil
+			}, timeout, interval).Should(BeNil())
+
+			// the claim is left behind so the data survives, clean it up here
+			Expect(k8sClient.Delete(ctx, claim)).Should(Succeed())
+		})
+	})
+})
+
+var _ = Describe("MyAppResource controller - Redis Sentinel", func() {
+
+	const (
+		MyAppResourceName      = "replicated"
+		MyAppResourceNamespace = "default"
+
+		timeout  = time.Second * 10
+		interval = time.Millisecond * 250
+	)
+
+	AfterEach(func() {
+		lookupKey := types.NamespacedName{Name: MyAppResourceName, Namespace: MyAppResourceNamespace}
+
+		// cleanup myappresource
+		Eventually(func() error {
+			myApp := &v1beta1.MyAppResource{}
+			k8sClient.Get(context.Background(), lookupKey, myApp)
+			return k8sClient.Delete(context.Background(), myApp)
+		}, timeout, interval).Should(Succeed())
+
+		Eventually(func() error {
+			myApp := &v1beta1.MyAppResource{}
+			return k8sClient.Get(context.Background(), lookupKey, myApp)
+		}, timeout, interval).ShouldNot(Succeed())
+
+		// cleanup podinfo deployment
+		Eventually(func() error {
+			podInfo := &appsv1.Deployment{}
+			k8sClient.Get(context.Background(), lookupKey, podInfo)
+			return k8sClient.Delete(context.Background(), podInfo)
+		}, timeout, interval).Should(Succeed())
+
+		// cleanup the redis pods, there is no statefulset controller to do it
+		Expect(k8sClient.DeleteAllOf(context.Background(), &corev1.Pod{}, client.InNamespace(MyAppResourceNamespace),
+			client.MatchingLabels{"app": redis.GetDeploymentName(MyAppResourceName)}, client.GracePeriodSeconds(0))).Should(Succeed())
+
+		redisInspector.set("", 0)
+	})
+
+	Context("When creating MyAppResource in sentinel mode", func() {
+
+		It("Should point the Redis Service at the primary Sentinel reports", func() {
+			By("By creating a new MyAppResource in sentinel mode")
+			ctx := context.Background()
+
+			myAppResource := &v1beta1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      MyAppResourceName,
+					Namespace: MyAppResourceNamespace,
+				},
+				Spec: v1beta1.MyAppResourceSpec{
+					UI: v1beta1.UI{
+						Color:   "#34577c",
+						Message: "some message",
+					},
+					Redis: v1beta1.Redis{
+						Enabled: true,
+						Mode:    v1beta1.RedisModeSentinel,
+					},
+				},
+			}
+
+			Expect(k8sClient.Create(ctx, myAppResource)).Should(Succeed())
+
+			lookupKey := types.NamespacedName{Name: MyAppResourceName, Namespace: MyAppResourceNamespace}
+			redisLookupKey := types.NamespacedName{Name: redis.GetDeploymentName(MyAppResourceName), Namespace: MyAppResourceNamespace}
+			sentinelLookupKey := types.NamespacedName{Name: redis.GetSentinelName(MyAppResourceName), Namespace: MyAppResourceNamespace}
+
+			By("By checking the sentinel defaults")
+			createdMyAppResource := &v1beta1.MyAppResource{}
+			Expect(k8sClient.Get(ctx, lookupKey, createdMyAppResource)).Should(Succeed())
+			Expect(createdMyAppResource.Spec.Redis.Sentinel).Should(BeNil())
+
+			By("By checking the redis and sentinel statefulsets")
+			redisStatefulSet := &appsv1.StatefulSet{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, redisLookupKey, redisStatefulSet)
+			}, timeout, interval).Should(Succeed())
+			Expect(*redisStatefulSet.Spec.Replicas).Should(Equal(int32(3)))
+
+			sentinelStatefulSet := &appsv1.StatefulSet{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, sentinelLookupKey, sentinelStatefulSet)
+			}, timeout, interval).Should(Succeed())
+			Expect(*sentinelStatefulSet.Spec.Replicas).Should(Equal(int32(3)))
+			Expect(k8sClient.Get(ctx, sentinelLookupKey, &corev1.Service{})).Should(Succeed())
+
+			redisService := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, redisLookupKey, redisService)).Should(Succeed())
+			Expect(redisService.Spec.Selector).Should(HaveKeyWithValue(redis.RoleLabel, redis.RolePrimary))
+
+			By("By creating the pods the statefulset controller would create")
+			for i := 0; i < 3; i++ {
+				pod := &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      redis.GetPodName(MyAppResourceName, i),
+						Namespace: MyAppResourceNamespace,
+						Labels:    redisStatefulSet.Spec.Template.Labels,
+					},
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{Name: "redis", Image: "redis/redis-stack:latest"}},
+					},
+				}
+				Expect(k8sClient.Create(ctx, pod)).Should(Succeed())
+				pod.Status.PodIP = fmt.Sprintf("10.0.0.%d", i+1)
+				Expect(k8sClient.Status().Update(ctx, pod)).Should(Succeed())
+			}
+
+			By("By failing over to the second pod")
+			redisInspector.set(redis.GetPodHost(redis.GetPodName(MyAppResourceName, 1), MyAppResourceName, MyAppResourceNamespace, config.DefaultClusterDomain), 2)
+
+			// touch the resource, rather than waiting for the periodic resync
+			Expect(k8sClient.Get(ctx, lookupKey, createdMyAppResource)).Should(Succeed())
+			createdMyAppResource.Spec.UI.Message = "failed over"
+			Expect(k8sClient.Update(ctx, createdMyAppResource)).Should(Succeed())
+
+			By("By checking the status reports the new primary")
+			Eventually(func() (string, error) {
+				err := k8sClient.Get(ctx, lookupKey, createdMyAppResource)
+				if err != nil {
+					return "", err
+				}
+				return createdMyAppResource.Status.RedisPrimary, nil
+			}, timeout, interval).Should(Equal(redis.GetPodName(MyAppResourceName, 1)))
+			Expect(createdMyAppResource.Status.RedisReplicasInSync).Should(Equal(int32(2)))
+
+			By("By checking only the primary is labeled as primary")
+			for i, role := range []string{redis.RoleReplica, redis.RolePrimary, redis.RoleReplica} {
+				pod := &corev1.Pod{}
+				podLookupKey := types.NamespacedName{Name: redis.GetPodName(MyAppResourceName, i), Namespace: MyAppResourceNamespace}
+				Expect(k8sClient.Get(ctx, podLookupKey, pod)).Should(Succeed())
+				Expect(pod.Labels).Should(HaveKeyWithValue(redis.RoleLabel, role))
+			}
+
+			By("By switching to standalone mode")
+			createdMyAppResource.Spec.Redis.Mode = v1beta1.RedisModeStandalone
+			Expect(k8sClient.Update(ctx, createdMyAppResource)).Should(Succeed())
+
+			By("By checking the sentinels and the statefulset get deleted")
+			Eventually(func() error {
+				return k8sClient.Get(ctx, sentinelLookupKey, &appsv1.StatefulSet{})
+			}, timeout, interval).ShouldNot(Succeed())
+			Eventually(func() error {
+				return k8sClient.Get(ctx, redisLookupKey, &appsv1.StatefulSet{})
+			}, timeout, interval).ShouldNot(Succeed())
+			Eventually(func() error {
+				return k8sClient.Get(ctx, redisLookupKey, &appsv1.Deployment{})
+			}, timeout, interval).Should(Succeed())
+
+			Eventually(func() (string, error) {
+				err := k8sClient.Get(ctx, lookupKey, createdMyAppResource)
+				if err != nil {
+					return "", err
+				}
+				return createdMyAppResource.Status.RedisPrimary, nil
+			}, timeout, interval).Should(BeEmpty())
+
+			By("By disabling the redis")
+			createdMyAppResource.Spec.Redis.Enabled = false
+			Expect(k8sClient.Update(ctx, createdMyAppResource)).Should(Succeed())
+			Eventually(func() error {
+				return k8sClient.Get(ctx, redisLookupKey, &appsv1.Deployment{})
+			}, timeout, interval).ShouldNot(Succeed())
 		})
 	})
 })
 
+var _ = Describe("MyAppResource controller - Deletion policy", func() {
+
+	const (
+		MyAppResourceName      = "deleted"
+		MyAppResourceNamespace = "default"
+
+		timeout  = time.Second * 10
+		interval = time.Millisecond * 250
+	)
+
+	AfterEach(func() {
+		// there is no garbage collector in the test environment, cleanup what the tests leave behind
+		for _, child := range []struct {
+			name string
+			obj  client.Object
+		}{
+			{MyAppResourceName, &appsv1.Deployment{}},
+			{MyAppResourceName, &corev1.Service{}},
+			{redis.GetDeploymentName(MyAppResourceName), &appsv1.Deployment{}},
+			{redis.GetDeploymentName(MyAppResourceName), &corev1.Service{}},
+			{redis.GetAuthSecretName(MyAppResourceName), &corev1.Secret{}},
+			{redis.GetSnapshotName(MyAppResourceName), &batchv1.Job{}},
+			{redis.GetSnapshotName(MyAppResourceName), &corev1.PersistentVolumeClaim{}},
+		} {
+			child.obj.SetName(child.name)
+			child.obj.SetNamespace(MyAppResourceNamespace)
+			Expect(client.IgnoreNotFound(k8sClient.Delete(context.Background(), child.obj))).Should(Succeed())
+		}
+	})
+
+	It("Should leave the children running with the Orphan policy", func() {
+		By("By creating a new MyAppResource with the Orphan policy")
+		ctx := context.Background()
+
+		myAppResource := &v1beta1.MyAppResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      MyAppResourceName,
+				Namespace: MyAppResourceNamespace,
+			},
+			Spec: v1beta1.MyAppResourceSpec{
+				UI: v1beta1.UI{
+					Color:   "#34577c",
+					Message: "some message",
+				},
+				DeletionPolicy: v1beta1.DeletionPolicyOrphan,
+			},
+		}
+
+		Expect(k8sClient.Create(ctx, myAppResource)).Should(Succeed())
+
+		lookupKey := types.NamespacedName{Name: MyAppResourceName, Namespace: MyAppResourceNamespace}
+		Eventually(func() ([]string, error) {
+			err := k8sClient.Get(ctx, lookupKey, myAppResource)
+			return myAppResource.Finalizers, err
+		}, timeout, interval).Should(ContainElement(myAppResourceFinalizer))
+		Eventually(func() error {
+			return k8sClient.Get(ctx, lookupKey, &corev1.Service{})
+		}, timeout, interval).Should(Succeed())
+
+		By("By deleting the MyAppResource")
+		Expect(k8sClient.Delete(ctx, myAppResource)).Should(Succeed())
+		Eventually(func() error {
+			return k8sClient.Get(ctx, lookupKey, &v1beta1.MyAppResource{})
+		}, timeout, interval).ShouldNot(Succeed())
+
+		By("By checking the children have no owner")
+		podInfoDeployment := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, lookupKey, podInfoDeployment)).Should(Succeed())
+		Expect(podInfoDeployment.OwnerReferences).Should(BeEmpty())
+		podInfoService := &corev1.Service{}
+		Expect(k8sClient.Get(ctx, lookupKey, podInfoService)).Should(Succeed())
+		Expect(podInfoService.OwnerReferences).Should(BeEmpty())
+	})
+
+	It("Should dump Redis before deleting with the Snapshot policy", func() {
+		By("By creating a new MyAppResource with Redis and the Snapshot policy")
+		ctx := context.Background()
+
+		myAppResource := &v1beta1.MyAppResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      MyAppResourceName,
+				Namespace: MyAppResourceNamespace,
+			},
+			Spec: v1beta1.MyAppResourceSpec{
+				UI: v1beta1.UI{
+					Color:   "#34577c",
+					Message: "some message",
+				},
+				Redis:          v1beta1.Redis{Enabled: true},
+				DeletionPolicy: v1beta1.DeletionPolicySnapshot,
+			},
+		}
+
+		Expect(k8sClient.Create(ctx, myAppResource)).Should(Succeed())
+
+		lookupKey := types.NamespacedName{Name: MyAppResourceName, Namespace: MyAppResourceNamespace}
+		Eventually(func() ([]string, error) {
+			err := k8sClient.Get(ctx, lookupKey, myAppResource)
+			return myAppResource.Finalizers, err
+		}, timeout, interval).Should(ContainElement(myAppResourceFinalizer))
+
+		By("By deleting the MyAppResource")
+		Expect(k8sClient.Delete(ctx, myAppResource)).Should(Succeed())
+
+		By("By checking the snapshot Job dumps to a claim without owner")
+		snapshotLookupKey := types.NamespacedName{Name: redis.GetSnapshotName(MyAppResourceName), Namespace: MyAppResourceNamespace}
+		job := &batchv1.Job{}
+		Eventually(func() error {
+			return k8sClient.Get(ctx, snapshotLookupKey, job)
+		}, timeout, interval).Should(Succeed())
+		Expect(job.Spec.Template.Spec.Volumes[0].PersistentVolumeClaim.ClaimName).Should(Equal(snapshotLookupKey.Name))
+		claim := &corev1.PersistentVolumeClaim{}
+		Expect(k8sClient.Get(ctx, snapshotLookupKey, claim)).Should(Succeed())
+		Expect(claim.OwnerReferences).Should(BeEmpty())
+
+		Consistently(func() error {
+			return k8sClient.Get(ctx, lookupKey, &v1beta1.MyAppResource{})
+		}, time.Second, interval).Should(Succeed())
+
+		By("By failing the snapshot Job")
+		job.Status.Failed = 1
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "backoff limit exceeded"}}
+		Expect(k8sClient.Status().Update(ctx, job)).Should(Succeed())
+
+		By("By checking the failure is recorded as events")
+		Eventually(func() ([]string, error) {
+			return getEvents(ctx, myAppResource)
+		}, timeout, interval).Should(ContainElements(
+			"Normal SnapshotStarted Started Job deleted-redis-snapshot dumping Redis to PersistentVolumeClaim deleted-redis-snapshot",
+			"Warning SnapshotFailed Job deleted-redis-snapshot failed: backoff limit exceeded",
+			ContainSubstring("Warning ReconcileFailed Reconcile failed: redis snapshot Job deleted-redis-snapshot failed"),
+		))
+
+		By("By completing the snapshot Job")
+		Expect(k8sClient.Get(ctx, snapshotLookupKey, job)).Should(Succeed())
+		now := metav1.Now()
+		job.Status.StartTime = &now
+		job.Status.CompletionTime = &now
+		job.Status.Succeeded = 1
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+		Expect(k8sClient.Status().Update(ctx, job)).Should(Succeed())
+
+		By("By checking the MyAppResource goes away")
+		Eventually(func() error {
+			return k8sClient.Get(ctx, lookupKey, &v1beta1.MyAppResource{})
+		}, timeout, interval).ShouldNot(Succeed())
+		Eventually(func() ([]string, error) {
+			return getEvents(ctx, myAppResource)
+		}, timeout, interval).Should(ContainElement("Normal SnapshotCompleted Dumped Redis to PersistentVolumeClaim deleted-redis-snapshot"))
+	})
+})
+
 var _ = Describe("MyAppResource controller - error cases", func() {
 
 	It("Should error MyAppResourceName without required fields", func() {
@@ -431,6 +2064,48 @@ var _ = Describe("MyAppResource controller - error cases", func() {
 		}
 		Expect(k8sClient.Create(ctx, myAppResource)).ShouldNot(Succeed())
 
+		By("By creating a new MyAppResourceName with trailing characters after the color")
+		myAppResource.Spec.UI.Color = "#123456garbage"
+		Expect(k8sClient.Create(ctx, myAppResource)).ShouldNot(Succeed())
+
 	})
 
 })
+
+// getEvents returns the events recorded on obj, as "<type> <reason> <message>".
+func getEvents(ctx context.Context, obj client.Object) ([]string, error) {
+	events := &corev1.EventList{}
+	if err := k8sClient.List(ctx, events, client.InNamespace(obj.GetNamespace())); err != nil {
+		return nil, err
+	}
+	var recorded []string
+	for _, event := range events.Items {
+		if event.InvolvedObject.UID == obj.GetUID() {
+			recorded = append(recorded, fmt.Sprintf("%s %s %s", event.Type, event.Reason, event.Message))
+		}
+	}
+	return recorded, nil
+}
+
+// hasSeries returns true when c collects a series with exactly the label values, in any order.
+func hasSeries(c prometheus.Collector, labelValues ...string) bool {
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(metrics)
+		close(metrics)
+	}()
+
+	found := false
+	for metric := range metrics {
+		written := &dto.Metric{}
+		Expect(metric.Write(written)).Should(Succeed())
+		var values []string
+		for _, label := range written.Label {
+			values = append(values, label.GetValue())
+		}
+		if match, err := ConsistOf(labelValues).Match(values); err == nil && match {
+			found = true
+		}
+	}
+	return found
+}
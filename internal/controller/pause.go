@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/domenicbove/angi/api/v1beta1"
+)
+
+// isPaused returns true when the PausedAnnotation stops the operator from changing the child objects.
+func isPaused(myAppResource v1beta1.MyAppResource) bool {
+	return myAppResource.Annotations[v1beta1.PausedAnnotation] == "true"
+}
+
+// refreshStatus refreshes the status of a paused MyAppResource, or one that violates the image policy,
+// from its child objects without changing any of them. Redis is not queried, so its primary and replicas
+// in sync are kept as reported last.
+func (r *MyAppResourceReconciler) refreshStatus(ctx context.Context, myAppResource v1beta1.MyAppResource, log logr.Logger) error {
+	// the canary rollout does not move on while the child objects are held
+	podInfo := &podInfoState{canary: canaryPlan{status: myAppResource.Status.Canary}}
+	deployment := &appsv1.Deployment{}
+	err := r.Get(ctx, client.ObjectKeyFromObject(&myAppResource), deployment)
+	if client.IgnoreNotFound(err) != nil {
+		log.Error(err, "failed to get Deployment for MyAppResource", "myappresource", myAppResource.Name, "deployment", myAppResource.Name)
+		recordReconcileError(myAppResource.Namespace, myAppResource.Name, phasePodInfo)
+		return err
+	}
+	if !errors.IsNotFound(err) {
+		podInfo.deployment = deployment
+	}
+
+	redisState, err := r.observeRedis(ctx, myAppResource, log)
+	if err != nil {
+		recordReconcileError(myAppResource.Namespace, myAppResource.Name, phaseRedis)
+		return err
+	}
+
+	if err := r.updateStatus(ctx, myAppResource, podInfo, redisState); err != nil {
+		log.Error(err, "failed to update MyAppResource status", "myappresource", myAppResource.Name)
+		recordReconcileError(myAppResource.Namespace, myAppResource.Name, phaseStatus)
+		return err
+	}
+	recordReconcileSuccess(myAppResource.Namespace, myAppResource.Name)
+
+	return nil
+}
@@ -0,0 +1,570 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/domenicbove/angi/api/v1beta1"
+	"github.com/domenicbove/angi/internal/redis"
+)
+
+// redisReplicationSyncPeriod is how often the replication state is refreshed in replication and
+// sentinel mode, since a failover or a replica falling behind changes no Kubernetes object.
+const redisReplicationSyncPeriod = 30 * time.Second
+
+// redisState is the observed state of the Redis workload, used to update the MyAppResource status.
+type redisState struct {
+	rollout         rolloutStatus
+	desiredReplicas int32
+	readyReplicas   int32
+	// persistent is true when Redis runs as a StatefulSet backed by a PersistentVolumeClaim.
+	persistent bool
+	// claim is the PersistentVolumeClaim of a persistent Redis, nil while it does not exist yet.
+	claim *corev1.PersistentVolumeClaim
+	// primary is the pod serving as the primary in replication and sentinel mode.
+	primary string
+	// replicasInSync is the number of replicas in sync with the primary.
+	replicasInSync int32
+	// connection is how PodInfo reaches Redis, nil while a RedisCache has not given the MyAppResource a database.
+	connection *redis.Connection
+	// source is where the Redis comes from.
+	source v1beta1.RedisSource
+}
+
+// reconcileRedis creates or updates the Redis workload that matches the spec, and removes
+// the Redis objects that no longer apply. It returns the state of the RedisCache or external Redis
+// in use instead when cacheRef or external is set, and nil when there is no Redis.
+func (r *MyAppResourceReconciler) reconcileRedis(ctx context.Context, myAppResource v1beta1.MyAppResource, log logr.Logger) (*redisState, error) {
+	name := redis.GetDeploymentName(myAppResource.Name)
+	lookupKey := client.ObjectKey{Namespace: myAppResource.Namespace, Name: name}
+	headlessLookupKey := client.ObjectKey{Namespace: myAppResource.Namespace, Name: redis.GetHeadlessServiceName(myAppResource.Name)}
+	authLookupKey := client.ObjectKey{Namespace: myAppResource.Namespace, Name: redis.GetAuthSecretName(myAppResource.Name)}
+	sentinelLookupKey := client.ObjectKey{Namespace: myAppResource.Namespace, Name: redis.GetSentinelName(myAppResource.Name)}
+
+	// in the case someone disables redis after enabling it, it should be cleaned up
+	if !myAppResource.Spec.Redis.Enabled {
+		for _, child := range []struct {
+			key client.ObjectKey
+			obj client.Object
+		}{
+			{lookupKey, &appsv1.Deployment{}},
+			{lookupKey, &appsv1.StatefulSet{}},
+			{lookupKey, &corev1.Service{}},
+			{headlessLookupKey, &corev1.Service{}},
+			{lookupKey, &policyv1.PodDisruptionBudget{}},
+			{sentinelLookupKey, &appsv1.StatefulSet{}},
+			{sentinelLookupKey, &corev1.Service{}},
+			{authLookupKey, &corev1.Secret{}},
+		} {
+			if err := r.deleteIfExists(ctx, child.key, child.obj, log); err != nil {
+				return nil, err
+			}
+		}
+		if myAppResource.Spec.Redis.CacheRef != nil {
+			return r.observeRedisCache(ctx, myAppResource, log)
+		}
+		if myAppResource.Spec.Redis.External != nil {
+			return getExternalRedisState(myAppResource), nil
+		}
+		return nil, nil
+	}
+
+	if err := r.reconcileRedisAuth(ctx, myAppResource, authLookupKey, log); err != nil {
+		return nil, err
+	}
+
+	var state *redisState
+	if myAppResource.Spec.Redis.Persistence == nil && !redis.IsReplicated(myAppResource) {
+		// switching persistence off leaves the claim in place, so the data is kept
+		if err := r.deleteIfExists(ctx, lookupKey, &appsv1.StatefulSet{}, log); err != nil {
+			return nil, err
+		}
+		if err := r.deleteIfExists(ctx, headlessLookupKey, &corev1.Service{}, log); err != nil {
+			return nil, err
+		}
+
+		redisDeployment, err := r.createOrUpdateDeployment(ctx, name, myAppResource.Namespace,
+			redis.ConstructRedisDeployment(myAppResource, r.Config), log)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := r.createOrUpdate(ctx, redis.ConstructRedisService(myAppResource), log); err != nil {
+			return nil, err
+		}
+
+		state = &redisState{
+			rollout:         getRolloutStatus(redisDeployment),
+			desiredReplicas: *redisDeployment.Spec.Replicas,
+			readyReplicas:   redisDeployment.Status.ReadyReplicas,
+		}
+	} else {
+		var err error
+		if state, err = r.reconcileRedisStatefulSet(ctx, myAppResource, log); err != nil {
+			return nil, err
+		}
+	}
+
+	if pdb := redis.ConstructRedisPodDisruptionBudget(myAppResource); pdb == nil {
+		if err := r.deleteIfExists(ctx, lookupKey, &policyv1.PodDisruptionBudget{}, log); err != nil {
+			return nil, err
+		}
+	} else if _, err := r.createOrUpdate(ctx, pdb, log); err != nil {
+		return nil, err
+	}
+
+	if redis.GetMode(myAppResource) != v1beta1.RedisModeSentinel {
+		if err := r.deleteIfExists(ctx, sentinelLookupKey, &appsv1.StatefulSet{}, log); err != nil {
+			return nil, err
+		}
+		if err := r.deleteIfExists(ctx, sentinelLookupKey, &corev1.Service{}, log); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := r.createOrUpdate(ctx, redis.ConstructRedisSentinelService(myAppResource), log); err != nil {
+			return nil, err
+		}
+
+		sentinelStatefulSet, err := r.createOrUpdateStatefulSet(ctx, sentinelLookupKey.Name, myAppResource.Namespace,
+			redis.ConstructRedisSentinelStatefulSet(myAppResource, r.Config), log)
+		if err != nil {
+			return nil, err
+		}
+
+		// redis is only ready once the sentinels are too
+		if sentinelRollout := getStatefulSetRolloutStatus(sentinelStatefulSet); state.rollout.Complete || sentinelRollout.Stalled {
+			state.rollout = sentinelRollout
+		}
+	}
+
+	if redis.IsReplicated(myAppResource) {
+		if err := r.reconcileRedisReplication(ctx, myAppResource, state, log); err != nil {
+			return nil, err
+		}
+	}
+	state.connection = redis.GetConnection(myAppResource, r.Config.ClusterDomain)
+	state.source = v1beta1.RedisSourceManaged
+
+	return state, nil
+}
+
+// reconcileRedisStatefulSet creates or updates the Redis StatefulSet, used with persistence
+// and in replication and sentinel mode.
+func (r *MyAppResourceReconciler) reconcileRedisStatefulSet(ctx context.Context, myAppResource v1beta1.MyAppResource, log logr.Logger) (*redisState, error) {
+	name := redis.GetDeploymentName(myAppResource.Name)
+
+	if err := r.deleteIfExists(ctx, client.ObjectKey{Namespace: myAppResource.Namespace, Name: name}, &appsv1.Deployment{}, log); err != nil {
+		return nil, err
+	}
+
+	if _, err := r.createOrUpdate(ctx, redis.ConstructRedisHeadlessService(myAppResource), log); err != nil {
+		return nil, err
+	}
+
+	redisStatefulSet, err := r.createOrUpdateStatefulSet(ctx, name, myAppResource.Namespace,
+		redis.ConstructRedisStatefulSet(myAppResource, r.Config), log)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := r.createOrUpdate(ctx, redis.ConstructRedisService(myAppResource), log); err != nil {
+		return nil, err
+	}
+
+	state := &redisState{
+		rollout:         getStatefulSetRolloutStatus(redisStatefulSet),
+		desiredReplicas: *redisStatefulSet.Spec.Replicas,
+		readyReplicas:   redisStatefulSet.Status.ReadyReplicas,
+		persistent:      myAppResource.Spec.Redis.Persistence != nil,
+	}
+	if state.persistent {
+		if state.claim, err = r.getRedisClaim(ctx, myAppResource, log); err != nil {
+			return nil, err
+		}
+	}
+
+	return state, nil
+}
+
+// getRedisClaim returns the PersistentVolumeClaim of a persistent Redis, or nil when the
+// StatefulSet controller has not created it yet.
+func (r *MyAppResourceReconciler) getRedisClaim(ctx context.Context, myAppResource v1beta1.MyAppResource, log logr.Logger) (*corev1.PersistentVolumeClaim, error) {
+	claim := &corev1.PersistentVolumeClaim{}
+	claimKey := client.ObjectKey{Namespace: myAppResource.Namespace, Name: redis.GetPersistentVolumeClaimName(myAppResource.Name)}
+	err := r.Client.Get(ctx, claimKey, claim)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		log.Error(err, "unable to fetch Redis PersistentVolumeClaim", "persistentvolumeclaim", claimKey.Name)
+		return nil, err
+	}
+
+	return claim, nil
+}
+
+// observeRedis returns the state of the Redis workload as reconcileRedis reports it, without
+// changing anything. The primary and replicas in sync are taken from the status. It returns nil
+// when there is no Redis.
+func (r *MyAppResourceReconciler) observeRedis(ctx context.Context, myAppResource v1beta1.MyAppResource, log logr.Logger) (*redisState, error) {
+	if myAppResource.Spec.Redis.CacheRef != nil {
+		return r.observeRedisCache(ctx, myAppResource, log)
+	}
+	if myAppResource.Spec.Redis.External != nil {
+		return getExternalRedisState(myAppResource), nil
+	}
+	if !myAppResource.Spec.Redis.Enabled {
+		return nil, nil
+	}
+
+	name := redis.GetDeploymentName(myAppResource.Name)
+	state := &redisState{
+		rollout:        getMissingRolloutStatus("Deployment", name),
+		persistent:     myAppResource.Spec.Redis.Persistence != nil,
+		primary:        myAppResource.Status.RedisPrimary,
+		replicasInSync: myAppResource.Status.RedisReplicasInSync,
+		connection:     redis.GetConnection(myAppResource, r.Config.ClusterDomain),
+		source:         v1beta1.RedisSourceManaged,
+	}
+	lookupKey := client.ObjectKey{Namespace: myAppResource.Namespace, Name: name}
+
+	if myAppResource.Spec.Redis.Persistence == nil && !redis.IsReplicated(myAppResource) {
+		deployment := &appsv1.Deployment{}
+		err := r.Get(ctx, lookupKey, deployment)
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "failed to get Deployment for MyAppResource", "myappresource", myAppResource.Name, "deployment", name)
+			return nil, err
+		}
+		if err == nil {
+			state.rollout = getRolloutStatus(deployment)
+			state.desiredReplicas = *deployment.Spec.Replicas
+			state.readyReplicas = deployment.Status.ReadyReplicas
+		}
+	} else {
+		state.rollout = getMissingRolloutStatus("StatefulSet", name)
+		statefulSet := &appsv1.StatefulSet{}
+		err := r.Get(ctx, lookupKey, statefulSet)
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "failed to get StatefulSet for MyAppResource", "myappresource", myAppResource.Name, "statefulset", name)
+			return nil, err
+		}
+		if err == nil {
+			state.rollout = getStatefulSetRolloutStatus(statefulSet)
+			state.desiredReplicas = *statefulSet.Spec.Replicas
+			state.readyReplicas = statefulSet.Status.ReadyReplicas
+		}
+	}
+
+	if state.persistent {
+		var err error
+		if state.claim, err = r.getRedisClaim(ctx, myAppResource, log); err != nil {
+			return nil, err
+		}
+	}
+
+	if redis.GetMode(myAppResource) == v1beta1.RedisModeSentinel {
+		sentinelName := redis.GetSentinelName(myAppResource.Name)
+		sentinelRollout := getMissingRolloutStatus("StatefulSet", sentinelName)
+		sentinelStatefulSet := &appsv1.StatefulSet{}
+		err := r.Get(ctx, client.ObjectKey{Namespace: myAppResource.Namespace, Name: sentinelName}, sentinelStatefulSet)
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "failed to get StatefulSet for MyAppResource", "myappresource", myAppResource.Name, "statefulset", sentinelName)
+			return nil, err
+		}
+		if err == nil {
+			sentinelRollout = getStatefulSetRolloutStatus(sentinelStatefulSet)
+		}
+
+		// redis is only ready once the sentinels are too
+		if state.rollout.Complete || sentinelRollout.Stalled {
+			state.rollout = sentinelRollout
+		}
+	}
+
+	return state, nil
+}
+
+// observeRedisCache returns the state of the RedisCache set in cacheRef, its rollout is the Ready
+// condition of the RedisCache. There is no connection until the RedisCache lists the MyAppResource
+// among its consumers with a database.
+func (r *MyAppResourceReconciler) observeRedisCache(ctx context.Context, myAppResource v1beta1.MyAppResource, log logr.Logger) (*redisState, error) {
+	name := myAppResource.Spec.Redis.CacheRef.Name
+	state := &redisState{desiredReplicas: 1, source: v1beta1.RedisSourceRedisCache}
+
+	redisCache := &v1beta1.RedisCache{}
+	err := r.Get(ctx, client.ObjectKey{Namespace: myAppResource.Namespace, Name: name}, redisCache)
+	if errors.IsNotFound(err) {
+		state.rollout = rolloutStatus{
+			Reason:  v1beta1.ReasonRedisCacheNotFound,
+			Message: fmt.Sprintf("RedisCache %s does not exist", name),
+		}
+		return state, nil
+	}
+	if err != nil {
+		log.Error(err, "unable to fetch RedisCache", "rediscache", name)
+		return nil, err
+	}
+	state.readyReplicas = redisCache.Status.ReadyReplicas
+
+	var consumer *v1beta1.RedisCacheConsumer
+	for i := range redisCache.Status.Consumers {
+		if redisCache.Status.Consumers[i].Name == myAppResource.Name {
+			consumer = &redisCache.Status.Consumers[i]
+		}
+	}
+	switch {
+	case consumer == nil:
+		state.rollout = rolloutStatus{
+			Reason:  v1beta1.ReasonDeploymentPending,
+			Message: fmt.Sprintf("waiting for RedisCache %s to list the MyAppResource as a consumer", name),
+		}
+		return state, nil
+	case consumer.Database == nil:
+		state.rollout = rolloutStatus{
+			Reason:  v1beta1.ReasonRedisCacheFull,
+			Message: fmt.Sprintf("RedisCache %s has no free database", name),
+		}
+		return state, nil
+	}
+	state.connection = redis.GetCacheConnection(*redisCache, *consumer, r.Config.ClusterDomain)
+
+	ready := meta.FindStatusCondition(redisCache.Status.Conditions, v1beta1.ConditionTypeReady)
+	if ready == nil {
+		state.rollout = rolloutStatus{
+			Reason:  v1beta1.ReasonDeploymentPending,
+			Message: fmt.Sprintf("waiting for RedisCache %s to report whether it is ready", name),
+		}
+		return state, nil
+	}
+	state.rollout = rolloutStatus{
+		Complete: ready.Status == metav1.ConditionTrue,
+		Stalled:  warningReasons[ready.Reason],
+		Reason:   ready.Reason,
+		Message:  fmt.Sprintf("RedisCache %s: %s", name, ready.Message),
+	}
+
+	return state, nil
+}
+
+// getExternalRedisState returns the state of the Redis set in external. The operator does not manage
+// it, so it is reported ready and its replicas are not counted.
+func getExternalRedisState(myAppResource v1beta1.MyAppResource) *redisState {
+	connection := redis.GetExternalConnection(*myAppResource.Spec.Redis.External)
+
+	return &redisState{
+		rollout: rolloutStatus{
+			Complete: true,
+			Reason:   v1beta1.ReasonExternalRedis,
+			Message:  fmt.Sprintf("PodInfo uses the external Redis at %s, which is not managed by the operator", connection.GetEndpoint()),
+		},
+		connection: connection,
+		source:     v1beta1.RedisSourceExternal,
+	}
+}
+
+// reconcileRedisReplication labels the current primary pod, so the Redis Service follows it, and
+// records the primary and the number of replicas in sync with it. In replication mode the first
+// pod is always the primary, in sentinel mode the primary is asked from Sentinel.
+func (r *MyAppResourceReconciler) reconcileRedisReplication(ctx context.Context, myAppResource v1beta1.MyAppResource, state *redisState, log logr.Logger) error {
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(myAppResource.Namespace),
+		client.MatchingLabels{"app": redis.GetDeploymentName(myAppResource.Name)}); err != nil {
+		log.Error(err, "unable to list Redis pods")
+		return err
+	}
+
+	primary := r.getRedisPrimary(ctx, myAppResource, pods.Items, log)
+
+	var primaryPod *corev1.Pod
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		role := redis.RoleReplica
+		if pod.Name == primary {
+			role = redis.RolePrimary
+			primaryPod = pod
+		}
+		if pod.Labels[redis.RoleLabel] == role {
+			continue
+		}
+
+		patch := client.MergeFrom(pod.DeepCopy())
+		pod.Labels[redis.RoleLabel] = role
+		if err := r.Patch(ctx, pod, patch); client.IgnoreNotFound(err) != nil {
+			log.Error(err, "unable to label Redis pod", "pod", pod.Name, "role", role)
+			return err
+		}
+		log.V(1).Info("labeled Redis pod", "pod", pod.Name, "role", role)
+	}
+
+	if primaryPod == nil {
+		return nil
+	}
+	state.primary = primaryPod.Name
+
+	if r.RedisInspector == nil || primaryPod.Status.PodIP == "" {
+		return nil
+	}
+	password, err := r.getRedisPassword(ctx, myAppResource)
+	if err != nil {
+		log.Error(err, "unable to read the Redis password")
+		return nil
+	}
+	inSync, err := r.RedisInspector.GetReplicasInSync(ctx, net.JoinHostPort(primaryPod.Status.PodIP, strconv.Itoa(redis.RedisPort)), password)
+	if err != nil {
+		// an unreachable primary shows up as no replicas in sync, rather than failing the reconcile
+		log.Error(err, "unable to query Redis replication", "pod", primaryPod.Name)
+		return nil
+	}
+	state.replicasInSync = inSync
+
+	return nil
+}
+
+// getRedisPrimary returns the name of the pod that should be labeled as the primary. When Sentinel
+// can not be asked, the pod already labeled as the primary is kept, or the first pod is used.
+func (r *MyAppResourceReconciler) getRedisPrimary(ctx context.Context, myAppResource v1beta1.MyAppResource, pods []corev1.Pod, log logr.Logger) string {
+	primary := redis.GetPodName(myAppResource.Name, 0)
+	if redis.GetMode(myAppResource) != v1beta1.RedisModeSentinel {
+		return primary
+	}
+
+	for _, pod := range pods {
+		if pod.Labels[redis.RoleLabel] == redis.RolePrimary {
+			primary = pod.Name
+		}
+	}
+
+	if r.RedisInspector == nil {
+		return primary
+	}
+	sentinelAddr := net.JoinHostPort(redis.GetSentinelHost(myAppResource.Name, myAppResource.Namespace, r.Config.ClusterDomain), strconv.Itoa(redis.SentinelPort))
+	host, err := r.RedisInspector.GetPrimary(ctx, sentinelAddr)
+	if err != nil {
+		log.Error(err, "unable to ask Sentinel for the Redis primary", "sentinel", sentinelAddr)
+		return primary
+	}
+
+	// pods announce their stable DNS name, which starts with the pod name
+	return strings.SplitN(host, ".", 2)[0]
+}
+
+// getRedisPassword reads the Redis password from its Secret.
+func (r *MyAppResourceReconciler) getRedisPassword(ctx context.Context, myAppResource v1beta1.MyAppResource) (string, error) {
+	selector := redis.GetPasswordSecretKeySelector(myAppResource)
+
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: myAppResource.Namespace, Name: selector.Name}, secret); err != nil {
+		return "", err
+	}
+	password, ok := secret.Data[selector.Key]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no key %s", selector.Name, selector.Key)
+	}
+
+	return string(password), nil
+}
+
+// reconcileEncodedRedisPassword writes the percent-encoded password of the Redis PodInfo uses into a
+// Secret owned by the MyAppResource, since Kubernetes expands the password into the cache server URL as
+// is. A password Secret or key that does not exist yet leaves it as it is.
+func (r *MyAppResourceReconciler) reconcileEncodedRedisPassword(ctx context.Context, myAppResource v1beta1.MyAppResource, state *redisState, log logr.Logger) error {
+	key := client.ObjectKey{Namespace: myAppResource.Namespace, Name: redis.GetEncodedPasswordSecretName(myAppResource.Name)}
+	if state == nil || state.connection == nil || state.connection.Password == nil {
+		return r.deleteIfExists(ctx, key, &corev1.Secret{}, log)
+	}
+	selector := state.connection.Password
+
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: myAppResource.Namespace, Name: selector.Name}, secret); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		log.Error(err, "unable to fetch the Redis password Secret", "secret", selector.Name)
+		return err
+	}
+	password, ok := secret.Data[selector.Key]
+	if !ok {
+		return nil
+	}
+
+	_, err := r.createOrUpdate(ctx, redis.ConstructEncodedPasswordSecret(myAppResource, string(password)), log)
+	return err
+}
+
+// getPasswordSecretName returns the name of the Secret holding the password of the Redis the MyAppResource
+// uses, or an empty name when it uses none.
+func (r *MyAppResourceReconciler) getPasswordSecretName(ctx context.Context, myAppResource v1beta1.MyAppResource) string {
+	spec := myAppResource.Spec.Redis
+	switch {
+	case spec.Enabled:
+		return redis.GetPasswordSecretKeySelector(myAppResource).Name
+	case spec.CacheRef != nil:
+		redisCache := &v1beta1.RedisCache{}
+		if err := r.Get(ctx, client.ObjectKey{Namespace: myAppResource.Namespace, Name: spec.CacheRef.Name}, redisCache); err != nil {
+			return ""
+		}
+		return redis.GetCachePasswordSecretKeySelector(*redisCache).Name
+	case spec.External != nil && spec.External.CredentialsSecretRef != nil:
+		return spec.External.CredentialsSecretRef.Name
+	}
+	return ""
+}
+
+// reconcileRedisAuth makes sure the generated Redis password Secret exists, unless the
+// password comes from an existingSecretRef. A generated password is never rotated.
+func (r *MyAppResourceReconciler) reconcileRedisAuth(ctx context.Context, myAppResource v1beta1.MyAppResource, key client.ObjectKey, log logr.Logger) error {
+	if auth := myAppResource.Spec.Redis.Auth; auth != nil && auth.ExistingSecretRef != nil {
+		return r.deleteIfExists(ctx, key, &corev1.Secret{}, log)
+	}
+
+	secret := &corev1.Secret{}
+	err := r.Client.Get(ctx, key, secret)
+	if client.IgnoreNotFound(err) != nil {
+		log.Error(err, "unable to fetch Redis auth Secret", "secret", key.Name)
+		return err
+	}
+	found := err == nil
+	if found && len(secret.Data[redis.PasswordKey]) > 0 {
+		return nil
+	}
+
+	password, err := redis.GeneratePassword()
+	if err != nil {
+		return err
+	}
+	updatedSecret := redis.ConstructRedisAuthSecret(myAppResource, password)
+
+	if !found {
+		if err := r.Create(ctx, updatedSecret); err != nil {
+			log.Error(err, "unable to create Redis auth Secret", "secret", key.Name)
+			return err
+		}
+		log.V(1).Info("created Redis auth Secret for MyAppResource", "secret", key.Name)
+		r.recordEvent(updatedSecret, corev1.EventTypeNormal, eventReasonCreated, "Created Secret %s", key.Name)
+		return nil
+	}
+
+	// the password key was removed, generate a new one
+	secret.Data = updatedSecret.Data
+	if err := r.Update(ctx, secret); err != nil {
+		log.Error(err, "unable to update Redis auth Secret", "secret", key.Name)
+		return err
+	}
+	log.V(1).Info("updated Redis auth Secret for MyAppResource", "secret", key.Name)
+	r.recordEvent(secret, corev1.EventTypeNormal, eventReasonUpdated, "Updated Secret %s", key.Name)
+
+	return nil
+}
@@ -0,0 +1,512 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/domenicbove/angi/api/v1beta1"
+	"github.com/domenicbove/angi/internal/config"
+	"github.com/domenicbove/angi/internal/imagepolicy"
+	"github.com/domenicbove/angi/internal/redis"
+)
+
+// cacheRefKey indexes the MyAppResources by the name of the RedisCache they use.
+const cacheRefKey = ".spec.redis.cacheRef.name"
+
+// cacheFlushRetryPeriod is how often flushing the dirty databases of a RedisCache is retried, while
+// its Redis can not be reached.
+const cacheFlushRetryPeriod = 5 * time.Second
+
+// RedisCacheReconciler reconciles a RedisCache object
+type RedisCacheReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// Recorder records events on the RedisCache about its child objects and reconcile failures.
+	// When nil, no events are recorded.
+	Recorder record.EventRecorder
+	// Config holds the defaults the child objects are built with. It must be defaulted, see config.New.
+	Config config.OperatorConfig
+	// ImagePolicy restricts the Redis image. A RedisCache with an image it does not allow keeps the
+	// image its Redis runs, until the image is changed.
+	ImagePolicy imagepolicy.Policy
+	// RedisInspector flushes the databases freed by consumers. When nil, they are never flushed, so
+	// they are not given to another consumer.
+	RedisInspector redis.Inspector
+
+	applier
+}
+
+//+kubebuilder:rbac:groups=my.api.group,resources=rediscaches,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=my.api.group,resources=rediscaches/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=my.api.group,resources=rediscaches/finalizers,verbs=update
+
+// Reconcile runs the Redis of a RedisCache and hands out its databases to the MyAppResources that
+// use it.
+func (r *RedisCacheReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	var redisCache v1beta1.RedisCache
+	if err := r.Get(ctx, req.NamespacedName, &redisCache); err != nil {
+		// the child objects are garbage collected, and the consumers notice the RedisCache is gone
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "unable to fetch RedisCache")
+		return ctrl.Result{}, err
+	}
+
+	dirty, err := r.reconcile(ctx, redisCache, log)
+	// a conflict only means a newer version of an object is being reconciled, it is not worth alerting on
+	if err != nil && !errors.IsConflict(err) {
+		r.recordEvent(&redisCache, corev1.EventTypeWarning, eventReasonReconcileFailed, "Reconcile failed: %v", err)
+	}
+
+	// no Kubernetes object changes once Redis can be reached, so flushing the dirty databases is retried
+	if err == nil && len(dirty) > 0 && r.RedisInspector != nil {
+		return ctrl.Result{RequeueAfter: cacheFlushRetryPeriod}, nil
+	}
+	return ctrl.Result{}, err
+}
+
+// reconcile moves the child objects and status of the fetched RedisCache to the desired state. It
+// returns the dirty databases that could not be flushed.
+func (r *RedisCacheReconciler) reconcile(ctx context.Context, redisCache v1beta1.RedisCache, log logr.Logger) ([]int32, error) {
+	consumers, dirty, err := r.assignConsumers(ctx, redisCache, log)
+	if err != nil {
+		return nil, err
+	}
+
+	// images the policy does not allow are never rolled out, the Redis keeps what it runs
+	var state *redisState
+	violation := r.ImagePolicy.Check(redis.GetCacheImage(redisCache, r.Config))
+	if violation != nil {
+		log.Info("RedisCache violates the image policy, only refreshing its status", "rediscache", redisCache.Name,
+			"violation", violation.Error())
+		state, err = r.observeWorkload(ctx, redisCache, log)
+	} else {
+		state, err = r.reconcileWorkload(ctx, redisCache, log)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return dirty, r.updateStatus(ctx, redisCache, state, consumers, dirty, violation)
+}
+
+// assignConsumers returns the MyAppResources using the RedisCache, sorted by name. A consumer keeps the
+// database it was given, and new consumers get the lowest free database in the order they were created.
+// Consumers left over once every database is taken get none. The databases freed by consumers that are
+// gone are flushed first, those that could not be flushed are returned as dirty and given to no one.
+func (r *RedisCacheReconciler) assignConsumers(ctx context.Context, redisCache v1beta1.RedisCache, log logr.Logger) ([]v1beta1.RedisCacheConsumer, []int32, error) {
+	myAppResources := &v1beta1.MyAppResourceList{}
+	if err := r.List(ctx, myAppResources, client.InNamespace(redisCache.Namespace),
+		client.MatchingFields{cacheRefKey: redisCache.Name}); err != nil {
+		log.Error(err, "unable to list the MyAppResources using the RedisCache")
+		return nil, nil, err
+	}
+	sort.Slice(myAppResources.Items, func(i, j int) bool {
+		a, b := myAppResources.Items[i], myAppResources.Items[j]
+		if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+			return a.CreationTimestamp.Before(&b.CreationTimestamp)
+		}
+		return a.Name < b.Name
+	})
+
+	databases := redis.GetCacheDatabases(redisCache)
+
+	// the databases already given out stay with their consumer
+	assigned := map[string]int32{}
+	taken := map[int32]bool{}
+	for _, consumer := range redisCache.Status.Consumers {
+		if consumer.Database != nil && *consumer.Database < databases {
+			assigned[consumer.Name] = *consumer.Database
+		}
+	}
+	for _, myAppResource := range myAppResources.Items {
+		if database, ok := assigned[myAppResource.Name]; ok {
+			taken[database] = true
+		}
+	}
+
+	// the databases of the consumers that are gone still hold their keys
+	var dirty []int32
+	for _, database := range redisCache.Status.DirtyDatabases {
+		if database < databases && !taken[database] {
+			dirty = append(dirty, database)
+		}
+	}
+	for _, database := range assigned {
+		if !taken[database] {
+			dirty = append(dirty, database)
+		}
+	}
+	dirty = r.flushDatabases(ctx, redisCache, dirty, log)
+	for _, database := range dirty {
+		taken[database] = true
+	}
+
+	consumers := make([]v1beta1.RedisCacheConsumer, 0, len(myAppResources.Items))
+	next := int32(0)
+	for _, myAppResource := range myAppResources.Items {
+		consumer := v1beta1.RedisCacheConsumer{Name: myAppResource.Name}
+		database, ok := assigned[myAppResource.Name]
+		if !ok {
+			for next < databases && taken[next] {
+				next++
+			}
+			if next < databases {
+				database, ok = next, true
+				taken[next] = true
+			}
+		}
+		if ok {
+			consumer.Database = &database
+		}
+		consumers = append(consumers, consumer)
+	}
+	sort.Slice(consumers, func(i, j int) bool { return consumers[i].Name < consumers[j].Name })
+
+	return consumers, dirty, nil
+}
+
+// flushDatabases flushes the dirty databases of the RedisCache, and returns the ones that could not
+// be flushed, sorted. A Redis that can not be reached fails the flush rather than the reconcile.
+func (r *RedisCacheReconciler) flushDatabases(ctx context.Context, redisCache v1beta1.RedisCache, dirty []int32, log logr.Logger) []int32 {
+	sort.Slice(dirty, func(i, j int) bool { return dirty[i] < dirty[j] })
+	if len(dirty) == 0 || r.RedisInspector == nil {
+		return dirty
+	}
+
+	password, err := r.getPassword(ctx, redisCache)
+	if err != nil {
+		log.Error(err, "unable to read the Redis password")
+		return dirty
+	}
+	addr := net.JoinHostPort(redis.GetCacheHost(redisCache.Name, redisCache.Namespace, r.Config.ClusterDomain), strconv.Itoa(redis.RedisPort))
+
+	var remaining []int32
+	for _, database := range dirty {
+		if err := r.RedisInspector.FlushDatabase(ctx, addr, password, database); err != nil {
+			log.Error(err, "unable to flush a freed Redis database", "database", database)
+			remaining = append(remaining, database)
+			continue
+		}
+		log.Info("flushed a freed Redis database", "database", database)
+	}
+	return remaining
+}
+
+// getPassword reads the Redis password of the RedisCache from its Secret.
+func (r *RedisCacheReconciler) getPassword(ctx context.Context, redisCache v1beta1.RedisCache) (string, error) {
+	selector := redis.GetCachePasswordSecretKeySelector(redisCache)
+
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: redisCache.Namespace, Name: selector.Name}, secret); err != nil {
+		return "", err
+	}
+	password, ok := secret.Data[selector.Key]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no key %s", selector.Name, selector.Key)
+	}
+	return string(password), nil
+}
+
+// reconcileWorkload creates or updates the Redis objects of the RedisCache, and removes the workload
+// of the kind that no longer applies. It returns the state of the Redis workload.
+func (r *RedisCacheReconciler) reconcileWorkload(ctx context.Context, redisCache v1beta1.RedisCache, log logr.Logger) (*redisState, error) {
+	name := redis.GetCacheName(redisCache.Name)
+	lookupKey := client.ObjectKey{Namespace: redisCache.Namespace, Name: name}
+	headlessLookupKey := client.ObjectKey{Namespace: redisCache.Namespace, Name: redis.GetCacheHeadlessServiceName(redisCache.Name)}
+	authLookupKey := client.ObjectKey{Namespace: redisCache.Namespace, Name: redis.GetCacheAuthSecretName(redisCache.Name)}
+
+	if err := r.reconcileAuth(ctx, redisCache, authLookupKey, log); err != nil {
+		return nil, err
+	}
+
+	var state *redisState
+	if redisCache.Spec.Persistence == nil {
+		// switching persistence off leaves the claim in place, so the data is kept
+		if err := r.deleteIfExists(ctx, lookupKey, &appsv1.StatefulSet{}, log); err != nil {
+			return nil, err
+		}
+		if err := r.deleteIfExists(ctx, headlessLookupKey, &corev1.Service{}, log); err != nil {
+			return nil, err
+		}
+
+		deployment, err := r.createOrUpdateDeployment(ctx, name, redisCache.Namespace,
+			redis.ConstructCacheDeployment(redisCache, r.Config), log)
+		if err != nil {
+			return nil, err
+		}
+		state = &redisState{
+			rollout:         getRolloutStatus(deployment),
+			desiredReplicas: *deployment.Spec.Replicas,
+			readyReplicas:   deployment.Status.ReadyReplicas,
+		}
+	} else {
+		if err := r.deleteIfExists(ctx, lookupKey, &appsv1.Deployment{}, log); err != nil {
+			return nil, err
+		}
+		if _, err := r.createOrUpdate(ctx, redis.ConstructCacheHeadlessService(redisCache), log); err != nil {
+			return nil, err
+		}
+
+		statefulSet, err := r.createOrUpdateStatefulSet(ctx, name, redisCache.Namespace,
+			redis.ConstructCacheStatefulSet(redisCache, r.Config), log)
+		if err != nil {
+			return nil, err
+		}
+		state = &redisState{
+			rollout:         getStatefulSetRolloutStatus(statefulSet),
+			desiredReplicas: *statefulSet.Spec.Replicas,
+			readyReplicas:   statefulSet.Status.ReadyReplicas,
+			persistent:      true,
+		}
+	}
+
+	if _, err := r.createOrUpdate(ctx, redis.ConstructCacheService(redisCache), log); err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// observeWorkload returns the state of the Redis workload of the RedisCache, without changing anything.
+func (r *RedisCacheReconciler) observeWorkload(ctx context.Context, redisCache v1beta1.RedisCache, log logr.Logger) (*redisState, error) {
+	name := redis.GetCacheName(redisCache.Name)
+	lookupKey := client.ObjectKey{Namespace: redisCache.Namespace, Name: name}
+
+	if redisCache.Spec.Persistence == nil {
+		deployment := &appsv1.Deployment{}
+		if err := r.Get(ctx, lookupKey, deployment); err != nil {
+			if errors.IsNotFound(err) {
+				return &redisState{rollout: getMissingRolloutStatus("Deployment", name)}, nil
+			}
+			log.Error(err, "failed to get Deployment for RedisCache", "rediscache", redisCache.Name, "deployment", name)
+			return nil, err
+		}
+		return &redisState{
+			rollout:         getRolloutStatus(deployment),
+			desiredReplicas: *deployment.Spec.Replicas,
+			readyReplicas:   deployment.Status.ReadyReplicas,
+		}, nil
+	}
+
+	statefulSet := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, lookupKey, statefulSet); err != nil {
+		if errors.IsNotFound(err) {
+			return &redisState{rollout: getMissingRolloutStatus("StatefulSet", name), persistent: true}, nil
+		}
+		log.Error(err, "failed to get StatefulSet for RedisCache", "rediscache", redisCache.Name, "statefulset", name)
+		return nil, err
+	}
+	return &redisState{
+		rollout:         getStatefulSetRolloutStatus(statefulSet),
+		desiredReplicas: *statefulSet.Spec.Replicas,
+		readyReplicas:   statefulSet.Status.ReadyReplicas,
+		persistent:      true,
+	}, nil
+}
+
+// reconcileAuth makes sure the generated password Secret of the RedisCache exists, unless the
+// password comes from an existingSecretRef. A generated password is never rotated.
+func (r *RedisCacheReconciler) reconcileAuth(ctx context.Context, redisCache v1beta1.RedisCache, key client.ObjectKey, log logr.Logger) error {
+	if auth := redisCache.Spec.Auth; auth != nil && auth.ExistingSecretRef != nil {
+		return r.deleteIfExists(ctx, key, &corev1.Secret{}, log)
+	}
+
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, key, secret)
+	if client.IgnoreNotFound(err) != nil {
+		log.Error(err, "unable to fetch RedisCache auth Secret", "secret", key.Name)
+		return err
+	}
+	found := err == nil
+	if found && len(secret.Data[redis.PasswordKey]) > 0 {
+		return nil
+	}
+
+	password, err := redis.GeneratePassword()
+	if err != nil {
+		return err
+	}
+	updatedSecret := redis.ConstructCacheAuthSecret(redisCache, password)
+
+	if !found {
+		if err := r.Create(ctx, updatedSecret); err != nil {
+			log.Error(err, "unable to create RedisCache auth Secret", "secret", key.Name)
+			return err
+		}
+		log.V(1).Info("created auth Secret for RedisCache", "secret", key.Name)
+		r.recordEvent(updatedSecret, corev1.EventTypeNormal, eventReasonCreated, "Created Secret %s", key.Name)
+		return nil
+	}
+
+	// the password key was removed, generate a new one
+	secret.Data = updatedSecret.Data
+	if err := r.Update(ctx, secret); err != nil {
+		log.Error(err, "unable to update RedisCache auth Secret", "secret", key.Name)
+		return err
+	}
+	log.V(1).Info("updated auth Secret for RedisCache", "secret", key.Name)
+	r.recordEvent(secret, corev1.EventTypeNormal, eventReasonUpdated, "Updated Secret %s", key.Name)
+
+	return nil
+}
+
+// updateStatus patches the RedisCache status with its consumers, its dirty databases and the rollout
+// state of its Redis. The Full condition reports the consumers left without a database.
+func (r *RedisCacheReconciler) updateStatus(ctx context.Context, redisCache v1beta1.RedisCache, state *redisState,
+	consumers []v1beta1.RedisCacheConsumer, dirty []int32, violation error) error {
+	rollout := state.rollout
+	generation := redisCache.Generation
+	if violation != nil {
+		generation = redisCache.Status.ObservedGeneration
+	}
+
+	ready := metav1.Condition{
+		Type:               v1beta1.ConditionTypeReady,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             rollout.Reason,
+		Message:            rollout.Message,
+	}
+	if rollout.Complete {
+		ready.Status = metav1.ConditionTrue
+	}
+
+	databases := redis.GetCacheDatabases(redisCache)
+	full := metav1.Condition{
+		Type:               v1beta1.ConditionTypeFull,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: redisCache.Generation,
+		Reason:             v1beta1.ReasonDatabasesAvailable,
+		Message:            fmt.Sprintf("%d consumers of %d databases", len(consumers), databases),
+	}
+	var waiting []string
+	for _, consumer := range consumers {
+		if consumer.Database == nil {
+			waiting = append(waiting, consumer.Name)
+		}
+	}
+	if len(waiting) > 0 {
+		full.Status = metav1.ConditionTrue
+		full.Reason = v1beta1.ReasonNoFreeDatabase
+		full.Message = fmt.Sprintf("all %d databases are taken, waiting for one: %s", databases, strings.Join(waiting, ", "))
+		if len(dirty) > 0 {
+			full.Message += fmt.Sprintf(", %d freed databases are not flushed yet", len(dirty))
+		}
+	}
+
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		latest := &v1beta1.RedisCache{}
+		if err := r.Get(ctx, client.ObjectKeyFromObject(&redisCache), latest); err != nil {
+			return err
+		}
+
+		original := latest.DeepCopy()
+		latest.Status.ObservedGeneration = generation
+		latest.Status.ReadyReplicas = state.readyReplicas
+		latest.Status.Endpoint = redis.GetCacheEndpoint(redisCache, r.Config.ClusterDomain)
+		latest.Status.Consumers = consumers
+		latest.Status.DirtyDatabases = dirty
+		meta.SetStatusCondition(&latest.Status.Conditions, ready)
+		meta.SetStatusCondition(&latest.Status.Conditions, full)
+		if violation != nil {
+			meta.SetStatusCondition(&latest.Status.Conditions, metav1.Condition{
+				Type:               v1beta1.ConditionTypePolicyViolation,
+				Status:             metav1.ConditionTrue,
+				ObservedGeneration: redisCache.Generation,
+				Reason:             v1beta1.ReasonImageNotAllowed,
+				Message:            violation.Error(),
+			})
+		} else {
+			meta.RemoveStatusCondition(&latest.Status.Conditions, v1beta1.ConditionTypePolicyViolation)
+		}
+		if equality.Semantic.DeepEqual(original.Status, latest.Status) {
+			return nil
+		}
+
+		if err := r.Status().Patch(ctx, latest, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{})); err != nil {
+			return err
+		}
+		r.recordStatusEvents(latest, original.Status, latest.Status)
+
+		return nil
+	})
+}
+
+// recordStatusEvents records the conditions of the RedisCache that change their status, as a Warning
+// when consumers are left without a database or the image is not allowed.
+func (r *RedisCacheReconciler) recordStatusEvents(redisCache *v1beta1.RedisCache, old, updated v1beta1.RedisCacheStatus) {
+	for _, condition := range updated.Conditions {
+		warning := warningReasons[condition.Reason]
+
+		// a condition showing up in its expected state is not worth an event, the first reconcile sets them all
+		previous := meta.FindStatusCondition(old.Conditions, condition.Type)
+		if previous == nil && !warning || previous != nil && previous.Status == condition.Status {
+			continue
+		}
+
+		eventType := corev1.EventTypeNormal
+		if warning {
+			eventType = corev1.EventTypeWarning
+		}
+		r.recordEvent(redisCache, eventType, condition.Reason, "%s is %s: %s", condition.Type, condition.Status, condition.Message)
+	}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *RedisCacheReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.applier = applier{Client: r.Client, recorder: r.Recorder, instanceLabel: r.Config.InstanceLabel()}
+
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &v1beta1.MyAppResource{}, cacheRefKey, func(rawObj client.Object) []string {
+		cacheRef := rawObj.(*v1beta1.MyAppResource).Spec.Redis.CacheRef
+		if cacheRef == nil {
+			return nil
+		}
+		return []string{cacheRef.Name}
+	}); err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1beta1.RedisCache{}).
+		Owns(&appsv1.Deployment{}).
+		Owns(&appsv1.StatefulSet{}).
+		Owns(&corev1.Service{}).
+		Owns(&corev1.Secret{}).
+		// a MyAppResource starting or stopping to use a RedisCache changes its consumers, both the
+		// old and the updated MyAppResource are mapped, so the RedisCache it left is reconciled too
+		Watches(&source.Kind{Type: &v1beta1.MyAppResource{}}, handler.EnqueueRequestsFromMapFunc(func(obj client.Object) []reconcile.Request {
+			cacheRef := obj.(*v1beta1.MyAppResource).Spec.Redis.CacheRef
+			if cacheRef == nil {
+				return nil
+			}
+			return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: cacheRef.Name}}}
+		})).
+		Complete(r)
+}
@@ -0,0 +1,197 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/domenicbove/angi/api/v1beta1"
+	"github.com/domenicbove/angi/internal/podinfo"
+	"github.com/domenicbove/angi/internal/redis"
+)
+
+var _ = Describe("RedisCache controller", func() {
+
+	const (
+		RedisCacheName = "shared"
+		Namespace      = "default"
+
+		timeout  = time.Second * 10
+		interval = time.Millisecond * 250
+	)
+
+	consumerNames := []string{"first", "second", "third"}
+
+	AfterEach(func() {
+		ctx := context.Background()
+
+		// cleanup the consumers and their podinfo deployments
+		for _, name := range consumerNames {
+			lookupKey := types.NamespacedName{Name: name, Namespace: Namespace}
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, &v1beta1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: Namespace}}))).Should(Succeed())
+			Eventually(func() error {
+				return k8sClient.Get(ctx, lookupKey, &v1beta1.MyAppResource{})
+			}, timeout, interval).ShouldNot(Succeed())
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: Namespace}}))).Should(Succeed())
+		}
+
+		// cleanup the redis cache and its children, there is no garbage collection in the test environment
+		name := redis.GetCacheName(RedisCacheName)
+		for _, obj := range []client.Object{
+			&v1beta1.RedisCache{ObjectMeta: metav1.ObjectMeta{Name: RedisCacheName, Namespace: Namespace}},
+			&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: Namespace}},
+			&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: Namespace}},
+			&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: redis.GetCacheAuthSecretName(RedisCacheName), Namespace: Namespace}},
+		} {
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, obj))).Should(Succeed())
+		}
+	})
+
+	// createConsumer creates a MyAppResource using the RedisCache
+	createConsumer := func(ctx context.Context, name string) {
+		Expect(k8sClient.Create(ctx, &v1beta1.MyAppResource{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: Namespace},
+			Spec: v1beta1.MyAppResourceSpec{
+				UI:    v1beta1.UI{Color: "#34577c", Message: "some message"},
+				Redis: v1beta1.Redis{CacheRef: &corev1.LocalObjectReference{Name: RedisCacheName}},
+			},
+		})).Should(Succeed())
+	}
+
+	// getConsumers returns the consumers the RedisCache lists, as name=database
+	getConsumers := func(ctx context.Context) func() ([]string, error) {
+		return func() ([]string, error) {
+			redisCache := &v1beta1.RedisCache{}
+			if err := k8sClient.Get(ctx, types.NamespacedName{Name: RedisCacheName, Namespace: Namespace}, redisCache); err != nil {
+				return nil, err
+			}
+			var consumers []string
+			for _, consumer := range redisCache.Status.Consumers {
+				database := "none"
+				if consumer.Database != nil {
+					database = fmt.Sprint(*consumer.Database)
+				}
+				consumers = append(consumers, fmt.Sprintf("%s=%s", consumer.Name, database))
+			}
+			return consumers, nil
+		}
+	}
+
+	// getCacheEnv returns the podinfo cache env var of the MyAppResource
+	getCacheEnv := func(ctx context.Context, name string) func() (string, error) {
+		return func() (string, error) {
+			deployment := &appsv1.Deployment{}
+			if err := k8sClient.Get(ctx, types.NamespacedName{Name: name, Namespace: Namespace}, deployment); err != nil {
+				return "", err
+			}
+			for _, env := range deployment.Spec.Template.Spec.Containers[0].Env {
+				if env.Name == podinfo.CacheEnvVar {
+					return env.Value, nil
+				}
+			}
+			return "", nil
+		}
+	}
+
+	It("Should give each consumer a database of its own", func() {
+		ctx := context.Background()
+
+		By("By creating a RedisCache with two databases")
+		Expect(k8sClient.Create(ctx, &v1beta1.RedisCache{
+			ObjectMeta: metav1.ObjectMeta{Name: RedisCacheName, Namespace: Namespace},
+			Spec:       v1beta1.RedisCacheSpec{Databases: 2},
+		})).Should(Succeed())
+
+		redisDeployment := &appsv1.Deployment{}
+		Eventually(func() error {
+			return k8sClient.Get(ctx, types.NamespacedName{Name: "shared-rediscache", Namespace: Namespace}, redisDeployment)
+		}, timeout, interval).Should(Succeed())
+		Expect(redisDeployment.OwnerReferences[0].Kind).Should(Equal("RedisCache"))
+		Expect(redisDeployment.Spec.Template.Spec.Containers[0].Args).Should(Equal([]string{"--databases", "2"}))
+		Eventually(func() error {
+			return k8sClient.Get(ctx, types.NamespacedName{Name: "shared-rediscache-auth", Namespace: Namespace}, &corev1.Secret{})
+		}, timeout, interval).Should(Succeed())
+
+		By("By creating two consumers, one after the other")
+		createConsumer(ctx, "first")
+		Eventually(getConsumers(ctx), timeout, interval).Should(Equal([]string{"first=0"}))
+		createConsumer(ctx, "second")
+		Eventually(getConsumers(ctx), timeout, interval).Should(Equal([]string{"first=0", "second=1"}))
+
+		Eventually(getCacheEnv(ctx, "second"), timeout, interval).Should(Equal(
+			"tcp://:$(REDIS_PASSWORD_URLENCODED)@shared-rediscache.default.svc.cluster.local:6379/1"))
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "second", Namespace: Namespace}, &v1beta1.MyAppResource{})).Should(Succeed())
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: redis.GetDeploymentName("second"), Namespace: Namespace}, &appsv1.Deployment{})).ShouldNot(Succeed())
+
+		By("By creating a consumer once every database is taken")
+		createConsumer(ctx, "third")
+		Eventually(getConsumers(ctx), timeout, interval).Should(Equal([]string{"first=0", "second=1", "third=none"}))
+		Eventually(func() (*metav1.Condition, error) {
+			redisCache := &v1beta1.RedisCache{}
+			err := k8sClient.Get(ctx, types.NamespacedName{Name: RedisCacheName, Namespace: Namespace}, redisCache)
+			return meta.FindStatusCondition(redisCache.Status.Conditions, v1beta1.ConditionTypeFull), err
+		}, timeout, interval).Should(And(
+			HaveField("Status", metav1.ConditionTrue),
+			HaveField("Reason", v1beta1.ReasonNoFreeDatabase)))
+		Eventually(func() (string, error) {
+			third := &v1beta1.MyAppResource{}
+			err := k8sClient.Get(ctx, types.NamespacedName{Name: "third", Namespace: Namespace}, third)
+			if condition := meta.FindStatusCondition(third.Status.Conditions, v1beta1.ConditionTypeRedisReady); condition != nil {
+				return condition.Reason, err
+			}
+			return "", err
+		}, timeout, interval).Should(Equal(v1beta1.ReasonRedisCacheFull))
+		Expect(getCacheEnv(ctx, "third")()).Should(BeEmpty())
+
+		By("By deleting the first consumer, which frees its database for the waiting one")
+		Expect(k8sClient.Delete(ctx, &v1beta1.MyAppResource{ObjectMeta: metav1.ObjectMeta{Name: "first", Namespace: Namespace}})).Should(Succeed())
+		Eventually(getConsumers(ctx), timeout, interval).Should(Equal([]string{"second=1", "third=0"}))
+		Eventually(getCacheEnv(ctx, "third"), timeout, interval).Should(Equal(
+			"tcp://:$(REDIS_PASSWORD_URLENCODED)@shared-rediscache.default.svc.cluster.local:6379/0"))
+	})
+
+	It("Should flush a freed database before handing it to another consumer", func() {
+		ctx := context.Background()
+
+		getDirtyDatabases := func() ([]int32, error) {
+			redisCache := &v1beta1.RedisCache{}
+			err := k8sClient.Get(ctx, types.NamespacedName{Name: RedisCacheName, Namespace: Namespace}, redisCache)
+			return redisCache.Status.DirtyDatabases, err
+		}
+
+		By("By creating a RedisCache with one database and two consumers")
+		Expect(k8sClient.Create(ctx, &v1beta1.RedisCache{
+			ObjectMeta: metav1.ObjectMeta{Name: RedisCacheName, Namespace: Namespace},
+			Spec:       v1beta1.RedisCacheSpec{Databases: 1},
+		})).Should(Succeed())
+		createConsumer(ctx, "first")
+		Eventually(getConsumers(ctx), timeout, interval).Should(Equal([]string{"first=0"}))
+		createConsumer(ctx, "second")
+		Eventually(getConsumers(ctx), timeout, interval).Should(Equal([]string{"first=0", "second=none"}))
+
+		By("By deleting the first consumer while Redis can not be reached")
+		redisInspector.setFlushErr(fmt.Errorf("connection refused"))
+		defer redisInspector.setFlushErr(nil)
+		Expect(k8sClient.Delete(ctx, &v1beta1.MyAppResource{ObjectMeta: metav1.ObjectMeta{Name: "first", Namespace: Namespace}})).Should(Succeed())
+		Eventually(getDirtyDatabases, timeout, interval).Should(Equal([]int32{0}))
+		Consistently(getConsumers(ctx), time.Second*2, interval).Should(Equal([]string{"second=none"}))
+
+		By("By checking the database is handed out once it is flushed")
+		redisInspector.setFlushErr(nil)
+		Eventually(getConsumers(ctx), timeout, interval).Should(Equal([]string{"second=0"}))
+		Expect(getDirtyDatabases()).Should(BeEmpty())
+		Expect(redisInspector.getFlushed()).Should(ContainElement("shared-rediscache.default.svc.cluster.local:6379/0"))
+	})
+})
@@ -0,0 +1,336 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/domenicbove/angi/api/v1beta1"
+)
+
+// rolloutStatus summarizes the rollout of a child Deployment.
+type rolloutStatus struct {
+	// Complete is true when every desired replica is updated and available.
+	Complete bool
+	// Stalled is true when the Deployment controller has given up on the rollout.
+	Stalled bool
+	Reason  string
+	Message string
+}
+
+// getRolloutStatus derives the rollout state of a Deployment from its own status
+// and conditions, following the same rules as `kubectl rollout status`.
+func getRolloutStatus(deployment *appsv1.Deployment) rolloutStatus {
+	if deployment.Generation > deployment.Status.ObservedGeneration {
+		return rolloutStatus{
+			Reason:  v1beta1.ReasonDeploymentPending,
+			Message: fmt.Sprintf("waiting for Deployment %s spec update to be observed", deployment.Name),
+		}
+	}
+
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == appsv1.DeploymentProgressing && condition.Status == corev1.ConditionFalse &&
+			condition.Reason == "ProgressDeadlineExceeded" {
+			return rolloutStatus{
+				Stalled: true,
+				Reason:  v1beta1.ReasonProgressDeadlineExceeded,
+				Message: fmt.Sprintf("Deployment %s: %s", deployment.Name, condition.Message),
+			}
+		}
+		if condition.Type == appsv1.DeploymentReplicaFailure && condition.Status == corev1.ConditionTrue {
+			return rolloutStatus{
+				Stalled: true,
+				Reason:  v1beta1.ReasonReplicaFailure,
+				Message: fmt.Sprintf("Deployment %s: %s", deployment.Name, condition.Message),
+			}
+		}
+	}
+
+	desired := int32(1)
+	if deployment.Spec.Replicas != nil {
+		desired = *deployment.Spec.Replicas
+	}
+	status := deployment.Status
+
+	var message string
+	switch {
+	case status.UpdatedReplicas < desired:
+		message = fmt.Sprintf("Deployment %s: %d of %d replicas updated", deployment.Name, status.UpdatedReplicas, desired)
+	case status.Replicas > status.UpdatedReplicas:
+		message = fmt.Sprintf("Deployment %s: %d old replicas pending termination", deployment.Name, status.Replicas-status.UpdatedReplicas)
+	case status.AvailableReplicas < status.UpdatedReplicas:
+		message = fmt.Sprintf("Deployment %s: %d of %d updated replicas available", deployment.Name, status.AvailableReplicas, status.UpdatedReplicas)
+	default:
+		return rolloutStatus{
+			Complete: true,
+			Reason:   v1beta1.ReasonAvailable,
+			Message:  fmt.Sprintf("Deployment %s: %d of %d replicas available", deployment.Name, status.AvailableReplicas, desired),
+		}
+	}
+
+	return rolloutStatus{Reason: v1beta1.ReasonRollingOut, Message: message}
+}
+
+// getMissingRolloutStatus is the rollout state of a child workload that does not exist.
+func getMissingRolloutStatus(kind, name string) rolloutStatus {
+	return rolloutStatus{
+		Reason:  v1beta1.ReasonDeploymentPending,
+		Message: fmt.Sprintf("%s %s does not exist", kind, name),
+	}
+}
+
+// getStatefulSetRolloutStatus derives the rollout state of a StatefulSet from its
+// status, following the same rules as `kubectl rollout status`.
+func getStatefulSetRolloutStatus(statefulSet *appsv1.StatefulSet) rolloutStatus {
+	if statefulSet.Generation > statefulSet.Status.ObservedGeneration {
+		return rolloutStatus{
+			Reason:  v1beta1.ReasonDeploymentPending,
+			Message: fmt.Sprintf("waiting for StatefulSet %s spec update to be observed", statefulSet.Name),
+		}
+	}
+
+	desired := int32(1)
+	if statefulSet.Spec.Replicas != nil {
+		desired = *statefulSet.Spec.Replicas
+	}
+	status := statefulSet.Status
+
+	var message string
+	switch {
+	case status.UpdatedReplicas < desired && status.UpdateRevision != status.CurrentRevision:
+		message = fmt.Sprintf("StatefulSet %s: %d of %d replicas updated", statefulSet.Name, status.UpdatedReplicas, desired)
+	case status.AvailableReplicas < desired:
+		message = fmt.Sprintf("StatefulSet %s: %d of %d replicas available", statefulSet.Name, status.AvailableReplicas, desired)
+	default:
+		return rolloutStatus{
+			Complete: true,
+			Reason:   v1beta1.ReasonAvailable,
+			Message:  fmt.Sprintf("StatefulSet %s: %d of %d replicas available", statefulSet.Name, status.AvailableReplicas, desired),
+		}
+	}
+
+	return rolloutStatus{Reason: v1beta1.ReasonRollingOut, Message: message}
+}
+
+// setConditions computes the MyAppResource conditions from the rollout state of the
+// PodInfo Deployment and, when Redis is enabled, the Redis workload and its storage.
+func setConditions(status *v1beta1.MyAppResourceStatus, generation int64, podInfo rolloutStatus, redis *redisState) {
+	rollouts := []rolloutStatus{podInfo}
+
+	var redisRollout *rolloutStatus
+	if redis != nil {
+		rollout := redis.rollout
+		redisRollout = &rollout
+		rollouts = append(rollouts, rollout)
+
+		redisReady := metav1.Condition{
+			Type:               v1beta1.ConditionTypeRedisReady,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: generation,
+			Reason:             rollout.Reason,
+			Message:            rollout.Message,
+		}
+		if rollout.Complete {
+			redisReady.Status = metav1.ConditionTrue
+		}
+		meta.SetStatusCondition(&status.Conditions, redisReady)
+	} else {
+		meta.RemoveStatusCondition(&status.Conditions, v1beta1.ConditionTypeRedisReady)
+	}
+
+	if redis != nil && redis.persistent {
+		meta.SetStatusCondition(&status.Conditions, getStorageBoundCondition(generation, redis.claim))
+	} else {
+		meta.RemoveStatusCondition(&status.Conditions, v1beta1.ConditionTypeRedisStorageBound)
+	}
+
+	ready := metav1.Condition{
+		Type:               v1beta1.ConditionTypeReady,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             v1beta1.ReasonAvailable,
+		Message:            "all components are available",
+	}
+	switch {
+	case !podInfo.Complete:
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = v1beta1.ReasonPodInfoNotReady
+		ready.Message = podInfo.Message
+	case redisRollout != nil && !redisRollout.Complete:
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = v1beta1.ReasonRedisNotReady
+		ready.Message = redisRollout.Message
+	}
+	meta.SetStatusCondition(&status.Conditions, ready)
+
+	progressing := metav1.Condition{
+		Type:               v1beta1.ConditionTypeProgressing,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             v1beta1.ReasonRolloutComplete,
+		Message:            "all rollouts are complete",
+	}
+	degraded := metav1.Condition{
+		Type:               v1beta1.ConditionTypeDegraded,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             v1beta1.ReasonAsExpected,
+		Message:            "no rollout has stalled",
+	}
+	for _, rollout := range rollouts {
+		if rollout.Stalled && degraded.Status == metav1.ConditionFalse {
+			degraded.Status = metav1.ConditionTrue
+			degraded.Reason = rollout.Reason
+			degraded.Message = rollout.Message
+		}
+		if !rollout.Complete && !rollout.Stalled && progressing.Status == metav1.ConditionFalse {
+			progressing.Status = metav1.ConditionTrue
+			progressing.Reason = rollout.Reason
+			progressing.Message = rollout.Message
+		}
+	}
+	meta.SetStatusCondition(&status.Conditions, progressing)
+	meta.SetStatusCondition(&status.Conditions, degraded)
+}
+
+// getStorageBoundCondition reports whether the Redis PersistentVolumeClaim is bound.
+// A nil claim has not been created by the StatefulSet controller yet.
+func getStorageBoundCondition(generation int64, claim *corev1.PersistentVolumeClaim) metav1.Condition {
+	condition := metav1.Condition{
+		Type:               v1beta1.ConditionTypeRedisStorageBound,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             v1beta1.ReasonClaimPending,
+	}
+
+	switch {
+	case claim == nil:
+		condition.Message = "waiting for the Redis PersistentVolumeClaim to be created"
+	case claim.Status.Phase == corev1.ClaimBound:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = v1beta1.ReasonClaimBound
+		condition.Message = fmt.Sprintf("PersistentVolumeClaim %s is bound to PersistentVolume %s", claim.Name, claim.Spec.VolumeName)
+	case claim.Status.Phase == corev1.ClaimLost:
+		condition.Reason = v1beta1.ReasonClaimLost
+		condition.Message = fmt.Sprintf("PersistentVolumeClaim %s lost its PersistentVolume %s", claim.Name, claim.Spec.VolumeName)
+	default:
+		condition.Message = fmt.Sprintf("PersistentVolumeClaim %s is pending", claim.Name)
+	}
+
+	return condition
+}
+
+// updateStatus patches the MyAppResource status with the observed state of its child objects, and
+// updates the replica metrics. A nil PodInfo deployment does not exist, which only happens while the
+// child objects are held, because the MyAppResource is paused or violates the image policy. While held,
+// the status keeps the generation it observed last, since the child objects do not follow the spec.
+func (r *MyAppResourceReconciler) updateStatus(ctx context.Context, myAppResource v1beta1.MyAppResource, podInfo *podInfoState, redis *redisState) error {
+	paused := isPaused(myAppResource)
+	violations := r.checkImagePolicy(myAppResource)
+	generation := myAppResource.Generation
+	if paused || len(violations) > 0 {
+		generation = myAppResource.Status.ObservedGeneration
+	}
+
+	podInfoRollout := getMissingRolloutStatus("Deployment", myAppResource.Name)
+	var podInfoDesired, podInfoReady int32
+	if podInfoDeployment := podInfo.deployment; podInfoDeployment != nil {
+		podInfoRollout = getRolloutStatus(podInfoDeployment)
+		podInfoDesired = 1
+		if podInfoDeployment.Spec.Replicas != nil {
+			podInfoDesired = *podInfoDeployment.Spec.Replicas
+		}
+		podInfoReady = podInfoDeployment.Status.ReadyReplicas
+	}
+
+	if err := r.patchStatus(ctx, client.ObjectKeyFromObject(&myAppResource), func(status *v1beta1.MyAppResourceStatus) {
+		status.ObservedGeneration = generation
+		status.PodInfoReadyReplicas = podInfoReady
+		status.RedisSource = ""
+		status.RedisReadyReplicas = 0
+		status.RedisPrimary = ""
+		status.RedisReplicasInSync = 0
+		if redis != nil {
+			status.RedisSource = redis.source
+			status.RedisReadyReplicas = redis.readyReplicas
+			status.RedisPrimary = redis.primary
+			status.RedisReplicasInSync = redis.replicasInSync
+		}
+		status.Canary = podInfo.canary.status
+		setConditions(status, generation, podInfoRollout, redis)
+		if podInfo.canary.active() {
+			canary := podInfo.canary.status
+			meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+				Type:               v1beta1.ConditionTypeProgressing,
+				Status:             metav1.ConditionTrue,
+				ObservedGeneration: generation,
+				Reason:             v1beta1.ReasonCanaryRollout,
+				Message: fmt.Sprintf("canary rollout of image %s is %s at step %d with %d%% of the replicas: %s",
+					canary.CanaryImage, canary.Phase, canary.Step, canary.Weight, canary.Message),
+			})
+		}
+
+		if paused {
+			meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+				Type:               v1beta1.ConditionTypePaused,
+				Status:             metav1.ConditionTrue,
+				ObservedGeneration: myAppResource.Generation,
+				Reason:             v1beta1.ReasonPausedByAnnotation,
+				Message:            fmt.Sprintf("the %s annotation is set, child objects are not changed", v1beta1.PausedAnnotation),
+			})
+		} else {
+			meta.RemoveStatusCondition(&status.Conditions, v1beta1.ConditionTypePaused)
+		}
+
+		if len(violations) > 0 {
+			meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+				Type:               v1beta1.ConditionTypePolicyViolation,
+				Status:             metav1.ConditionTrue,
+				ObservedGeneration: myAppResource.Generation,
+				Reason:             v1beta1.ReasonImageNotAllowed,
+				Message:            strings.Join(violations, "; "),
+			})
+		} else {
+			meta.RemoveStatusCondition(&status.Conditions, v1beta1.ConditionTypePolicyViolation)
+		}
+	}); err != nil {
+		return err
+	}
+	recordReplicas(myAppResource, podInfoDesired, podInfoReady, redis)
+
+	return nil
+}
+
+// patchStatus applies mutate to the latest MyAppResource status and patches it
+// when it changed. The patch carries the resourceVersion, so a concurrent write
+// results in a conflict which is retried against a freshly fetched object. The
+// changes are recorded as events once they are patched.
+func (r *MyAppResourceReconciler) patchStatus(ctx context.Context, key client.ObjectKey, mutate func(*v1beta1.MyAppResourceStatus)) error {
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		myAppResource := &v1beta1.MyAppResource{}
+		if err := r.Get(ctx, key, myAppResource); err != nil {
+			return err
+		}
+
+		original := myAppResource.DeepCopy()
+		mutate(&myAppResource.Status)
+		if equality.Semantic.DeepEqual(original.Status, myAppResource.Status) {
+			return nil
+		}
+
+		if err := r.Status().Patch(ctx, myAppResource, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{})); err != nil {
+			return err
+		}
+		r.recordStatusEvents(myAppResource, original.Status, myAppResource.Status)
+
+		return nil
+	})
+}
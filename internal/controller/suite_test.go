@@ -2,7 +2,9 @@ package controller
 
 import (
 	"context"
+	"fmt"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
@@ -18,6 +20,9 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	myv1alpha1 "github.com/domenicbove/angi/api/v1alpha1"
+	myv1beta1 "github.com/domenicbove/angi/api/v1beta1"
+	"github.com/domenicbove/angi/internal/config"
+	"github.com/domenicbove/angi/internal/imagepolicy"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -29,6 +34,61 @@ var k8sClient client.Client
 var testEnv *envtest.Environment
 var ctx context.Context
 var cancel context.CancelFunc
+var redisInspector = &fakeRedisInspector{}
+
+// fakeRedisInspector stands in for Redis and Sentinel, which do not run in the test environment.
+type fakeRedisInspector struct {
+	mu             sync.Mutex
+	primary        string
+	replicasInSync int32
+	// flushErr fails FlushDatabase when set, flushed records the databases flushed, as addr/database
+	flushErr error
+	flushed  []string
+}
+
+func (f *fakeRedisInspector) set(primary string, replicasInSync int32) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.primary = primary
+	f.replicasInSync = replicasInSync
+}
+
+func (f *fakeRedisInspector) GetPrimary(_ context.Context, _ string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.primary == "" {
+		return "", fmt.Errorf("no primary")
+	}
+	return f.primary, nil
+}
+
+func (f *fakeRedisInspector) GetReplicasInSync(_ context.Context, _, _ string) (int32, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.replicasInSync, nil
+}
+
+func (f *fakeRedisInspector) setFlushErr(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.flushErr = err
+}
+
+func (f *fakeRedisInspector) FlushDatabase(_ context.Context, addr, _ string, database int32) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.flushErr != nil {
+		return f.flushErr
+	}
+	f.flushed = append(f.flushed, fmt.Sprintf("%s/%d", addr, database))
+	return nil
+}
+
+func (f *fakeRedisInspector) getFlushed() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.flushed...)
+}
 
 func TestAPIs(t *testing.T) {
 	RegisterFailHandler(Fail)
@@ -42,20 +102,26 @@ var _ = BeforeSuite(func() {
 	ctx, cancel = context.WithCancel(context.TODO())
 
 	By("bootstrapping test environment")
+	// both versions must be registered before starting the environment, so
+	// envtest points the CRD conversion webhook at the manager started below
+	err := myv1alpha1.AddToScheme(scheme.Scheme)
+	Expect(err).NotTo(HaveOccurred())
+	err = myv1beta1.AddToScheme(scheme.Scheme)
+	Expect(err).NotTo(HaveOccurred())
+
 	testEnv = &envtest.Environment{
 		CRDDirectoryPaths:     []string{filepath.Join("..", "..", "config", "crd", "bases")},
 		ErrorIfCRDPathMissing: true,
+		WebhookInstallOptions: envtest.WebhookInstallOptions{
+			Paths: []string{filepath.Join("..", "..", "config", "webhook")},
+		},
 	}
 
-	var err error
 	// cfg is defined in this file globally.
 	cfg, err = testEnv.Start()
 	Expect(err).NotTo(HaveOccurred())
 	Expect(cfg).NotTo(BeNil())
 
-	err = myv1alpha1.AddToScheme(scheme.Scheme)
-	Expect(err).NotTo(HaveOccurred())
-
 	// +kubebuilder:rbac:groups=apps,resources=deployments,verbs=list;watch;get;patch;create;update
 
 	//+kubebuilder:scaffold:scheme
@@ -64,14 +130,42 @@ var _ = BeforeSuite(func() {
 	Expect(err).NotTo(HaveOccurred())
 	Expect(k8sClient).NotTo(BeNil())
 
+	webhookInstallOptions := &testEnv.WebhookInstallOptions
 	k8sManager, err := ctrl.NewManager(cfg, ctrl.Options{
-		Scheme: scheme.Scheme,
+		Scheme:  scheme.Scheme,
+		Host:    webhookInstallOptions.LocalServingHost,
+		Port:    webhookInstallOptions.LocalServingPort,
+		CertDir: webhookInstallOptions.LocalServingCertDir,
 	})
 	Expect(err).ToNot(HaveOccurred())
 
+	operatorConfig := config.New()
+	err = (&myv1beta1.MyAppResource{}).SetupWebhookWithManager(k8sManager,
+		myv1beta1.Image{Repository: operatorConfig.PodInfo.Image.Repository, Tag: operatorConfig.PodInfo.Image.Tag},
+		myv1beta1.RedisImage{Repository: operatorConfig.Redis.Image.Repository, Tag: operatorConfig.Redis.Image.Tag})
+	Expect(err).ToNot(HaveOccurred())
+
 	err = (&MyAppResourceReconciler{
-		Client: k8sManager.GetClient(),
-		Scheme: k8sManager.GetScheme(),
+		Client:         k8sManager.GetClient(),
+		Scheme:         k8sManager.GetScheme(),
+		RedisInspector: redisInspector,
+		Recorder:       k8sManager.GetEventRecorderFor("myappresource-controller"),
+		Config:         config.New(),
+		ImagePolicy: imagepolicy.Policy{
+			AllowedRepositories: []string{"ghcr.io/stefanprodan", "docker.io/redis"},
+		},
+	}).SetupWithManager(k8sManager)
+	Expect(err).ToNot(HaveOccurred())
+
+	err = (&RedisCacheReconciler{
+		Client:   k8sManager.GetClient(),
+		Scheme:   k8sManager.GetScheme(),
+		Recorder: k8sManager.GetEventRecorderFor("rediscache-controller"),
+		Config:   config.New(),
+		ImagePolicy: imagepolicy.Policy{
+			AllowedRepositories: []string{"docker.io/redis"},
+		},
+		RedisInspector: redisInspector,
 	}).SetupWithManager(k8sManager)
 	Expect(err).ToNot(HaveOccurred())
 
@@ -0,0 +1,82 @@
+package imagepolicy
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// dockerHubRegistry is the registry of images that do not name one.
+	dockerHubRegistry = "docker.io"
+	// DefaultMutableTag is the tag treated as mutable when no MutableTags are set.
+	DefaultMutableTag = "latest"
+)
+
+// Policy restricts the images the operator runs. The zero Policy allows every image.
+type Policy struct {
+	// AllowedRepositories are the registries and repositories images may be pulled from. An image is
+	// allowed when an entry equals its repository or is a path prefix of it, so ghcr.io allows every
+	// image on ghcr.io. Images without a registry are on docker.io, redis is docker.io/library/redis.
+	// When empty, every repository is allowed.
+	AllowedRepositories []string
+	// ForbidMutableTags rejects images tagged with one of the MutableTags.
+	ForbidMutableTags bool
+	// MutableTags are the tags that are moved to new images over time, DefaultMutableTag when empty.
+	MutableTags []string
+}
+
+// Check returns an error describing why the image, in the repository:tag form, is not allowed.
+func (p Policy) Check(image string) error {
+	repository, tag := splitImage(image)
+
+	if len(p.AllowedRepositories) > 0 {
+		normalized := normalizeRepository(repository)
+		allowed := false
+		for _, entry := range p.AllowedRepositories {
+			entry = strings.TrimSuffix(entry, "/")
+			if normalized == entry || strings.HasPrefix(normalized, entry+"/") {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("image %s is not from an allowed repository: %s", image, strings.Join(p.AllowedRepositories, ", "))
+		}
+	}
+
+	if p.ForbidMutableTags {
+		mutableTags := p.MutableTags
+		if len(mutableTags) == 0 {
+			mutableTags = []string{DefaultMutableTag}
+		}
+		for _, mutableTag := range mutableTags {
+			if tag == mutableTag {
+				return fmt.Errorf("image %s has the mutable tag %q, pin a version instead", image, tag)
+			}
+		}
+	}
+
+	return nil
+}
+
+// splitImage splits an image into its repository and tag, a missing tag is DefaultMutableTag
+// as it is for the container runtime.
+func splitImage(image string) (string, string) {
+	slash := strings.LastIndex(image, "/")
+	if colon := strings.LastIndex(image, ":"); colon > slash {
+		return image[:colon], image[colon+1:]
+	}
+	return image, DefaultMutableTag
+}
+
+// normalizeRepository adds the registry docker.io implies to a repository.
+func normalizeRepository(repository string) string {
+	first, _, found := strings.Cut(repository, "/")
+	if found && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		return repository
+	}
+	if !found {
+		repository = "library/" + repository
+	}
+	return dockerHubRegistry + "/" + repository
+}
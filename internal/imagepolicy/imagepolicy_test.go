@@ -0,0 +1,59 @@
+package imagepolicy
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestImagePolicy(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Image Policy Suite")
+}
+
+var _ = Describe("Image policy", func() {
+
+	Context("When no policy is set", func() {
+		It("Should allow every image", func() {
+			Expect(Policy{}.Check("registry.example.com/podinfo:latest")).Should(Succeed())
+			Expect(Policy{}.Check("redis")).Should(Succeed())
+		})
+	})
+
+	Context("When allowing repositories", func() {
+		policy := Policy{AllowedRepositories: []string{"ghcr.io/stefanprodan/", "docker.io/redis", "localhost:5000"}}
+
+		It("Should allow images below an allowed repository", func() {
+			Expect(policy.Check("ghcr.io/stefanprodan/podinfo:6.3.0")).Should(Succeed())
+			Expect(policy.Check("redis/redis-stack:latest")).Should(Succeed())
+			Expect(policy.Check("docker.io/redis/redis-stack:7.0.6-RC8")).Should(Succeed())
+			Expect(policy.Check("localhost:5000/podinfo:6.3.0")).Should(Succeed())
+		})
+
+		It("Should reject images from other repositories", func() {
+			Expect(policy.Check("ghcr.io/stefanprodan-fork/podinfo:6.3.0")).Should(MatchError(
+				"image ghcr.io/stefanprodan-fork/podinfo:6.3.0 is not from an allowed repository: ghcr.io/stefanprodan/, docker.io/redis, localhost:5000"))
+			Expect(policy.Check("redis:7")).ShouldNot(Succeed(), "redis is docker.io/library/redis")
+			Expect(policy.Check("localhost/podinfo:6.3.0")).ShouldNot(Succeed())
+		})
+	})
+
+	Context("When forbidding mutable tags", func() {
+		It("Should reject latest and missing tags by default", func() {
+			policy := Policy{ForbidMutableTags: true}
+
+			Expect(policy.Check("ghcr.io/stefanprodan/podinfo:6.3.0")).Should(Succeed())
+			Expect(policy.Check("localhost:5000/podinfo")).Should(MatchError(
+				`image localhost:5000/podinfo has the mutable tag "latest", pin a version instead`))
+			Expect(policy.Check("ghcr.io/stefanprodan/podinfo:latest")).ShouldNot(Succeed())
+		})
+
+		It("Should reject the configured tags", func() {
+			policy := Policy{ForbidMutableTags: true, MutableTags: []string{"latest", "main"}}
+
+			Expect(policy.Check("ghcr.io/stefanprodan/podinfo:main")).ShouldNot(Succeed())
+			Expect(policy.Check("ghcr.io/stefanprodan/podinfo:6")).Should(Succeed())
+		})
+	})
+})
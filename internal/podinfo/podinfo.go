@@ -2,35 +2,71 @@ package podinfo
 
 import (
 	"fmt"
+	"strconv"
 
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 
-	"github.com/domenicbove/angi/api/v1alpha1"
+	"github.com/domenicbove/angi/api/v1beta1"
+	"github.com/domenicbove/angi/internal/config"
+	"github.com/domenicbove/angi/internal/podspec"
 	"github.com/domenicbove/angi/internal/redis"
 )
 
 const (
-	Port            = 9898
-	UIColorEnvVar   = "PODINFO_UI_COLOR"
-	UIMessageEnvVar = "PODINFO_UI_MESSAGE"
-	CacheEnvVar     = "PODINFO_CACHE_SERVER"
-	DefaultImage    = "ghcr.io/stefanprodan/podinfo:latest"
+	Port              = 9898
+	MetricsPort       = 9797
+	UIColorEnvVar     = "PODINFO_UI_COLOR"
+	UIMessageEnvVar   = "PODINFO_UI_MESSAGE"
+	CacheEnvVar       = "PODINFO_CACHE_SERVER"
+	MetricsPortEnvVar = "PODINFO_PORT_METRICS"
+
+	// LivenessPath and ReadinessPath are the PodInfo endpoints checked by the default probes.
+	LivenessPath  = "/healthz"
+	ReadinessPath = "/readyz"
+
+	// DefaultTargetCPUUtilizationPercentage is the autoscaling CPU target used when no target is set.
+	DefaultTargetCPUUtilizationPercentage = 80
+	// DefaultMaxUnavailable is the disruption budget used when none is set and PodInfo runs more than one replica.
+	DefaultMaxUnavailable = 1
+
+	// TrackLabel tells the canary pods apart from the stable ones.
+	TrackLabel  = "track"
+	TrackCanary = "canary"
 )
 
-func ConstructPodInfoDeployment(myAppResource v1alpha1.MyAppResource) *appsv1.Deployment {
-	image := DefaultImage
-	if myAppResource.Spec.Image != nil {
-		image = fmt.Sprintf("%s:%s", myAppResource.Spec.Image.Repository, myAppResource.Spec.Image.Tag)
+// user is the app user of the PodInfo image.
+var user = podspec.User{UID: 100, GID: 101}
+
+// GetImage returns the PodInfo Container image, falling back to the operator defaults for an unset repository or tag.
+func GetImage(myAppResource v1beta1.MyAppResource, cfg config.OperatorConfig) string {
+	repository := myAppResource.Spec.Image.Repository
+	if repository == "" {
+		repository = cfg.PodInfo.Image.Repository
+	}
+	tag := myAppResource.Spec.Image.Tag
+	if tag == "" {
+		tag = cfg.PodInfo.Image.Tag
 	}
+	return fmt.Sprintf("%s:%s", repository, tag)
+}
+
+// ConstructPodInfoDeployment builds the PodInfo Deployment. PodInfo caches in the Redis of connection,
+// and runs without a cache when connection is nil.
+func ConstructPodInfoDeployment(myAppResource v1beta1.MyAppResource, cfg config.OperatorConfig, connection *redis.Connection) *appsv1.Deployment {
+	image := GetImage(myAppResource, cfg)
 
 	deployment := &appsv1.Deployment{
 		TypeMeta: metav1.TypeMeta{APIVersion: appsv1.SchemeGroupVersion.String(), Kind: "Deployment"},
 		ObjectMeta: metav1.ObjectMeta{
 			Name:            myAppResource.Name,
 			Namespace:       myAppResource.Namespace,
-			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(&myAppResource, v1alpha1.GroupVersion.WithKind("MyAppResource"))},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(&myAppResource, v1beta1.GroupVersion.WithKind("MyAppResource"))},
 		},
 		Spec: appsv1.DeploymentSpec{
 			Replicas: myAppResource.Spec.ReplicaCount,
@@ -49,9 +85,11 @@ func ConstructPodInfoDeployment(myAppResource v1alpha1.MyAppResource) *appsv1.De
 							Env: []corev1.EnvVar{
 								{Name: UIColorEnvVar, Value: myAppResource.Spec.UI.Color},
 								{Name: UIMessageEnvVar, Value: myAppResource.Spec.UI.Message},
+								{Name: MetricsPortEnvVar, Value: strconv.Itoa(MetricsPort)},
 							},
 							Ports: []corev1.ContainerPort{
 								{ContainerPort: Port, Name: "http", Protocol: "TCP"},
+								{ContainerPort: MetricsPort, Name: "http-metrics", Protocol: "TCP"},
 							},
 						},
 					},
@@ -60,15 +98,248 @@ func ConstructPodInfoDeployment(myAppResource v1alpha1.MyAppResource) *appsv1.De
 		},
 	}
 
+	// the autoscaler owns the replicas, the Deployment defaults to 1 replica when created
+	if myAppResource.Spec.Autoscaling != nil {
+		deployment.Spec.Replicas = nil
+	}
+
 	if myAppResource.Spec.Resources != nil {
 		deployment.Spec.Template.Spec.Containers[0].Resources = *myAppResource.Spec.Resources.DeepCopy()
+	} else if cfg.PodInfo.Resources != nil {
+		deployment.Spec.Template.Spec.Containers[0].Resources = *cfg.PodInfo.Resources.DeepCopy()
 	}
+	setProbes(&deployment.Spec.Template.Spec.Containers[0], myAppResource.Spec.Probes)
+	podspec.SetSecurityContext(&deployment.Spec.Template.Spec, user, myAppResource.Spec.PodSecurityContext, myAppResource.Spec.SecurityContext)
 
-	// add the redis env var if redis enabled
-	if myAppResource.Spec.Redis != nil && myAppResource.Spec.Redis.Enabled {
-		deployment.Spec.Template.Spec.Containers[0].Env = append(deployment.Spec.Template.Spec.Containers[0].Env,
-			corev1.EnvVar{Name: CacheEnvVar, Value: redis.GetEndpoint(myAppResource.Name, myAppResource.Namespace)})
+	// add the redis env vars if there is a redis, the percent-encoded password is loaded from its
+	// Secret and expanded into the endpoint, so it never appears in the Deployment
+	if connection != nil {
+		container := &deployment.Spec.Template.Spec.Containers[0]
+		if connection.Password != nil {
+			container.Env = append(container.Env, redis.GetEncodedPasswordEnvVar(myAppResource.Name))
+		}
+		container.Env = append(container.Env, corev1.EnvVar{Name: CacheEnvVar, Value: connection.GetAuthenticatedEndpoint()})
 	}
 
 	return deployment
 }
+
+// GetCanaryName returns the name of the canary Deployment.
+func GetCanaryName(myAppResourceName string) string {
+	return fmt.Sprintf("%s-canary", myAppResourceName)
+}
+
+// GetCanaryReplicas returns the share of replicas given by weight, a percentage, rounded up.
+func GetCanaryReplicas(replicas, weight int32) int32 {
+	return (replicas*weight + 99) / 100
+}
+
+// setProbes sets the probes of the PodInfo Container, the default ones check the health and readiness
+// endpoints of PodInfo, a probe set in probes replaces its default.
+func setProbes(container *corev1.Container, probes *v1beta1.Probes) {
+	podspec.SetProbes(container,
+		corev1.Probe{ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{Path: LivenessPath, Port: intstr.FromInt(Port)}}},
+		corev1.Probe{ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{Path: ReadinessPath, Port: intstr.FromInt(Port)}}},
+		probes)
+}
+
+// ConstructPodInfoCanaryDeployment builds the Deployment running the desired PodInfo pods next to the
+// stable ones during a canary rollout. Its pods are labeled with the track, so its selector does not
+// match the stable pods. The stable selector can not change and matches the canary pods too, but the
+// Deployment controller only manages the ReplicaSets and pods it owns.
+func ConstructPodInfoCanaryDeployment(myAppResource v1beta1.MyAppResource, cfg config.OperatorConfig, connection *redis.Connection, replicas int32) *appsv1.Deployment {
+	deployment := ConstructPodInfoDeployment(myAppResource, cfg, connection)
+	deployment.Name = GetCanaryName(myAppResource.Name)
+	deployment.Spec.Replicas = &replicas
+	deployment.Spec.Selector.MatchLabels[TrackLabel] = TrackCanary
+	deployment.Spec.Template.Labels[TrackLabel] = TrackCanary
+
+	return deployment
+}
+
+// ConstructPodInfoService builds the Service exposing the PodInfo http and metrics ports.
+func ConstructPodInfoService(myAppResource v1beta1.MyAppResource) *corev1.Service {
+	spec := myAppResource.Spec.Service
+
+	serviceType := spec.Type
+	if serviceType == "" {
+		serviceType = corev1.ServiceTypeClusterIP
+	}
+	httpPort := spec.HTTPPort
+	if httpPort == 0 {
+		httpPort = v1beta1.DefaultServiceHTTPPort
+	}
+	metricsPort := spec.MetricsPort
+	if metricsPort == 0 {
+		metricsPort = v1beta1.DefaultServiceMetricsPort
+	}
+
+	service := &corev1.Service{
+		TypeMeta: metav1.TypeMeta{APIVersion: corev1.SchemeGroupVersion.String(), Kind: "Service"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            myAppResource.Name,
+			Namespace:       myAppResource.Namespace,
+			Annotations:     spec.Annotations,
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(&myAppResource, v1beta1.GroupVersion.WithKind("MyAppResource"))},
+		},
+		Spec: corev1.ServiceSpec{
+			Type:            serviceType,
+			SessionAffinity: spec.SessionAffinity,
+			Ports: []corev1.ServicePort{
+				{Name: "http", Port: httpPort, TargetPort: intstr.FromString("http"), Protocol: "TCP"},
+				{Name: "http-metrics", Port: metricsPort, TargetPort: intstr.FromString("http-metrics"), Protocol: "TCP"},
+			},
+			Selector: map[string]string{
+				"app": myAppResource.Name,
+			},
+		},
+	}
+
+	return service
+}
+
+// ConstructPodInfoIngress builds the Ingress routing the hosts to the PodInfo Service http port.
+func ConstructPodInfoIngress(myAppResource v1beta1.MyAppResource) *networkingv1.Ingress {
+	spec := myAppResource.Spec.Ingress
+
+	path := spec.Path
+	if path == "" {
+		path = "/"
+	}
+	pathType := networkingv1.PathTypePrefix
+
+	ingress := &networkingv1.Ingress{
+		TypeMeta: metav1.TypeMeta{APIVersion: networkingv1.SchemeGroupVersion.String(), Kind: "Ingress"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            myAppResource.Name,
+			Namespace:       myAppResource.Namespace,
+			Annotations:     spec.Annotations,
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(&myAppResource, v1beta1.GroupVersion.WithKind("MyAppResource"))},
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: spec.IngressClassName,
+		},
+	}
+
+	for _, host := range spec.Hosts {
+		ingress.Spec.Rules = append(ingress.Spec.Rules, networkingv1.IngressRule{
+			Host: host,
+			IngressRuleValue: networkingv1.IngressRuleValue{
+				HTTP: &networkingv1.HTTPIngressRuleValue{
+					Paths: []networkingv1.HTTPIngressPath{
+						{
+							Path:     path,
+							PathType: &pathType,
+							Backend: networkingv1.IngressBackend{
+								Service: &networkingv1.IngressServiceBackend{
+									Name: myAppResource.Name,
+									Port: networkingv1.ServiceBackendPort{Name: "http"},
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+	}
+
+	if spec.TLSSecretName != "" {
+		ingress.Spec.TLS = []networkingv1.IngressTLS{
+			{Hosts: spec.Hosts, SecretName: spec.TLSSecretName},
+		}
+	}
+
+	return ingress
+}
+
+// ConstructPodInfoHorizontalPodAutoscaler builds the HorizontalPodAutoscaler scaling the PodInfo Deployment.
+func ConstructPodInfoHorizontalPodAutoscaler(myAppResource v1beta1.MyAppResource) *autoscalingv2.HorizontalPodAutoscaler {
+	spec := myAppResource.Spec.Autoscaling
+
+	targetCPU := spec.TargetCPUUtilizationPercentage
+	if targetCPU == nil && spec.TargetMemoryUtilizationPercentage == nil {
+		defaultTargetCPU := int32(DefaultTargetCPUUtilizationPercentage)
+		targetCPU = &defaultTargetCPU
+	}
+
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{
+		TypeMeta: metav1.TypeMeta{APIVersion: autoscalingv2.SchemeGroupVersion.String(), Kind: "HorizontalPodAutoscaler"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            myAppResource.Name,
+			Namespace:       myAppResource.Namespace,
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(&myAppResource, v1beta1.GroupVersion.WithKind("MyAppResource"))},
+		},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{
+				APIVersion: appsv1.SchemeGroupVersion.String(),
+				Kind:       "Deployment",
+				Name:       myAppResource.Name,
+			},
+			MinReplicas: spec.MinReplicas,
+			MaxReplicas: spec.MaxReplicas,
+			Behavior:    spec.Behavior.DeepCopy(),
+		},
+	}
+
+	for _, target := range []struct {
+		name        corev1.ResourceName
+		utilization *int32
+	}{
+		{corev1.ResourceCPU, targetCPU},
+		{corev1.ResourceMemory, spec.TargetMemoryUtilizationPercentage},
+	} {
+		if target.utilization == nil {
+			continue
+		}
+		utilization := *target.utilization
+		hpa.Spec.Metrics = append(hpa.Spec.Metrics, autoscalingv2.MetricSpec{
+			Type: autoscalingv2.ResourceMetricSourceType,
+			Resource: &autoscalingv2.ResourceMetricSource{
+				Name: target.name,
+				Target: autoscalingv2.MetricTarget{
+					Type:               autoscalingv2.UtilizationMetricType,
+					AverageUtilization: &utilization,
+				},
+			},
+		})
+	}
+
+	return hpa
+}
+
+// ConstructPodInfoPodDisruptionBudget builds the PodDisruptionBudget of the PodInfo pods. It returns nil
+// when no budget is set and PodInfo can not run more than one replica, so there is nothing to keep available.
+func ConstructPodInfoPodDisruptionBudget(myAppResource v1beta1.MyAppResource) *policyv1.PodDisruptionBudget {
+	budget := myAppResource.Spec.DisruptionBudget
+	if budget == nil {
+		var multipleReplicas bool
+		if myAppResource.Spec.Autoscaling != nil {
+			multipleReplicas = myAppResource.Spec.Autoscaling.MaxReplicas > 1
+		} else {
+			multipleReplicas = myAppResource.Spec.ReplicaCount != nil && *myAppResource.Spec.ReplicaCount > 1
+		}
+		if !multipleReplicas {
+			return nil
+		}
+		maxUnavailable := intstr.FromInt(DefaultMaxUnavailable)
+		budget = &v1beta1.DisruptionBudget{MaxUnavailable: &maxUnavailable}
+	}
+
+	pdb := &policyv1.PodDisruptionBudget{
+		TypeMeta: metav1.TypeMeta{APIVersion: policyv1.SchemeGroupVersion.String(), Kind: "PodDisruptionBudget"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            myAppResource.Name,
+			Namespace:       myAppResource.Namespace,
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(&myAppResource, v1beta1.GroupVersion.WithKind("MyAppResource"))},
+		},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			MinAvailable:   budget.MinAvailable,
+			MaxUnavailable: budget.MaxUnavailable,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": myAppResource.Name},
+			},
+		},
+	}
+
+	return pdb
+}
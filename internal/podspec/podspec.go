@@ -0,0 +1,99 @@
+// Package podspec holds the pod settings shared by the PodInfo and Redis workloads: their probes, their
+// security contexts and the volumes their read-only root filesystem needs.
+package podspec
+
+import (
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/domenicbove/angi/api/v1beta1"
+)
+
+const (
+	// TmpVolumeName is the emptyDir mounted at TmpMountPath, since the root filesystem is read-only.
+	TmpVolumeName = "tmp"
+	TmpMountPath  = "/tmp"
+)
+
+// User is the user and group the containers of a pod run as by default.
+type User struct {
+	UID int64
+	GID int64
+	// OwnsVolumes sets GID as the fsGroup of the pod, so the group owns its volumes.
+	OwnsVolumes bool
+}
+
+// SetProbes sets the liveness and readiness probes of the container to the defaults, a probe set in
+// probes replaces its default. The startup probe is only set from probes.
+func SetProbes(container *corev1.Container, liveness, readiness corev1.Probe, probes *v1beta1.Probes) {
+	container.LivenessProbe = &liveness
+	container.ReadinessProbe = &readiness
+	if probes == nil {
+		return
+	}
+
+	if probes.Liveness != nil {
+		container.LivenessProbe = probes.Liveness.DeepCopy()
+	}
+	if probes.Readiness != nil {
+		container.ReadinessProbe = probes.Readiness.DeepCopy()
+	}
+	container.StartupProbe = probes.Startup.DeepCopy()
+}
+
+// SetSecurityContext sets the security contexts of a pod and its containers, and mounts an emptyDir at
+// TmpMountPath in each container. The default ones run as user and meet the restricted Pod Security
+// Standard, and each is replaced as a whole by a security context from the spec.
+func SetSecurityContext(podSpec *corev1.PodSpec, user User, podSecurityContext *corev1.PodSecurityContext, securityContext *corev1.SecurityContext) {
+	podSpec.SecurityContext = getPodSecurityContext(user, podSecurityContext)
+	for i := range podSpec.Containers {
+		podSpec.Containers[i].SecurityContext = getSecurityContext(securityContext)
+	}
+	AddEmptyDirVolume(podSpec, TmpVolumeName, TmpMountPath)
+}
+
+// getPodSecurityContext returns the security context of a pod, the one from the spec when it is set.
+func getPodSecurityContext(user User, podSecurityContext *corev1.PodSecurityContext) *corev1.PodSecurityContext {
+	if podSecurityContext != nil {
+		return podSecurityContext.DeepCopy()
+	}
+
+	runAsNonRoot := true
+	uid, gid := user.UID, user.GID
+	defaults := &corev1.PodSecurityContext{
+		RunAsNonRoot:   &runAsNonRoot,
+		RunAsUser:      &uid,
+		RunAsGroup:     &gid,
+		SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+	}
+	if user.OwnsVolumes {
+		defaults.FSGroup = &gid
+	}
+	return defaults
+}
+
+// getSecurityContext returns the security context of a container, the one from the spec when it is set.
+func getSecurityContext(securityContext *corev1.SecurityContext) *corev1.SecurityContext {
+	if securityContext != nil {
+		return securityContext.DeepCopy()
+	}
+
+	allowPrivilegeEscalation := false
+	readOnlyRootFilesystem := true
+	return &corev1.SecurityContext{
+		AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+		ReadOnlyRootFilesystem:   &readOnlyRootFilesystem,
+		Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+	}
+}
+
+// AddEmptyDirVolume adds an emptyDir volume to a pod, and mounts it in each container.
+func AddEmptyDirVolume(podSpec *corev1.PodSpec, name, mountPath string) {
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name:         name,
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	})
+	for i := range podSpec.Containers {
+		podSpec.Containers[i].VolumeMounts = append(podSpec.Containers[i].VolumeMounts,
+			corev1.VolumeMount{Name: name, MountPath: mountPath})
+	}
+}
@@ -0,0 +1,75 @@
+package podspec
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/domenicbove/angi/api/v1beta1"
+)
+
+func TestPodSpec(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Pod Spec Suite")
+}
+
+var _ = Describe("Pod spec", func() {
+
+	Context("When setting the probes", func() {
+		liveness := corev1.Probe{ProbeHandler: corev1.ProbeHandler{Exec: &corev1.ExecAction{Command: []string{"live"}}}}
+		readiness := corev1.Probe{ProbeHandler: corev1.ProbeHandler{Exec: &corev1.ExecAction{Command: []string{"ready"}}}}
+
+		It("Should set the defaults without probes", func() {
+			container := corev1.Container{}
+			SetProbes(&container, liveness, readiness, nil)
+			Expect(container.LivenessProbe).Should(Equal(&liveness))
+			Expect(container.ReadinessProbe).Should(Equal(&readiness))
+			Expect(container.StartupProbe).Should(BeNil())
+		})
+
+		It("Should replace only the probes that are set", func() {
+			startup := corev1.Probe{FailureThreshold: 30}
+			container := corev1.Container{}
+			SetProbes(&container, liveness, readiness, &v1beta1.Probes{Readiness: &startup, Startup: &startup})
+			Expect(container.LivenessProbe).Should(Equal(&liveness))
+			Expect(container.ReadinessProbe).Should(Equal(&startup))
+			Expect(container.StartupProbe).Should(Equal(&startup))
+		})
+	})
+
+	Context("When setting the security contexts", func() {
+		It("Should run as the user and mount an emptyDir at /tmp in each container", func() {
+			podSpec := corev1.PodSpec{Containers: []corev1.Container{{Name: "a"}, {Name: "b"}}}
+			SetSecurityContext(&podSpec, User{UID: 100, GID: 101}, nil, nil)
+
+			Expect(*podSpec.SecurityContext.RunAsNonRoot).Should(BeTrue())
+			Expect(*podSpec.SecurityContext.RunAsUser).Should(Equal(int64(100)))
+			Expect(*podSpec.SecurityContext.RunAsGroup).Should(Equal(int64(101)))
+			Expect(podSpec.SecurityContext.FSGroup).Should(BeNil())
+			Expect(podSpec.Volumes).Should(Equal([]corev1.Volume{{Name: TmpVolumeName,
+				VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}}))
+			for _, container := range podSpec.Containers {
+				Expect(*container.SecurityContext.ReadOnlyRootFilesystem).Should(BeTrue())
+				Expect(container.VolumeMounts).Should(Equal([]corev1.VolumeMount{{Name: TmpVolumeName, MountPath: TmpMountPath}}))
+			}
+
+			podSpec = corev1.PodSpec{Containers: []corev1.Container{{Name: "a"}}}
+			SetSecurityContext(&podSpec, User{UID: 999, GID: 999, OwnsVolumes: true}, nil, nil)
+			Expect(*podSpec.SecurityContext.FSGroup).Should(Equal(int64(999)))
+		})
+
+		It("Should replace the defaults with the security contexts of the spec", func() {
+			runAsUser := int64(1001)
+			privileged := false
+			podSpec := corev1.PodSpec{Containers: []corev1.Container{{Name: "a"}}}
+			SetSecurityContext(&podSpec, User{UID: 100, GID: 101}, &corev1.PodSecurityContext{RunAsUser: &runAsUser},
+				&corev1.SecurityContext{Privileged: &privileged})
+
+			Expect(podSpec.SecurityContext).Should(Equal(&corev1.PodSecurityContext{RunAsUser: &runAsUser}))
+			Expect(podSpec.Containers[0].SecurityContext).Should(Equal(&corev1.SecurityContext{Privileged: &privileged}))
+		})
+	})
+})
@@ -0,0 +1,215 @@
+package redis
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/domenicbove/angi/api/v1beta1"
+	"github.com/domenicbove/angi/internal/config"
+	"github.com/domenicbove/angi/internal/podspec"
+)
+
+// DefaultCacheDatabases is the number of logical databases of a RedisCache that sets none, the Redis default.
+const DefaultCacheDatabases = 16
+
+// GetCacheName returns the name of the Redis workload and Service of a RedisCache. It differs from
+// the name of the Redis of a MyAppResource, so a RedisCache and a MyAppResource can share a name.
+func GetCacheName(redisCacheName string) string {
+	return fmt.Sprintf("%s-rediscache", redisCacheName)
+}
+
+// GetCacheHeadlessServiceName returns the name of the governing Service of a persistent RedisCache.
+func GetCacheHeadlessServiceName(redisCacheName string) string {
+	return fmt.Sprintf("%s-headless", GetCacheName(redisCacheName))
+}
+
+// GetCacheAuthSecretName returns the name of the Secret holding the generated password of a RedisCache.
+func GetCacheAuthSecretName(redisCacheName string) string {
+	return fmt.Sprintf("%s-auth", GetCacheName(redisCacheName))
+}
+
+// GetCacheImage returns the Redis image of a RedisCache, falling back to the operator defaults for an unset repository or tag.
+func GetCacheImage(redisCache v1beta1.RedisCache, cfg config.OperatorConfig) string {
+	repository := redisCache.Spec.Image.Repository
+	if repository == "" {
+		repository = cfg.Redis.Image.Repository
+	}
+	tag := redisCache.Spec.Image.Tag
+	if tag == "" {
+		tag = cfg.Redis.Image.Tag
+	}
+	return fmt.Sprintf("%s:%s", repository, tag)
+}
+
+// GetCacheDatabases returns the number of logical databases of a RedisCache.
+func GetCacheDatabases(redisCache v1beta1.RedisCache) int32 {
+	if redisCache.Spec.Databases == 0 {
+		return DefaultCacheDatabases
+	}
+	return redisCache.Spec.Databases
+}
+
+// GetCachePasswordSecretKeySelector returns the Secret key holding the password of a RedisCache, either
+// the user managed existingSecretRef or the Secret generated by the operator.
+func GetCachePasswordSecretKeySelector(redisCache v1beta1.RedisCache) *corev1.SecretKeySelector {
+	if auth := redisCache.Spec.Auth; auth != nil && auth.ExistingSecretRef != nil {
+		return auth.ExistingSecretRef.DeepCopy()
+	}
+
+	return &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: GetCacheAuthSecretName(redisCache.Name)},
+		Key:                  PasswordKey,
+	}
+}
+
+// GetCacheConnection returns the connection of a consumer to a RedisCache.
+func GetCacheConnection(redisCache v1beta1.RedisCache, consumer v1beta1.RedisCacheConsumer, clusterDomain string) *Connection {
+	connection := &Connection{
+		Host:     GetCacheHost(redisCache.Name, redisCache.Namespace, clusterDomain),
+		Port:     RedisPort,
+		Password: GetCachePasswordSecretKeySelector(redisCache),
+	}
+	if consumer.Database != nil {
+		database := *consumer.Database
+		connection.Database = &database
+	}
+
+	return connection
+}
+
+// GetCacheHost returns the DNS name of the Service of a RedisCache in the cluster DNS domain.
+func GetCacheHost(redisCacheName, namespace, clusterDomain string) string {
+	return fmt.Sprintf("%s.%s.svc.%s", GetCacheName(redisCacheName), namespace, clusterDomain)
+}
+
+// GetCacheEndpoint returns the endpoint of a RedisCache, without credentials.
+func GetCacheEndpoint(redisCache v1beta1.RedisCache, clusterDomain string) string {
+	return fmt.Sprintf("tcp://%s:%d", GetCacheHost(redisCache.Name, redisCache.Namespace, clusterDomain), RedisPort)
+}
+
+// ConstructCacheDeployment builds the Redis Deployment of a RedisCache without persistence.
+func ConstructCacheDeployment(redisCache v1beta1.RedisCache, cfg config.OperatorConfig) *appsv1.Deployment {
+	replicas := int32(1)
+	name := GetCacheName(redisCache.Name)
+
+	return &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{APIVersion: appsv1.SchemeGroupVersion.String(), Kind: "Deployment"},
+		ObjectMeta: constructCacheObjectMeta(redisCache, name),
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": name},
+			},
+			Template: constructCachePodTemplate(redisCache, cfg),
+		},
+	}
+}
+
+// ConstructCacheStatefulSet builds the Redis StatefulSet of a RedisCache with persistence, which keeps
+// an append only file on a claim.
+func ConstructCacheStatefulSet(redisCache v1beta1.RedisCache, cfg config.OperatorConfig) *appsv1.StatefulSet {
+	replicas := int32(1)
+	name := GetCacheName(redisCache.Name)
+
+	statefulSet := &appsv1.StatefulSet{
+		TypeMeta:   metav1.TypeMeta{APIVersion: appsv1.SchemeGroupVersion.String(), Kind: "StatefulSet"},
+		ObjectMeta: constructCacheObjectMeta(redisCache, name),
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    &replicas,
+			ServiceName: GetCacheHeadlessServiceName(redisCache.Name),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": name},
+			},
+			Template: constructCachePodTemplate(redisCache, cfg, "--appendonly", "yes"),
+		},
+	}
+	statefulSet.Spec.VolumeClaimTemplates = []corev1.PersistentVolumeClaim{
+		constructDataClaimTemplate(&statefulSet.Spec.Template.Spec.Containers[0], redisCache.Spec.Persistence,
+			map[string]string{"app": name}),
+	}
+
+	return statefulSet
+}
+
+// constructCachePodTemplate builds the Redis pod template of a RedisCache, with the databases its
+// consumers are given.
+func constructCachePodTemplate(redisCache v1beta1.RedisCache, cfg config.OperatorConfig, args ...string) corev1.PodTemplateSpec {
+	name := GetCacheName(redisCache.Name)
+	args = append(args, "--databases", fmt.Sprint(GetCacheDatabases(redisCache)))
+	args = append(args, redisCache.Spec.ExtraArgs...)
+
+	resources := redisCache.Spec.Resources
+	if resources == nil {
+		resources = cfg.Redis.Resources
+	}
+	container := constructContainer(GetCacheImage(redisCache, cfg), GetCachePasswordSecretKeySelector(redisCache), resources)
+	setProbes(&container, redisCache.Spec.Probes)
+	setStartScript(&container, standaloneStartScript, args)
+
+	template := corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{"app": name},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{container},
+		},
+	}
+	podspec.SetSecurityContext(&template.Spec, user, redisCache.Spec.PodSecurityContext, redisCache.Spec.SecurityContext)
+	// the root filesystem is read-only, without a claim the data is kept on an emptyDir
+	if redisCache.Spec.Persistence == nil {
+		podspec.AddEmptyDirVolume(&template.Spec, DataVolumeName, DataMountPath)
+	}
+
+	return template
+}
+
+// ConstructCacheService builds the Service the consumers of a RedisCache reach Redis through.
+func ConstructCacheService(redisCache v1beta1.RedisCache) *corev1.Service {
+	name := GetCacheName(redisCache.Name)
+
+	return &corev1.Service{
+		TypeMeta:   metav1.TypeMeta{APIVersion: corev1.SchemeGroupVersion.String(), Kind: "Service"},
+		ObjectMeta: constructCacheObjectMeta(redisCache, name),
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{
+				{Name: "redis", Port: RedisPort, TargetPort: intstr.FromInt(RedisPort)},
+			},
+			Selector: map[string]string{
+				"app": name,
+			},
+		},
+	}
+}
+
+// ConstructCacheHeadlessService builds the governing Service of the Redis StatefulSet of a RedisCache.
+func ConstructCacheHeadlessService(redisCache v1beta1.RedisCache) *corev1.Service {
+	service := ConstructCacheService(redisCache)
+	service.Name = GetCacheHeadlessServiceName(redisCache.Name)
+	service.Spec.ClusterIP = corev1.ClusterIPNone
+	service.Spec.PublishNotReadyAddresses = true
+
+	return service
+}
+
+// ConstructCacheAuthSecret builds the Secret holding the generated password of a RedisCache.
+func ConstructCacheAuthSecret(redisCache v1beta1.RedisCache, password string) *corev1.Secret {
+	return &corev1.Secret{
+		TypeMeta:   metav1.TypeMeta{APIVersion: corev1.SchemeGroupVersion.String(), Kind: "Secret"},
+		ObjectMeta: constructCacheObjectMeta(redisCache, GetCacheAuthSecretName(redisCache.Name)),
+		Type:       corev1.SecretTypeOpaque,
+		Data:       map[string][]byte{PasswordKey: []byte(password)},
+	}
+}
+
+// constructCacheObjectMeta returns the metadata of a child object of a RedisCache.
+func constructCacheObjectMeta(redisCache v1beta1.RedisCache, name string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:            name,
+		Namespace:       redisCache.Namespace,
+		OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(&redisCache, v1beta1.GroupVersion.WithKind("RedisCache"))},
+	}
+}
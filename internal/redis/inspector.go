@@ -0,0 +1,99 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// Inspector queries the live replication state of Redis in replication and sentinel mode, and
+// flushes the databases a RedisCache hands out again.
+type Inspector interface {
+	// GetPrimary returns the host of the primary the Sentinel at sentinelAddr reports.
+	GetPrimary(ctx context.Context, sentinelAddr string) (string, error)
+	// GetReplicasInSync returns the number of replicas connected to the primary at primaryAddr
+	// and in sync with it.
+	GetReplicasInSync(ctx context.Context, primaryAddr, password string) (int32, error)
+	// FlushDatabase deletes the keys of the logical database of the Redis at addr.
+	FlushDatabase(ctx context.Context, addr, password string, database int32) error
+}
+
+// NewInspector returns an Inspector that connects to Redis and Sentinel directly,
+// so the operator must be able to reach the Redis pods.
+func NewInspector() Inspector {
+	return &inspector{timeout: 2 * time.Second}
+}
+
+type inspector struct {
+	timeout time.Duration
+}
+
+func (i *inspector) GetPrimary(ctx context.Context, sentinelAddr string) (string, error) {
+	client := goredis.NewSentinelClient(&goredis.Options{
+		Addr:        sentinelAddr,
+		DialTimeout: i.timeout,
+		ReadTimeout: i.timeout,
+	})
+	defer client.Close()
+
+	addr, err := client.GetMasterAddrByName(ctx, MasterName).Result()
+	if err != nil {
+		return "", err
+	}
+	if len(addr) == 0 {
+		return "", fmt.Errorf("sentinel %s does not monitor %s", sentinelAddr, MasterName)
+	}
+
+	return addr[0], nil
+}
+
+func (i *inspector) GetReplicasInSync(ctx context.Context, primaryAddr, password string) (int32, error) {
+	client := goredis.NewClient(&goredis.Options{
+		Addr:        primaryAddr,
+		Password:    password,
+		DialTimeout: i.timeout,
+		ReadTimeout: i.timeout,
+	})
+	defer client.Close()
+
+	info, err := client.Info(ctx, "replication").Result()
+	if err != nil {
+		return 0, err
+	}
+
+	return parseReplicasInSync(info), nil
+}
+
+func (i *inspector) FlushDatabase(ctx context.Context, addr, password string, database int32) error {
+	client := goredis.NewClient(&goredis.Options{
+		Addr:        addr,
+		Password:    password,
+		DB:          int(database),
+		DialTimeout: i.timeout,
+		ReadTimeout: i.timeout,
+	})
+	defer client.Close()
+
+	return client.FlushDB(ctx).Err()
+}
+
+// parseReplicasInSync counts the replicas in the online state in the output of
+// INFO replication, where each one is listed as slave<n>:ip=...,state=online,...
+func parseReplicasInSync(info string) int32 {
+	var inSync int32
+	for _, line := range strings.Split(info, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok || !strings.HasPrefix(key, "slave") {
+			continue
+		}
+		for _, field := range strings.Split(value, ",") {
+			if field == "state=online" {
+				inSync++
+			}
+		}
+	}
+	return inSync
+}
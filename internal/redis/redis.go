@@ -1,29 +1,259 @@
 package redis
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
-	"github.com/domenicbove/angi/api/v1alpha1"
+	"github.com/domenicbove/angi/api/v1beta1"
+	"github.com/domenicbove/angi/internal/config"
+	"github.com/domenicbove/angi/internal/podspec"
 )
 
 const (
 	RedisPort = 6379
+
+	// DataVolumeName is the name of the volume, and volumeClaimTemplate, holding the Redis data.
+	DataVolumeName = "data"
+	// DataMountPath is where the redis-stack image keeps its data.
+	DataMountPath = "/data"
+	// DefaultStorageSize is the claim size used when persistence sets none.
+	DefaultStorageSize = "1Gi"
+
+	// PasswordKey is the key of the generated Secret holding the Redis password.
+	PasswordKey = "password"
+	// PasswordEnvVar is the container env var the Redis password is loaded into from its Secret.
+	PasswordEnvVar = "REDIS_PASSWORD"
+	// EncodedPasswordEnvVar is the PodInfo env var the percent-encoded Redis password is loaded into,
+	// from the Secret of GetEncodedPasswordSecretName.
+	EncodedPasswordEnvVar = "REDIS_PASSWORD_URLENCODED"
+	// DefaultMaxUnavailable is the disruption budget used when none is set in replication and sentinel mode.
+	DefaultMaxUnavailable = 1
+
+	// authConfigPath is the redis-server config file the password is written to when the container starts,
+	// so the password is not shown in the pod spec.
+	authConfigPath = podspec.TmpMountPath + "/redis-auth.conf"
 )
 
+// user is the user the Redis containers run as, its group also owns the volumes. It is the redis user
+// of the official Redis image, but the containers start redis-server themselves rather than through
+// the entrypoint of the image, so any image runs as it: redis-server needs no user entry, and only
+// writes to its --dir, DataMountPath, and to the config files under podspec.TmpMountPath.
+var user = podspec.User{UID: 999, GID: 999, OwnsVolumes: true}
+
+// standaloneStartScript writes the password to authConfigPath and execs redis-server with it. The
+// container args are passed to the script as "$@", so each of them stays a single argument. Only
+// redis-server is run, so any Redis image works, not only the redis-stack one.
+var standaloneStartScript = writeAuthConfigScript("requirepass") + fmt.Sprintf(`exec redis-server %s --dir %s "$@"
+`, authConfigPath, DataMountPath)
+
+// escapePasswordScript sets PASSWORD to the password from PasswordEnvVar with its backslashes and double
+// quotes escaped, to be double quoted in a Redis config file so it may hold any character but a newline.
+// $$ escapes the Kubernetes variable expansion.
+var escapePasswordScript = fmt.Sprintf(`PASSWORD="$$(printf '%%s' "${%s}" | sed 's/[\\"]/\\&/g')"
+`, PasswordEnvVar)
+
+// writeAuthConfigScript returns a shell script writing the password to authConfigPath as the value of
+// each directive.
+func writeAuthConfigScript(directives ...string) string {
+	script := escapePasswordScript + fmt.Sprintf(`: > %s
+`, authConfigPath)
+	for _, directive := range directives {
+		script += fmt.Sprintf(`printf '%s "%%s"\n' "${PASSWORD}" >> %s
+`, directive, authConfigPath)
+	}
+	return script
+}
+
 func GetDeploymentName(myAppResourceName string) string {
 	return fmt.Sprintf("%s-redis", myAppResourceName)
 }
 
-func GetEndpoint(myAppResourceName, namespace string) string {
-	return fmt.Sprintf("tcp://%s.%s.svc.cluster.local:%d", GetDeploymentName(myAppResourceName), namespace, RedisPort)
+func GetHeadlessServiceName(myAppResourceName string) string {
+	return fmt.Sprintf("%s-headless", GetDeploymentName(myAppResourceName))
+}
+
+// GetPersistentVolumeClaimName returns the name of the claim the Redis StatefulSet creates for its first pod.
+func GetPersistentVolumeClaimName(myAppResourceName string) string {
+	return fmt.Sprintf("%s-%s-0", DataVolumeName, GetDeploymentName(myAppResourceName))
+}
+
+// GetMyAppResourceNameFromClaim returns the name of the MyAppResource whose Redis StatefulSet created the
+// claim for its first pod, the inverse of GetPersistentVolumeClaimName.
+func GetMyAppResourceNameFromClaim(claimName string) (string, bool) {
+	prefix, suffix := DataVolumeName+"-", GetDeploymentName("")+"-0"
+	if !strings.HasPrefix(claimName, prefix) || !strings.HasSuffix(claimName, suffix) || len(claimName) <= len(prefix)+len(suffix) {
+		return "", false
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(claimName, prefix), suffix), true
+}
+
+// GetImage returns the Redis image, falling back to the operator defaults for an unset repository or tag.
+func GetImage(myAppResource v1beta1.MyAppResource, cfg config.OperatorConfig) string {
+	repository := myAppResource.Spec.Redis.Image.Repository
+	if repository == "" {
+		repository = cfg.Redis.Image.Repository
+	}
+	tag := myAppResource.Spec.Redis.Image.Tag
+	if tag == "" {
+		tag = cfg.Redis.Image.Tag
+	}
+	return fmt.Sprintf("%s:%s", repository, tag)
+}
+
+func GetAuthSecretName(myAppResourceName string) string {
+	return fmt.Sprintf("%s-auth", GetDeploymentName(myAppResourceName))
+}
+
+// GetEncodedPasswordSecretName returns the name of the Secret holding the percent-encoded password
+// PodInfo puts in its cache server URL.
+func GetEncodedPasswordSecretName(myAppResourceName string) string {
+	return fmt.Sprintf("%s-url-auth", GetDeploymentName(myAppResourceName))
+}
+
+// GetHost returns the DNS name of the Redis Service in the cluster DNS domain.
+func GetHost(myAppResourceName, namespace, clusterDomain string) string {
+	return fmt.Sprintf("%s.%s.svc.%s", GetDeploymentName(myAppResourceName), namespace, clusterDomain)
+}
+
+func GetEndpoint(myAppResourceName, namespace, clusterDomain string) string {
+	return fmt.Sprintf("tcp://%s:%d", GetHost(myAppResourceName, namespace, clusterDomain), RedisPort)
+}
+
+// GetAuthenticatedEndpoint returns the endpoint with the password as URL userinfo. The password is
+// a reference to EncodedPasswordEnvVar, which Kubernetes expands when the container env var is defined after it.
+func GetAuthenticatedEndpoint(myAppResourceName, namespace, clusterDomain string) string {
+	return Connection{
+		Host:     GetHost(myAppResourceName, namespace, clusterDomain),
+		Port:     RedisPort,
+		Password: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: GetAuthSecretName(myAppResourceName)}, Key: PasswordKey},
+	}.GetAuthenticatedEndpoint()
+}
+
+// Connection is how a client reaches a Redis and which part of it the client uses.
+type Connection struct {
+	// Host and Port are the address of Redis.
+	Host string
+	Port int32
+	// TLS is true when Redis is reached over TLS.
+	TLS bool
+	// Password selects the Secret key holding the Redis password, Redis requires none when nil.
+	Password *corev1.SecretKeySelector
+	// Database is the logical database the client selects, database 0 when nil.
+	Database *int32
+}
+
+// GetConnection returns the connection to the Redis of the MyAppResource.
+func GetConnection(myAppResource v1beta1.MyAppResource, clusterDomain string) *Connection {
+	return &Connection{
+		Host:     GetHost(myAppResource.Name, myAppResource.Namespace, clusterDomain),
+		Port:     RedisPort,
+		Password: GetPasswordSecretKeySelector(myAppResource),
+	}
+}
+
+// GetExternalConnection returns the connection to a Redis managed outside of the operator.
+func GetExternalConnection(external v1beta1.RedisExternal) *Connection {
+	port := external.Port
+	if port == 0 {
+		port = RedisPort
+	}
+
+	return &Connection{
+		Host:     external.Host,
+		Port:     port,
+		TLS:      external.TLS,
+		Password: external.CredentialsSecretRef.DeepCopy(),
+	}
+}
+
+// GetEndpoint returns the endpoint without credentials, with the rediss scheme when Redis is reached over TLS.
+func (c Connection) GetEndpoint() string {
+	return fmt.Sprintf("%s://%s", c.getScheme(), net.JoinHostPort(c.Host, strconv.Itoa(int(c.Port))))
+}
+
+// GetAuthenticatedEndpoint returns the endpoint with the password as URL userinfo, and the database
+// as URL path. The password is a reference to EncodedPasswordEnvVar, see GetEncodedPasswordEnvVar.
+// Kubernetes expands it as is, so it holds the password percent-encoded.
+func (c Connection) GetAuthenticatedEndpoint() string {
+	var userinfo string
+	if c.Password != nil {
+		userinfo = fmt.Sprintf(":$(%s)@", EncodedPasswordEnvVar)
+	}
+	endpoint := fmt.Sprintf("%s://%s%s", c.getScheme(), userinfo, net.JoinHostPort(c.Host, strconv.Itoa(int(c.Port))))
+	if c.Database != nil {
+		endpoint += fmt.Sprintf("/%d", *c.Database)
+	}
+	return endpoint
+}
+
+// getScheme returns the URL scheme of the endpoint.
+func (c Connection) getScheme() string {
+	if c.TLS {
+		return "rediss"
+	}
+	return "tcp"
+}
+
+// GetEncodedPasswordEnvVar returns the env var loading the percent-encoded Redis password of the
+// MyAppResource, it must be defined before the env var holding the authenticated endpoint.
+func GetEncodedPasswordEnvVar(myAppResourceName string) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name: EncodedPasswordEnvVar,
+		ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: GetEncodedPasswordSecretName(myAppResourceName)},
+			Key:                  PasswordKey,
+		}},
+	}
+}
+
+// EncodePassword percent-encodes the password for the userinfo of a URL.
+func EncodePassword(password string) string {
+	return strings.TrimPrefix(url.UserPassword("", password).String(), ":")
+}
+
+// GetPasswordSecretKeySelector returns the Secret key holding the Redis password, either the
+// user managed existingSecretRef or the Secret generated by the operator.
+func GetPasswordSecretKeySelector(myAppResource v1beta1.MyAppResource) *corev1.SecretKeySelector {
+	if auth := myAppResource.Spec.Redis.Auth; auth != nil && auth.ExistingSecretRef != nil {
+		return auth.ExistingSecretRef.DeepCopy()
+	}
+
+	return &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: GetAuthSecretName(myAppResource.Name)},
+		Key:                  PasswordKey,
+	}
 }
 
-func ConstructRedisDeployment(myAppResource v1alpha1.MyAppResource) *appsv1.Deployment {
+// GetPasswordEnvVar returns the env var loading the Redis password from its Secret.
+func GetPasswordEnvVar(myAppResource v1beta1.MyAppResource) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name:      PasswordEnvVar,
+		ValueFrom: &corev1.EnvVarSource{SecretKeyRef: GetPasswordSecretKeySelector(myAppResource)},
+	}
+}
+
+// GeneratePassword returns a random password for the generated Redis auth Secret.
+func GeneratePassword() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func ConstructRedisDeployment(myAppResource v1beta1.MyAppResource, cfg config.OperatorConfig) *appsv1.Deployment {
 
 	replicas := int32(1)
 	name := GetDeploymentName(myAppResource.Name)
@@ -33,36 +263,176 @@ func ConstructRedisDeployment(myAppResource v1alpha1.MyAppResource) *appsv1.Depl
 		ObjectMeta: metav1.ObjectMeta{
 			Name:            name,
 			Namespace:       myAppResource.Namespace,
-			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(&myAppResource, v1alpha1.GroupVersion.WithKind("MyAppResource"))},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(&myAppResource, v1beta1.GroupVersion.WithKind("MyAppResource"))},
 		},
 		Spec: appsv1.DeploymentSpec{
 			Replicas: &replicas,
 			Selector: &metav1.LabelSelector{
 				MatchLabels: map[string]string{"app": name},
 			},
-			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: map[string]string{"app": name},
-				},
-				Spec: corev1.PodSpec{
-					Containers: []corev1.Container{
-						{
-							Name:  "redis",
-							Image: "redis/redis-stack:latest",
-							Ports: []corev1.ContainerPort{
-								{ContainerPort: RedisPort, Name: "redis", Protocol: "TCP"},
-							},
-						},
-					},
-				},
-			},
+			Template: constructPodTemplate(myAppResource, cfg),
 		},
 	}
 
 	return deployment
 }
 
-func ConstructRedisService(myAppResource v1alpha1.MyAppResource) *corev1.Service {
+// ConstructRedisStatefulSet builds the Redis StatefulSet used when persistence is enabled, or in
+// replication and sentinel mode. With persistence, Redis keeps an append only file on a claim,
+// so the cache survives pod restarts.
+func ConstructRedisStatefulSet(myAppResource v1beta1.MyAppResource, cfg config.OperatorConfig) *appsv1.StatefulSet {
+
+	replicas := GetReplicas(myAppResource)
+	name := GetDeploymentName(myAppResource.Name)
+	persistence := myAppResource.Spec.Redis.Persistence
+
+	var args []string
+	if persistence != nil {
+		args = append(args, "--appendonly", "yes")
+	}
+	template := constructPodTemplate(myAppResource, cfg, args...)
+
+	statefulSet := &appsv1.StatefulSet{
+		TypeMeta: metav1.TypeMeta{APIVersion: appsv1.SchemeGroupVersion.String(), Kind: "StatefulSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       myAppResource.Namespace,
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(&myAppResource, v1beta1.GroupVersion.WithKind("MyAppResource"))},
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    &replicas,
+			ServiceName: GetHeadlessServiceName(myAppResource.Name),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": name},
+			},
+			Template: template,
+		},
+	}
+
+	if persistence == nil {
+		return statefulSet
+	}
+
+	statefulSet.Spec.VolumeClaimTemplates = []corev1.PersistentVolumeClaim{
+		constructDataClaimTemplate(&statefulSet.Spec.Template.Spec.Containers[0], persistence,
+			map[string]string{"app": name, cfg.InstanceLabel(): myAppResource.Name}),
+	}
+
+	return statefulSet
+}
+
+// constructPodTemplate builds the Redis pod template. Redis requires the password from its Secret,
+// args and the extraArgs of the spec are the container args, passed to redis-server one by one. In replication and sentinel mode a start script
+// decides whether the pod starts as the primary or as a replica of it.
+func constructPodTemplate(myAppResource v1beta1.MyAppResource, cfg config.OperatorConfig, args ...string) corev1.PodTemplateSpec {
+	name := GetDeploymentName(myAppResource.Name)
+	args = append(args, myAppResource.Spec.Redis.ExtraArgs...)
+
+	resources := myAppResource.Spec.Redis.Resources
+	if resources == nil {
+		resources = cfg.Redis.Resources
+	}
+	container := constructContainer(GetImage(myAppResource, cfg), GetPasswordSecretKeySelector(myAppResource), resources)
+	setProbes(&container, myAppResource.Spec.Redis.Probes)
+
+	if IsReplicated(myAppResource) {
+		setStartScript(&container, replicaStartScript, args)
+		container.Env = append(container.Env,
+			corev1.EnvVar{Name: "POD_NAME", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"}}},
+			corev1.EnvVar{Name: "REDIS_DOMAIN", Value: GetHeadlessServiceDomain(myAppResource.Name, myAppResource.Namespace, cfg.ClusterDomain)},
+			corev1.EnvVar{Name: "REDIS_PRIMARY_HOST", Value: GetPodHost(GetPodName(myAppResource.Name, 0), myAppResource.Name, myAppResource.Namespace, cfg.ClusterDomain)},
+		)
+		if GetMode(myAppResource) == v1beta1.RedisModeSentinel {
+			container.Env = append(container.Env,
+				corev1.EnvVar{Name: "SENTINEL_HOST", Value: GetSentinelHost(myAppResource.Name, myAppResource.Namespace, cfg.ClusterDomain)})
+		}
+	} else {
+		setStartScript(&container, standaloneStartScript, args)
+	}
+
+	template := corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{"app": name},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{container},
+		},
+	}
+	podspec.SetSecurityContext(&template.Spec, user, myAppResource.Spec.Redis.PodSecurityContext, myAppResource.Spec.Redis.SecurityContext)
+	// the root filesystem is read-only, without a claim the data is kept on an emptyDir
+	if myAppResource.Spec.Redis.Persistence == nil {
+		podspec.AddEmptyDirVolume(&template.Spec, DataVolumeName, DataMountPath)
+	}
+
+	return template
+}
+
+// constructContainer builds the Redis Container, which requires the password from its Secret.
+func constructContainer(image string, password *corev1.SecretKeySelector, resources *corev1.ResourceRequirements) corev1.Container {
+	container := corev1.Container{
+		Name:  "redis",
+		Image: image,
+		Env: []corev1.EnvVar{
+			{Name: PasswordEnvVar, ValueFrom: &corev1.EnvVarSource{SecretKeyRef: password}},
+		},
+		Ports: []corev1.ContainerPort{
+			{ContainerPort: RedisPort, Name: "redis", Protocol: "TCP"},
+		},
+	}
+	if resources != nil {
+		container.Resources = *resources.DeepCopy()
+	}
+
+	return container
+}
+
+// setProbes sets the probes of the Redis Container. The default liveness probe only checks the
+// port is open, so Redis is not restarted while it loads its data, the default readiness probe
+// checks Redis answers PING. A probe set in probes replaces its default.
+func setProbes(container *corev1.Container, probes *v1beta1.Probes) {
+	podspec.SetProbes(container,
+		corev1.Probe{ProbeHandler: corev1.ProbeHandler{TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt(RedisPort)}}},
+		corev1.Probe{ProbeHandler: corev1.ProbeHandler{Exec: &corev1.ExecAction{Command: []string{"sh", "-c",
+			fmt.Sprintf(`REDISCLI_AUTH="$%s" redis-cli -p %d ping | grep -q PONG`, PasswordEnvVar, RedisPort)}}}},
+		probes)
+}
+
+// setStartScript runs the start script in the container, with args as its positional parameters.
+func setStartScript(container *corev1.Container, script string, args []string) {
+	// the argument after the script is $0 of the shell
+	container.Command = []string{"sh", "-c", script, "redis-server"}
+	container.Args = args
+}
+
+// constructDataClaimTemplate builds the volumeClaimTemplate holding the Redis data, and mounts it in the container.
+func constructDataClaimTemplate(container *corev1.Container, persistence *v1beta1.RedisPersistence, labels map[string]string) corev1.PersistentVolumeClaim {
+	size := resource.MustParse(DefaultStorageSize)
+	if persistence.Size != nil {
+		size = *persistence.Size
+	}
+	accessMode := persistence.AccessMode
+	if accessMode == "" {
+		accessMode = corev1.ReadWriteOnce
+	}
+
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{Name: DataVolumeName, MountPath: DataMountPath})
+
+	return corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   DataVolumeName,
+			Labels: labels,
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      []corev1.PersistentVolumeAccessMode{accessMode},
+			StorageClassName: persistence.StorageClassName,
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: size},
+			},
+		},
+	}
+}
+
+func ConstructRedisService(myAppResource v1beta1.MyAppResource) *corev1.Service {
 	name := GetDeploymentName(myAppResource.Name)
 
 	targetPort := intstr.IntOrString{
@@ -74,7 +444,7 @@ func ConstructRedisService(myAppResource v1alpha1.MyAppResource) *corev1.Service
 		ObjectMeta: metav1.ObjectMeta{
 			Name:            name,
 			Namespace:       myAppResource.Namespace,
-			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(&myAppResource, v1alpha1.GroupVersion.WithKind("MyAppResource"))},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(&myAppResource, v1beta1.GroupVersion.WithKind("MyAppResource"))},
 		},
 		Spec: corev1.ServiceSpec{
 			Ports: []corev1.ServicePort{
@@ -86,5 +456,84 @@ func ConstructRedisService(myAppResource v1alpha1.MyAppResource) *corev1.Service
 		},
 	}
 
+	// the operator labels the current primary, so the Service follows it through a failover
+	if IsReplicated(myAppResource) {
+		service.Spec.Selector[RoleLabel] = RolePrimary
+	}
+
+	return service
+}
+
+// ConstructRedisHeadlessService builds the governing Service of the Redis StatefulSet,
+// which gives its pods stable DNS names.
+func ConstructRedisHeadlessService(myAppResource v1beta1.MyAppResource) *corev1.Service {
+	service := ConstructRedisService(myAppResource)
+	service.Name = GetHeadlessServiceName(myAppResource.Name)
+	delete(service.Spec.Selector, RoleLabel)
+	service.Spec.ClusterIP = corev1.ClusterIPNone
+	service.Spec.PublishNotReadyAddresses = true
+
 	return service
 }
+
+// ConstructRedisPodDisruptionBudget builds the PodDisruptionBudget of the Redis pods. It returns
+// nil when no budget is set and Redis runs a single pod, so there is nothing to keep available.
+func ConstructRedisPodDisruptionBudget(myAppResource v1beta1.MyAppResource) *policyv1.PodDisruptionBudget {
+	name := GetDeploymentName(myAppResource.Name)
+
+	budget := myAppResource.Spec.Redis.DisruptionBudget
+	if budget == nil {
+		if GetReplicas(myAppResource) < 2 {
+			return nil
+		}
+		maxUnavailable := intstr.FromInt(DefaultMaxUnavailable)
+		budget = &v1beta1.DisruptionBudget{MaxUnavailable: &maxUnavailable}
+	}
+
+	pdb := &policyv1.PodDisruptionBudget{
+		TypeMeta: metav1.TypeMeta{APIVersion: policyv1.SchemeGroupVersion.String(), Kind: "PodDisruptionBudget"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       myAppResource.Namespace,
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(&myAppResource, v1beta1.GroupVersion.WithKind("MyAppResource"))},
+		},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			MinAvailable:   budget.MinAvailable,
+			MaxUnavailable: budget.MaxUnavailable,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": name},
+			},
+		},
+	}
+
+	return pdb
+}
+
+// ConstructRedisAuthSecret builds the Secret holding the generated Redis password.
+func ConstructRedisAuthSecret(myAppResource v1beta1.MyAppResource, password string) *corev1.Secret {
+	return &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{APIVersion: corev1.SchemeGroupVersion.String(), Kind: "Secret"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            GetAuthSecretName(myAppResource.Name),
+			Namespace:       myAppResource.Namespace,
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(&myAppResource, v1beta1.GroupVersion.WithKind("MyAppResource"))},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{PasswordKey: []byte(password)},
+	}
+}
+
+// ConstructEncodedPasswordSecret builds the Secret holding the percent-encoded Redis password of the
+// MyAppResource, which PodInfo puts in its cache server URL.
+func ConstructEncodedPasswordSecret(myAppResource v1beta1.MyAppResource, password string) *corev1.Secret {
+	return &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{APIVersion: corev1.SchemeGroupVersion.String(), Kind: "Secret"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            GetEncodedPasswordSecretName(myAppResource.Name),
+			Namespace:       myAppResource.Namespace,
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(&myAppResource, v1beta1.GroupVersion.WithKind("MyAppResource"))},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{PasswordKey: []byte(EncodePassword(password))},
+	}
+}
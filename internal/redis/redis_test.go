@@ -4,7 +4,18 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"regexp"
+	"strings"
 	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/domenicbove/angi/api/v1beta1"
+	"github.com/domenicbove/angi/internal/config"
+	"github.com/domenicbove/angi/internal/podspec"
 )
 
 func TestBooks(t *testing.T) {
@@ -14,11 +25,505 @@ func TestBooks(t *testing.T) {
 
 var _ = Describe("Redis", func() {
 
+	cfg := config.New()
+
 	Context("When constructing endpoint", func() {
 		It("Should build strings correctly", func() {
 			Expect(GetDeploymentName("whatever")).Should(Equal("whatever-redis"))
 
-			Expect(GetEndpoint("whatever", "default")).Should(Equal("tcp://whatever-redis.default.svc.cluster.local:6379"))
+			Expect(GetEndpoint("whatever", "default", cfg.ClusterDomain)).Should(Equal("tcp://whatever-redis.default.svc.cluster.local:6379"))
+			Expect(GetHeadlessServiceName("whatever")).Should(Equal("whatever-redis-headless"))
+			Expect(GetPersistentVolumeClaimName("whatever")).Should(Equal("data-whatever-redis-0"))
+			name, ok := GetMyAppResourceNameFromClaim("data-whatever-redis-0")
+			Expect(ok).Should(BeTrue())
+			Expect(name).Should(Equal("whatever"))
+			_, ok = GetMyAppResourceNameFromClaim("data-redis-0")
+			Expect(ok).Should(BeFalse())
+			_, ok = GetMyAppResourceNameFromClaim("data-whatever-redis-1")
+			Expect(ok).Should(BeFalse())
+			Expect(GetAuthSecretName("whatever")).Should(Equal("whatever-redis-auth"))
+			Expect(GetAuthenticatedEndpoint("whatever", "default", cfg.ClusterDomain)).Should(Equal("tcp://:$(REDIS_PASSWORD_URLENCODED)@whatever-redis.default.svc.cluster.local:6379"))
+		})
+	})
+
+	Context("When selecting the password Secret", func() {
+		It("Should default to the generated Secret", func() {
+			myAppResource := v1beta1.MyAppResource{ObjectMeta: metav1.ObjectMeta{Name: "whatever"}}
+
+			Expect(GetPasswordSecretKeySelector(myAppResource)).Should(Equal(&corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "whatever-redis-auth"},
+				Key:                  PasswordKey,
+			}))
+		})
+
+		It("Should use the existing Secret", func() {
+			existing := &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "my-redis"},
+				Key:                  "redis-password",
+			}
+			myAppResource := v1beta1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: "whatever"},
+				Spec: v1beta1.MyAppResourceSpec{
+					Redis: v1beta1.Redis{Enabled: true, Auth: &v1beta1.RedisAuth{ExistingSecretRef: existing}},
+				},
+			}
+
+			Expect(GetPasswordSecretKeySelector(myAppResource)).Should(Equal(existing))
+		})
+
+		It("Should generate distinct passwords", func() {
+			first, err := GeneratePassword()
+			Expect(err).ShouldNot(HaveOccurred())
+			second, err := GeneratePassword()
+			Expect(err).ShouldNot(HaveOccurred())
+
+			Expect(first).Should(HaveLen(48))
+			Expect(first).ShouldNot(Equal(second))
+			Expect(EncodePassword(first)).Should(Equal(first))
+		})
+
+		It("Should percent-encode the password for the cache server URL", func() {
+			Expect(EncodePassword("Some-pass_word.1~")).Should(Equal("Some-pass_word.1~"))
+			Expect(EncodePassword("p@ss:w/rd %20ä")).Should(Equal("p%40ss%3Aw%2Frd%20%2520%C3%A4"))
+
+			myAppResource := v1beta1.MyAppResource{ObjectMeta: metav1.ObjectMeta{Name: "whatever", Namespace: "default"}}
+			secret := ConstructEncodedPasswordSecret(myAppResource, "p@ss")
+			Expect(secret.Name).Should(Equal("whatever-redis-url-auth"))
+			Expect(secret.Data).Should(HaveKeyWithValue("password", []byte("p%40ss")))
+			Expect(GetEncodedPasswordEnvVar("whatever").ValueFrom.SecretKeyRef).Should(Equal(&corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "whatever-redis-url-auth"}, Key: "password"}))
+		})
+	})
+
+	Context("When setting the probes", func() {
+		It("Should check the port and PING by default", func() {
+			myAppResource := v1beta1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: "whatever", Namespace: "default"},
+				Spec:       v1beta1.MyAppResourceSpec{Redis: v1beta1.Redis{Enabled: true}},
+			}
+
+			container := ConstructRedisDeployment(myAppResource, cfg).Spec.Template.Spec.Containers[0]
+			Expect(container.LivenessProbe.TCPSocket.Port).Should(Equal(intstr.FromInt(6379)))
+			Expect(container.ReadinessProbe.Exec.Command).Should(Equal([]string{"sh", "-c",
+				`REDISCLI_AUTH="$REDIS_PASSWORD" redis-cli -p 6379 ping | grep -q PONG`}))
+			Expect(container.StartupProbe).Should(BeNil())
+		})
+
+		It("Should replace the defaults with the probes of the spec", func() {
+			startup := &corev1.Probe{
+				ProbeHandler:     corev1.ProbeHandler{TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt(6379)}},
+				FailureThreshold: 30,
+			}
+			myAppResource := v1beta1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: "whatever", Namespace: "default"},
+				Spec: v1beta1.MyAppResourceSpec{
+					Redis: v1beta1.Redis{Enabled: true, Probes: &v1beta1.Probes{Startup: startup}},
+				},
+			}
+
+			container := ConstructRedisDeployment(myAppResource, cfg).Spec.Template.Spec.Containers[0]
+			Expect(container.StartupProbe).Should(Equal(startup))
+			Expect(container.LivenessProbe).ShouldNot(BeNil())
+
+			redisCache := v1beta1.RedisCache{
+				ObjectMeta: metav1.ObjectMeta{Name: "shared", Namespace: "default"},
+				Spec:       v1beta1.RedisCacheSpec{Probes: &v1beta1.Probes{Startup: startup}},
+			}
+			Expect(ConstructCacheDeployment(redisCache, cfg).Spec.Template.Spec.Containers[0].StartupProbe).Should(Equal(startup))
+		})
+	})
+
+	Context("When setting the security context", func() {
+		It("Should meet the restricted Pod Security Standard by default", func() {
+			myAppResource := v1beta1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: "whatever", Namespace: "default"},
+				Spec:       v1beta1.MyAppResourceSpec{Redis: v1beta1.Redis{Enabled: true, Mode: v1beta1.RedisModeSentinel}},
+			}
+
+			for _, podSpec := range []corev1.PodSpec{
+				ConstructRedisDeployment(myAppResource, cfg).Spec.Template.Spec,
+				ConstructRedisSentinelStatefulSet(myAppResource, cfg).Spec.Template.Spec,
+				ConstructRedisSnapshotJob(myAppResource, cfg).Spec.Template.Spec,
+			} {
+				Expect(*podSpec.SecurityContext.RunAsNonRoot).Should(BeTrue())
+				Expect(podSpec.SecurityContext.SeccompProfile.Type).Should(Equal(corev1.SeccompProfileTypeRuntimeDefault))
+				container := podSpec.Containers[0]
+				Expect(*container.SecurityContext.AllowPrivilegeEscalation).Should(BeFalse())
+				Expect(*container.SecurityContext.ReadOnlyRootFilesystem).Should(BeTrue())
+				Expect(container.SecurityContext.Capabilities.Drop).Should(Equal([]corev1.Capability{"ALL"}))
+				Expect(container.VolumeMounts).Should(ContainElement(corev1.VolumeMount{Name: podspec.TmpVolumeName, MountPath: podspec.TmpMountPath}))
+			}
+		})
+
+		It("Should only write to the volumes of the pod, since the root filesystem is read-only", func() {
+			myAppResource := v1beta1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: "whatever", Namespace: "default"},
+				Spec: v1beta1.MyAppResourceSpec{
+					Redis: v1beta1.Redis{Enabled: true, Mode: v1beta1.RedisModeSentinel},
+				},
+			}
+			redisCache := v1beta1.RedisCache{ObjectMeta: metav1.ObjectMeta{Name: "shared", Namespace: "default"}}
+
+			// the absolute paths the start scripts and commands use, other than /dev/null
+			pathRegexp := regexp.MustCompile(`(?:^|[\s"'=>])(/[\w.-]+(?:/[\w.-]+)*)`)
+			for _, podSpec := range []corev1.PodSpec{
+				ConstructRedisStatefulSet(myAppResource, cfg).Spec.Template.Spec,
+				ConstructRedisSentinelStatefulSet(myAppResource, cfg).Spec.Template.Spec,
+				ConstructRedisSnapshotJob(myAppResource, cfg).Spec.Template.Spec,
+				ConstructCacheDeployment(redisCache, cfg).Spec.Template.Spec,
+			} {
+				container := podSpec.Containers[0]
+				Expect(*container.SecurityContext.ReadOnlyRootFilesystem).Should(BeTrue())
+				command := strings.Join(append(append([]string{}, container.Command...), container.Args...), " ")
+				for _, match := range pathRegexp.FindAllStringSubmatch(command, -1) {
+					path := match[1]
+					if path == "/dev/null" {
+						continue
+					}
+					Expect(container.VolumeMounts).Should(ContainElement(WithTransform(func(mount corev1.VolumeMount) bool {
+						return path == mount.MountPath || strings.HasPrefix(path, mount.MountPath+"/")
+					}, BeTrue())), "%s of container %s is on no volume", path, container.Name)
+				}
+			}
+		})
+
+		It("Should keep the data on an emptyDir without persistence", func() {
+			myAppResource := v1beta1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: "whatever", Namespace: "default"},
+				Spec:       v1beta1.MyAppResourceSpec{Redis: v1beta1.Redis{Enabled: true}},
+			}
+
+			podSpec := ConstructRedisDeployment(myAppResource, cfg).Spec.Template.Spec
+			Expect(podSpec.Volumes).Should(ContainElement(corev1.Volume{Name: DataVolumeName,
+				VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}))
+			Expect(podSpec.Containers[0].VolumeMounts).Should(ContainElement(corev1.VolumeMount{Name: DataVolumeName, MountPath: DataMountPath}))
+
+			myAppResource.Spec.Redis.Persistence = &v1beta1.RedisPersistence{}
+			statefulSet := ConstructRedisStatefulSet(myAppResource, cfg)
+			Expect(statefulSet.Spec.Template.Spec.Volumes).Should(Equal([]corev1.Volume{{Name: podspec.TmpVolumeName,
+				VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}}))
+			Expect(*statefulSet.Spec.Template.Spec.SecurityContext.FSGroup).Should(Equal(int64(999)))
+		})
+
+		It("Should replace the defaults with the security contexts of the spec", func() {
+			runAsUser := int64(1001)
+			privileged := false
+			myAppResource := v1beta1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: "whatever", Namespace: "default"},
+				Spec: v1beta1.MyAppResourceSpec{
+					Redis: v1beta1.Redis{
+						Enabled:            true,
+						PodSecurityContext: &corev1.PodSecurityContext{RunAsUser: &runAsUser},
+						SecurityContext:    &corev1.SecurityContext{Privileged: &privileged},
+					},
+				},
+			}
+
+			podSpec := ConstructRedisDeployment(myAppResource, cfg).Spec.Template.Spec
+			Expect(podSpec.SecurityContext).Should(Equal(&corev1.PodSecurityContext{RunAsUser: &runAsUser}))
+			Expect(podSpec.Containers[0].SecurityContext).Should(Equal(&corev1.SecurityContext{Privileged: &privileged}))
+
+			redisCache := v1beta1.RedisCache{
+				ObjectMeta: metav1.ObjectMeta{Name: "shared", Namespace: "default"},
+				Spec:       v1beta1.RedisCacheSpec{PodSecurityContext: &corev1.PodSecurityContext{RunAsUser: &runAsUser}},
+			}
+			podSpec = ConstructCacheDeployment(redisCache, cfg).Spec.Template.Spec
+			Expect(podSpec.SecurityContext).Should(Equal(&corev1.PodSecurityContext{RunAsUser: &runAsUser}))
+			Expect(*podSpec.Containers[0].SecurityContext.ReadOnlyRootFilesystem).Should(BeTrue())
+		})
+	})
+
+	Context("When constructing the persistent StatefulSet", func() {
+		It("Should claim storage for the redis data", func() {
+			storageClassName := "fast"
+			myAppResource := v1beta1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: "whatever", Namespace: "default"},
+				Spec: v1beta1.MyAppResourceSpec{
+					Redis: v1beta1.Redis{
+						Enabled:     true,
+						Persistence: &v1beta1.RedisPersistence{StorageClassName: &storageClassName},
+					},
+				},
+			}
+
+			statefulSet := ConstructRedisStatefulSet(myAppResource, cfg)
+			Expect(statefulSet.Name).Should(Equal("whatever-redis"))
+			Expect(statefulSet.Spec.ServiceName).Should(Equal("whatever-redis-headless"))
+			Expect(statefulSet.Spec.Template.Spec.Containers[0].Args).Should(Equal([]string{"--appendonly", "yes"}))
+			Expect(statefulSet.Spec.Template.Spec.Containers[0].VolumeMounts).Should(ContainElement(
+				corev1.VolumeMount{Name: DataVolumeName, MountPath: DataMountPath}))
+
+			Expect(statefulSet.Spec.VolumeClaimTemplates).Should(HaveLen(1))
+			claim := statefulSet.Spec.VolumeClaimTemplates[0]
+			Expect(claim.Name).Should(Equal(DataVolumeName))
+			Expect(claim.Labels).Should(HaveKeyWithValue("app.kubernetes.io/instance", "whatever"))
+			Expect(*claim.Spec.StorageClassName).Should(Equal("fast"))
+			Expect(claim.Spec.AccessModes).Should(Equal([]corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}))
+			Expect(claim.Spec.Resources.Requests.Storage().String()).Should(Equal(DefaultStorageSize))
+
+			headless := ConstructRedisHeadlessService(myAppResource)
+			Expect(headless.Name).Should(Equal("whatever-redis-headless"))
+			Expect(headless.Spec.ClusterIP).Should(Equal(corev1.ClusterIPNone))
+		})
+	})
+
+	Context("When constructing replication mode", func() {
+		It("Should run a primary with read replicas behind the primary Service", func() {
+			replicas := int32(3)
+			myAppResource := v1beta1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: "whatever", Namespace: "default"},
+				Spec: v1beta1.MyAppResourceSpec{
+					Redis: v1beta1.Redis{Enabled: true, Mode: v1beta1.RedisModeReplication, Replicas: &replicas},
+				},
+			}
+
+			statefulSet := ConstructRedisStatefulSet(myAppResource, cfg)
+			Expect(*statefulSet.Spec.Replicas).Should(Equal(int32(4)))
+			Expect(statefulSet.Spec.VolumeClaimTemplates).Should(BeEmpty())
+			container := statefulSet.Spec.Template.Spec.Containers[0]
+			Expect(container.Command).Should(Equal([]string{"sh", "-c", replicaStartScript, "redis-server"}))
+			Expect(replicaStartScript).Should(ContainSubstring(`printf 'masterauth "%s"\n' "${PASSWORD}" >> /tmp/redis-auth.conf`))
+			Expect(replicaStartScript).Should(ContainSubstring(`exec redis-server /tmp/redis-auth.conf --dir /data "$@"`))
+			Expect(container.Env).Should(ContainElement(corev1.EnvVar{Name: "REDIS_PRIMARY_HOST",
+				Value: "whatever-redis-0.whatever-redis-headless.default.svc.cluster.local"}))
+
+			Expect(ConstructRedisService(myAppResource).Spec.Selector).Should(HaveKeyWithValue(RoleLabel, RolePrimary))
+			Expect(ConstructRedisHeadlessService(myAppResource).Spec.Selector).ShouldNot(HaveKey(RoleLabel))
+		})
+
+		It("Should default the sentinel quorum", func() {
+			myAppResource := v1beta1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: "whatever", Namespace: "default"},
+				Spec: v1beta1.MyAppResourceSpec{
+					Redis: v1beta1.Redis{Enabled: true, Mode: v1beta1.RedisModeSentinel},
+				},
+			}
+
+			Expect(GetReplicas(myAppResource)).Should(Equal(int32(1 + DefaultReplicas)))
+
+			sentinel := ConstructRedisSentinelStatefulSet(myAppResource, cfg)
+			Expect(*sentinel.Spec.Replicas).Should(Equal(int32(DefaultSentinelReplicas)))
+			Expect(sentinel.Spec.ServiceName).Should(Equal("whatever-redis-sentinel"))
+			Expect(sentinel.Spec.Template.Spec.Containers[0].Env).Should(ContainElement(
+				corev1.EnvVar{Name: "SENTINEL_QUORUM", Value: "2"}))
+			Expect(sentinelStartScript).Should(ContainSubstring(`sentinel auth-pass mymaster "${PASSWORD}"`))
+
+			redisContainer := ConstructRedisStatefulSet(myAppResource, cfg).Spec.Template.Spec.Containers[0]
+			Expect(redisContainer.Env).Should(ContainElement(
+				corev1.EnvVar{Name: "SENTINEL_HOST", Value: "whatever-redis-sentinel.default.svc.cluster.local"}))
+		})
+	})
+
+	Context("When constructing the disruption budget", func() {
+		It("Should only default a budget with more than one pod", func() {
+			myAppResource := v1beta1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: "whatever", Namespace: "default"},
+				Spec: v1beta1.MyAppResourceSpec{
+					Redis: v1beta1.Redis{Enabled: true},
+				},
+			}
+			Expect(ConstructRedisPodDisruptionBudget(myAppResource)).Should(BeNil())
+
+			myAppResource.Spec.Redis.Mode = v1beta1.RedisModeReplication
+			pdb := ConstructRedisPodDisruptionBudget(myAppResource)
+			Expect(pdb.Name).Should(Equal("whatever-redis"))
+			Expect(pdb.Spec.Selector.MatchLabels).Should(Equal(map[string]string{"app": "whatever-redis"}))
+			Expect(*pdb.Spec.MaxUnavailable).Should(Equal(intstr.FromInt(DefaultMaxUnavailable)))
+		})
+
+		It("Should use the budget from the spec", func() {
+			minAvailable := intstr.FromInt(1)
+			myAppResource := v1beta1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: "whatever", Namespace: "default"},
+				Spec: v1beta1.MyAppResourceSpec{
+					Redis: v1beta1.Redis{Enabled: true, DisruptionBudget: &v1beta1.DisruptionBudget{MinAvailable: &minAvailable}},
+				},
+			}
+
+			pdb := ConstructRedisPodDisruptionBudget(myAppResource)
+			Expect(*pdb.Spec.MinAvailable).Should(Equal(minAvailable))
+			Expect(pdb.Spec.MaxUnavailable).Should(BeNil())
+		})
+	})
+
+	Context("When constructing the snapshot", func() {
+		It("Should dump the primary to a claim sized like the persistence", func() {
+			size := resource.MustParse("5Gi")
+			myAppResource := v1beta1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: "whatever", Namespace: "default"},
+				Spec: v1beta1.MyAppResourceSpec{
+					Redis: v1beta1.Redis{Enabled: true, Persistence: &v1beta1.RedisPersistence{Size: &size}},
+				},
+			}
+
+			claim := ConstructRedisSnapshotPersistentVolumeClaim(myAppResource, cfg)
+			Expect(claim.Name).Should(Equal("whatever-redis-snapshot"))
+			Expect(claim.OwnerReferences).Should(BeEmpty())
+			Expect(claim.Spec.Resources.Requests.Storage().String()).Should(Equal("5Gi"))
+
+			container := ConstructRedisSnapshotJob(myAppResource, cfg).Spec.Template.Spec.Containers[0]
+			Expect(container.Command).Should(Equal([]string{"redis-cli", "-h", "whatever-redis.default.svc.cluster.local",
+				"-p", "6379", "--rdb", "/snapshot/dump.rdb"}))
+			Expect(container.Env[0].ValueFrom.SecretKeyRef.Name).Should(Equal("whatever-redis-auth"))
+		})
+	})
+
+	Context("When parsing INFO replication", func() {
+		It("Should count the online replicas", func() {
+			info := "# Replication\r\nrole:master\r\nconnected_slaves:2\r\n" +
+				"slave0:ip=10.0.0.2,port=6379,state=online,offset=42,lag=0\r\n" +
+				"slave1:ip=10.0.0.3,port=6379,state=wait_bgsave,offset=0,lag=0\r\n" +
+				"master_repl_offset:42\r\n"
+
+			Expect(parseReplicasInSync(info)).Should(Equal(int32(1)))
+		})
+	})
+
+	Context("When configuring the Redis container", func() {
+		It("Should use the image, resources and extra args from the spec", func() {
+			myAppResource := v1beta1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: "whatever", Namespace: "default"},
+				Spec: v1beta1.MyAppResourceSpec{
+					Redis: v1beta1.Redis{
+						Enabled: true,
+						Image:   v1beta1.RedisImage{Repository: "redis/redis-stack-server", Tag: "7.2.0-v6"},
+						Resources: &corev1.ResourceRequirements{
+							Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")},
+						},
+						ExtraArgs: []string{"--maxmemory", "200mb"},
+					},
+				},
+			}
+
+			container := ConstructRedisDeployment(myAppResource, cfg).Spec.Template.Spec.Containers[0]
+			Expect(container.Image).Should(Equal("redis/redis-stack-server:7.2.0-v6"))
+			Expect(container.Resources.Limits.Memory().String()).Should(Equal("256Mi"))
+			Expect(container.Args).Should(Equal([]string{"--maxmemory", "200mb"}))
+			Expect(container.Command).Should(Equal([]string{"sh", "-c", standaloneStartScript, "redis-server"}))
+			Expect(standaloneStartScript).Should(ContainSubstring(`printf 'requirepass "%s"\n' "${PASSWORD}" >> /tmp/redis-auth.conf`))
+		})
+
+		It("Should start redis-server itself, so other images than redis-stack work", func() {
+			myAppResource := v1beta1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: "whatever", Namespace: "default"},
+				Spec: v1beta1.MyAppResourceSpec{
+					Redis: v1beta1.Redis{
+						Enabled:   true,
+						Image:     v1beta1.RedisImage{Repository: "redis", Tag: "7"},
+						ExtraArgs: []string{"--save", "900 1"},
+					},
+				},
+			}
+
+			container := ConstructRedisDeployment(myAppResource, cfg).Spec.Template.Spec.Containers[0]
+			Expect(container.Image).Should(Equal("redis:7"))
+			Expect(container.Command).Should(Equal([]string{"sh", "-c", standaloneStartScript, "redis-server"}))
+			// an argument holding a space is not split
+			Expect(container.Args).Should(Equal([]string{"--save", "900 1"}))
+			Expect(standaloneStartScript).Should(ContainSubstring(`exec redis-server /tmp/redis-auth.conf --dir /data "$@"`))
+			Expect(standaloneStartScript).ShouldNot(ContainSubstring("entrypoint"))
+			Expect(container.Env).ShouldNot(ContainElement(HaveField("Name", "REDIS_ARGS")))
+
+			myAppResource.Spec.Redis.Mode = v1beta1.RedisModeReplication
+			container = ConstructRedisStatefulSet(myAppResource, cfg).Spec.Template.Spec.Containers[0]
+			Expect(container.Args).Should(Equal([]string{"--save", "900 1"}))
+			Expect(replicaStartScript).ShouldNot(ContainSubstring("entrypoint"))
+		})
+
+		It("Should fall back to the default image", func() {
+			myAppResource := v1beta1.MyAppResource{
+				Spec: v1beta1.MyAppResourceSpec{Redis: v1beta1.Redis{Enabled: true}},
+			}
+
+			Expect(GetImage(myAppResource, cfg)).Should(Equal("redis/redis-stack:7.2.0-v6"))
+		})
+
+		It("Should use the defaults and cluster domain of the operator configuration", func() {
+			cfg := config.New()
+			cfg.ClusterDomain = "example.internal"
+			cfg.LabelPrefix = "example.com"
+			cfg.Redis.Image = config.Image{Repository: "registry.example.com/redis-stack", Tag: "7.2.0-v6"}
+			cfg.Redis.Resources = &corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("128Mi")},
+			}
+			myAppResource := v1beta1.MyAppResource{
+				ObjectMeta: metav1.ObjectMeta{Name: "whatever", Namespace: "default"},
+				Spec: v1beta1.MyAppResourceSpec{
+					Redis: v1beta1.Redis{
+						Enabled:     true,
+						Image:       v1beta1.RedisImage{Tag: "7.2.0-v7"},
+						Mode:        v1beta1.RedisModeSentinel,
+						Persistence: &v1beta1.RedisPersistence{},
+					},
+				},
+			}
+
+			Expect(GetAuthenticatedEndpoint("whatever", "default", cfg.ClusterDomain)).Should(Equal(
+				"tcp://:$(REDIS_PASSWORD_URLENCODED)@whatever-redis.default.svc.example.internal:6379"))
+			statefulSet := ConstructRedisStatefulSet(myAppResource, cfg)
+			container := statefulSet.Spec.Template.Spec.Containers[0]
+			Expect(container.Image).Should(Equal("registry.example.com/redis-stack:7.2.0-v7"))
+			Expect(container.Resources.Requests.Memory().String()).Should(Equal("128Mi"))
+			Expect(container.Env).Should(ContainElements(
+				corev1.EnvVar{Name: "REDIS_PRIMARY_HOST", Value: "whatever-redis-0.whatever-redis-headless.default.svc.example.internal"},
+				corev1.EnvVar{Name: "SENTINEL_HOST", Value: "whatever-redis-sentinel.default.svc.example.internal"}))
+			Expect(statefulSet.Spec.VolumeClaimTemplates[0].Labels).Should(HaveKeyWithValue("example.com/instance", "whatever"))
+		})
+	})
+
+	Context("When using an external Redis", func() {
+		It("Should connect over TLS with the password of the credentials Secret", func() {
+			connection := GetExternalConnection(v1beta1.RedisExternal{
+				Host: "redis.example.com",
+				Port: 6380,
+				TLS:  true,
+				CredentialsSecretRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "managed-redis"}, Key: "auth"},
+			})
+			Expect(connection.GetEndpoint()).Should(Equal("rediss://redis.example.com:6380"))
+			Expect(connection.GetAuthenticatedEndpoint()).Should(Equal("rediss://:$(REDIS_PASSWORD_URLENCODED)@redis.example.com:6380"))
+			Expect(connection.Password).Should(Equal(&corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "managed-redis"}, Key: "auth"}))
+		})
+
+		It("Should connect without a password when there are no credentials", func() {
+			connection := GetExternalConnection(v1beta1.RedisExternal{Host: "10.0.0.7"})
+			Expect(connection.GetAuthenticatedEndpoint()).Should(Equal("tcp://10.0.0.7:6379"))
+		})
+	})
+
+	Context("When constructing a RedisCache", func() {
+		It("Should connect each consumer to its own database", func() {
+			database := int32(3)
+			redisCache := v1beta1.RedisCache{ObjectMeta: metav1.ObjectMeta{Name: "shared", Namespace: "default"}}
+
+			connection := GetCacheConnection(redisCache, v1beta1.RedisCacheConsumer{Name: "whatever", Database: &database}, cfg.ClusterDomain)
+			Expect(connection.GetAuthenticatedEndpoint()).Should(Equal(
+				"tcp://:$(REDIS_PASSWORD_URLENCODED)@shared-rediscache.default.svc.cluster.local:6379/3"))
+			Expect(connection.Password.Name).Should(Equal("shared-rediscache-auth"))
+			Expect(GetCacheEndpoint(redisCache, cfg.ClusterDomain)).Should(Equal("tcp://shared-rediscache.default.svc.cluster.local:6379"))
+		})
+
+		It("Should run the databases of the spec", func() {
+			redisCache := v1beta1.RedisCache{
+				ObjectMeta: metav1.ObjectMeta{Name: "shared", Namespace: "default"},
+				Spec: v1beta1.RedisCacheSpec{
+					Databases:   4,
+					ExtraArgs:   []string{"--maxmemory", "100mb"},
+					Persistence: &v1beta1.RedisPersistence{},
+				},
+			}
+
+			deployment := ConstructCacheDeployment(redisCache, cfg)
+			Expect(deployment.Name).Should(Equal("shared-rediscache"))
+			Expect(deployment.OwnerReferences[0].Kind).Should(Equal("RedisCache"))
+			Expect(deployment.Spec.Template.Spec.Containers[0].Args).Should(Equal([]string{"--databases", "4", "--maxmemory", "100mb"}))
+
+			statefulSet := ConstructCacheStatefulSet(redisCache, cfg)
+			Expect(statefulSet.Spec.ServiceName).Should(Equal("shared-rediscache-headless"))
+			Expect(statefulSet.Spec.VolumeClaimTemplates).Should(HaveLen(1))
+			Expect(statefulSet.Spec.Template.Spec.Containers[0].Args).Should(Equal(
+				[]string{"--appendonly", "yes", "--databases", "4", "--maxmemory", "100mb"}))
 		})
 	})
 })
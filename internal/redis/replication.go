@@ -0,0 +1,218 @@
+package redis
+
+import (
+	"fmt"
+	"strconv"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/domenicbove/angi/api/v1beta1"
+	"github.com/domenicbove/angi/internal/config"
+	"github.com/domenicbove/angi/internal/podspec"
+)
+
+const (
+	SentinelPort = 26379
+
+	// MasterName is the name Sentinel monitors the Redis primary under.
+	MasterName = "mymaster"
+
+	// RoleLabel is set by the operator on the Redis pods in replication and sentinel mode,
+	// the Redis Service selects the pod labeled RolePrimary.
+	RoleLabel   = "my.api.group/redis-role"
+	RolePrimary = "primary"
+	RoleReplica = "replica"
+
+	// DefaultReplicas is the number of read replicas used when spec.redis.replicas is unset.
+	DefaultReplicas = 2
+	// DefaultSentinelReplicas is the number of Sentinel pods used when spec.redis.sentinel is unset.
+	DefaultSentinelReplicas = 3
+	// DefaultSentinelQuorum is the Sentinel quorum used when spec.redis.sentinel is unset.
+	DefaultSentinelQuorum = 2
+
+	sentinelConfigVolumeName = "sentinel-config"
+	sentinelConfigMountPath  = "/sentinel"
+)
+
+// replicaStartScript starts a Redis pod as the primary when it is the current primary, and as a
+// replica of it otherwise. In sentinel mode the current primary is asked from Sentinel, so a
+// restarted former primary rejoins as a replica. The container args are passed on to redis-server
+// as "$@". $$ escapes the Kubernetes variable expansion.
+var replicaStartScript = writeAuthConfigScript("requirepass", "masterauth") + fmt.Sprintf(`SELF="${POD_NAME}.${REDIS_DOMAIN}"
+PRIMARY="${REDIS_PRIMARY_HOST}"
+if [ -n "${SENTINEL_HOST}" ]; then
+  CURRENT="$$(redis-cli -h "${SENTINEL_HOST}" -p %[1]d sentinel get-master-addr-by-name %[2]s 2>/dev/null | head -n 1)"
+  if [ -n "${CURRENT}" ]; then PRIMARY="${CURRENT}"; fi
+fi
+set -- --replica-announce-ip "${SELF}" "$@"
+if [ "${PRIMARY}" != "${SELF}" ]; then
+  set -- "$@" --replicaof "${PRIMARY}" %[3]d
+fi
+exec redis-server %[4]s --dir %[5]s "$@"
+`, SentinelPort, MasterName, RedisPort, authConfigPath, DataMountPath)
+
+// sentinelStartScript writes the Sentinel config, which Sentinel rewrites at runtime, and starts
+// Sentinel. It monitors the primary the other Sentinels agree on, or the first Redis pod.
+var sentinelStartScript = escapePasswordScript + fmt.Sprintf(`PRIMARY="${REDIS_PRIMARY_HOST}"
+CURRENT="$$(redis-cli -h "${SENTINEL_HOST}" -p %[1]d sentinel get-master-addr-by-name %[2]s 2>/dev/null | head -n 1)"
+if [ -n "${CURRENT}" ]; then PRIMARY="${CURRENT}"; fi
+cat > %[4]s/sentinel.conf <<EOF
+port %[1]d
+sentinel resolve-hostnames yes
+sentinel announce-hostnames yes
+sentinel announce-ip ${POD_NAME}.${SENTINEL_HOST}
+sentinel monitor %[2]s ${PRIMARY} %[3]d ${SENTINEL_QUORUM}
+sentinel auth-pass %[2]s "${PASSWORD}"
+sentinel down-after-milliseconds %[2]s 5000
+sentinel failover-timeout %[2]s 60000
+sentinel parallel-syncs %[2]s 1
+EOF
+exec redis-server %[4]s/sentinel.conf --sentinel
+`, SentinelPort, MasterName, RedisPort, sentinelConfigMountPath)
+
+// GetMode returns the Redis mode, which is standalone when unset.
+func GetMode(myAppResource v1beta1.MyAppResource) v1beta1.RedisMode {
+	if myAppResource.Spec.Redis.Mode == "" {
+		return v1beta1.RedisModeStandalone
+	}
+	return myAppResource.Spec.Redis.Mode
+}
+
+// IsReplicated returns true when Redis runs a primary with read replicas.
+func IsReplicated(myAppResource v1beta1.MyAppResource) bool {
+	return GetMode(myAppResource) != v1beta1.RedisModeStandalone
+}
+
+// GetReplicas returns the number of Redis pods, the primary plus its read replicas.
+func GetReplicas(myAppResource v1beta1.MyAppResource) int32 {
+	if !IsReplicated(myAppResource) {
+		return 1
+	}
+	if myAppResource.Spec.Redis.Replicas != nil {
+		return 1 + *myAppResource.Spec.Redis.Replicas
+	}
+	return 1 + DefaultReplicas
+}
+
+// GetSentinel returns the Sentinel settings with defaults applied.
+func GetSentinel(myAppResource v1beta1.MyAppResource) v1beta1.RedisSentinel {
+	sentinel := v1beta1.RedisSentinel{Replicas: DefaultSentinelReplicas, Quorum: DefaultSentinelQuorum}
+	if myAppResource.Spec.Redis.Sentinel != nil {
+		if myAppResource.Spec.Redis.Sentinel.Replicas > 0 {
+			sentinel.Replicas = myAppResource.Spec.Redis.Sentinel.Replicas
+		}
+		if myAppResource.Spec.Redis.Sentinel.Quorum > 0 {
+			sentinel.Quorum = myAppResource.Spec.Redis.Sentinel.Quorum
+		}
+	}
+	return sentinel
+}
+
+// GetPodName returns the name of the Redis StatefulSet pod with the given ordinal.
+func GetPodName(myAppResourceName string, ordinal int) string {
+	return fmt.Sprintf("%s-%d", GetDeploymentName(myAppResourceName), ordinal)
+}
+
+func GetHeadlessServiceDomain(myAppResourceName, namespace, clusterDomain string) string {
+	return fmt.Sprintf("%s.%s.svc.%s", GetHeadlessServiceName(myAppResourceName), namespace, clusterDomain)
+}
+
+// GetPodHost returns the stable DNS name of a Redis pod, which it announces to its primary and Sentinel.
+func GetPodHost(podName, myAppResourceName, namespace, clusterDomain string) string {
+	return fmt.Sprintf("%s.%s", podName, GetHeadlessServiceDomain(myAppResourceName, namespace, clusterDomain))
+}
+
+func GetSentinelName(myAppResourceName string) string {
+	return fmt.Sprintf("%s-sentinel", GetDeploymentName(myAppResourceName))
+}
+
+func GetSentinelHost(myAppResourceName, namespace, clusterDomain string) string {
+	return fmt.Sprintf("%s.%s.svc.%s", GetSentinelName(myAppResourceName), namespace, clusterDomain)
+}
+
+// ConstructRedisSentinelStatefulSet builds the Sentinel StatefulSet used in sentinel mode.
+func ConstructRedisSentinelStatefulSet(myAppResource v1beta1.MyAppResource, cfg config.OperatorConfig) *appsv1.StatefulSet {
+	name := GetSentinelName(myAppResource.Name)
+	sentinel := GetSentinel(myAppResource)
+
+	statefulSet := &appsv1.StatefulSet{
+		TypeMeta: metav1.TypeMeta{APIVersion: appsv1.SchemeGroupVersion.String(), Kind: "StatefulSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       myAppResource.Namespace,
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(&myAppResource, v1beta1.GroupVersion.WithKind("MyAppResource"))},
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    &sentinel.Replicas,
+			ServiceName: name,
+			// sentinels find each other through the primary, they do not need to start in order
+			PodManagementPolicy: appsv1.ParallelPodManagement,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": name},
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{"app": name},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:    "sentinel",
+							Image:   GetImage(myAppResource, cfg),
+							Command: []string{"sh", "-c", sentinelStartScript},
+							Env: []corev1.EnvVar{
+								GetPasswordEnvVar(myAppResource),
+								{Name: "POD_NAME", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"}}},
+								{Name: "SENTINEL_HOST", Value: GetSentinelHost(myAppResource.Name, myAppResource.Namespace, cfg.ClusterDomain)},
+								{Name: "SENTINEL_QUORUM", Value: strconv.Itoa(int(sentinel.Quorum))},
+								{Name: "REDIS_PRIMARY_HOST", Value: GetPodHost(GetPodName(myAppResource.Name, 0), myAppResource.Name, myAppResource.Namespace, cfg.ClusterDomain)},
+							},
+							Ports: []corev1.ContainerPort{
+								{ContainerPort: SentinelPort, Name: "sentinel", Protocol: "TCP"},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{Name: sentinelConfigVolumeName, MountPath: sentinelConfigMountPath},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{Name: sentinelConfigVolumeName, VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+					},
+				},
+			},
+		},
+	}
+	podspec.SetSecurityContext(&statefulSet.Spec.Template.Spec, user, myAppResource.Spec.Redis.PodSecurityContext, myAppResource.Spec.Redis.SecurityContext)
+
+	return statefulSet
+}
+
+// ConstructRedisSentinelService builds the headless Service of the Sentinel StatefulSet. Redis
+// pods and Sentinels ask it for the current primary, and it gives each Sentinel a stable DNS name.
+func ConstructRedisSentinelService(myAppResource v1beta1.MyAppResource) *corev1.Service {
+	name := GetSentinelName(myAppResource.Name)
+
+	service := &corev1.Service{
+		TypeMeta: metav1.TypeMeta{APIVersion: corev1.SchemeGroupVersion.String(), Kind: "Service"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       myAppResource.Namespace,
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(&myAppResource, v1beta1.GroupVersion.WithKind("MyAppResource"))},
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP:                corev1.ClusterIPNone,
+			PublishNotReadyAddresses: true,
+			Ports: []corev1.ServicePort{
+				{Name: "sentinel", Port: SentinelPort, TargetPort: intstr.FromInt(SentinelPort)},
+			},
+			Selector: map[string]string{
+				"app": name,
+			},
+		},
+	}
+
+	return service
+}
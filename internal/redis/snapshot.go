@@ -0,0 +1,108 @@
+package redis
+
+import (
+	"fmt"
+	"strconv"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/domenicbove/angi/api/v1beta1"
+	"github.com/domenicbove/angi/internal/config"
+	"github.com/domenicbove/angi/internal/podspec"
+)
+
+const (
+	// SnapshotFile is the file on the snapshot claim the Redis data is dumped to.
+	SnapshotFile = "dump.rdb"
+
+	snapshotVolumeName = "snapshot"
+	snapshotMountPath  = "/snapshot"
+	// snapshotBackoffLimit is how often a failed dump is retried before the Job fails.
+	snapshotBackoffLimit = 3
+)
+
+// GetSnapshotName returns the name of the snapshot Job and of the claim it dumps the Redis data to.
+func GetSnapshotName(myAppResourceName string) string {
+	return fmt.Sprintf("%s-snapshot", GetDeploymentName(myAppResourceName))
+}
+
+// ConstructRedisSnapshotPersistentVolumeClaim builds the claim the Redis data is dumped to on deletion.
+// It has no ownerReference, so it outlives the MyAppResource. It uses the storage settings of the
+// Redis persistence, if any.
+func ConstructRedisSnapshotPersistentVolumeClaim(myAppResource v1beta1.MyAppResource, cfg config.OperatorConfig) *corev1.PersistentVolumeClaim {
+	size := resource.MustParse(DefaultStorageSize)
+	var storageClassName *string
+	if persistence := myAppResource.Spec.Redis.Persistence; persistence != nil {
+		if persistence.Size != nil {
+			size = *persistence.Size
+		}
+		storageClassName = persistence.StorageClassName
+	}
+
+	return &corev1.PersistentVolumeClaim{
+		TypeMeta: metav1.TypeMeta{APIVersion: corev1.SchemeGroupVersion.String(), Kind: "PersistentVolumeClaim"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      GetSnapshotName(myAppResource.Name),
+			Namespace: myAppResource.Namespace,
+			Labels:    map[string]string{cfg.InstanceLabel(): myAppResource.Name},
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			StorageClassName: storageClassName,
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: size},
+			},
+		},
+	}
+}
+
+// ConstructRedisSnapshotJob builds the Job dumping the Redis data through the Redis Service, so in
+// replication and sentinel mode the primary is dumped. redis-cli reads the password from REDISCLI_AUTH.
+func ConstructRedisSnapshotJob(myAppResource v1beta1.MyAppResource, cfg config.OperatorConfig) *batchv1.Job {
+	name := GetSnapshotName(myAppResource.Name)
+	backoffLimit := int32(snapshotBackoffLimit)
+
+	job := &batchv1.Job{
+		TypeMeta: metav1.TypeMeta{APIVersion: batchv1.SchemeGroupVersion.String(), Kind: "Job"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       myAppResource.Namespace,
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(&myAppResource, v1beta1.GroupVersion.WithKind("MyAppResource"))},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{
+						{
+							Name:  "snapshot",
+							Image: GetImage(myAppResource, cfg),
+							Command: []string{"redis-cli",
+								"-h", GetHost(myAppResource.Name, myAppResource.Namespace, cfg.ClusterDomain),
+								"-p", strconv.Itoa(RedisPort),
+								"--rdb", fmt.Sprintf("%s/%s", snapshotMountPath, SnapshotFile)},
+							Env: []corev1.EnvVar{
+								{Name: "REDISCLI_AUTH", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: GetPasswordSecretKeySelector(myAppResource)}},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{Name: snapshotVolumeName, MountPath: snapshotMountPath},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{Name: snapshotVolumeName, VolumeSource: corev1.VolumeSource{
+							PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: name},
+						}},
+					},
+				},
+			},
+		},
+	}
+	podspec.SetSecurityContext(&job.Spec.Template.Spec, user, myAppResource.Spec.Redis.PodSecurityContext, myAppResource.Spec.Redis.SecurityContext)
+
+	return job
+}